@@ -2,6 +2,8 @@ package main
 
 import (
 	"os"
+	"os/signal"
+	"syscall"
 
 	nested "github.com/antonfisher/nested-logrus-formatter"
 	"github.com/blang/semver/v4"
@@ -12,9 +14,11 @@ import (
 )
 
 var defaultConfig context.Config = context.Config{
-	GitHubMirrorURL:  "https://github.com",
-	GoModuleProxyURL: "https://goproxy.io",
-	ProxyURL:         "",
+	GitHubMirrorURL:        "https://github.com",
+	GoModuleProxyURL:       "https://goproxy.io",
+	ProxyURL:               "",
+	MaxConcurrentDownloads: 4,
+	RequireScriptApproval:  false,
 }
 
 var lipVersion semver.Version = semver.MustParse("0.22.0")
@@ -30,16 +34,50 @@ func main() {
 
 	if err := ctx.CreateDirStructure(); err != nil {
 		log.Errorf("\n\tcannot create directory structure\n\t%v", err.Error())
-		return
+		os.Exit(1)
 	}
 
 	if err := ctx.LoadOrCreateConfigFile(); err != nil {
 		log.Errorf("\n\tcannot load or create config file\n\t%v", err.Error())
-		return
+		os.Exit(1)
 	}
 
+	handleInterrupts(ctx)
+
 	if err := cmdlip.Run(ctx, os.Args[1:]); err != nil {
 		log.Errorf("\n\t%v", err.Error())
-		return
+
+		if sig := ctx.InterruptSignal(); sig != nil {
+			os.Exit(getInterruptExitStatus(sig))
+		}
+
+		os.Exit(1)
 	}
 }
+
+// handleInterrupts interrupts the context on the first SIGINT or SIGTERM, so that the
+// running command stops and rolls back its changes. lip exits immediately on the second
+// signal.
+func handleInterrupts(ctx *context.Context) {
+	sigChan := make(chan os.Signal, 2)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		sig := <-sigChan
+		log.Warnf("Received %v, stopping... Press Ctrl-C again to exit immediately", sig)
+		ctx.Interrupt(sig)
+
+		sig = <-sigChan
+		os.Exit(getInterruptExitStatus(sig))
+	}()
+}
+
+// getInterruptExitStatus returns the exit status for being interrupted by the signal,
+// which is 128 plus the signal number as in shells.
+func getInterruptExitStatus(sig os.Signal) int {
+	if unixSignal, ok := sig.(syscall.Signal); ok {
+		return 128 + int(unixSignal)
+	}
+
+	return 1
+}
@@ -6,13 +6,19 @@ import (
 	"os"
 
 	nested "github.com/antonfisher/nested-logrus-formatter"
+	"github.com/lippkg/lip/internal/cmd/cmdlipautoremove"
 	"github.com/lippkg/lip/internal/cmd/cmdlipcache"
+	"github.com/lippkg/lip/internal/cmd/cmdlipcheck"
 	"github.com/lippkg/lip/internal/cmd/cmdlipconfig"
 	"github.com/lippkg/lip/internal/cmd/cmdlipinstall"
 	"github.com/lippkg/lip/internal/cmd/cmdliplist"
 	"github.com/lippkg/lip/internal/cmd/cmdlipshow"
 	"github.com/lippkg/lip/internal/cmd/cmdliptooth"
+	"github.com/lippkg/lip/internal/cmd/cmdliptree"
 	"github.com/lippkg/lip/internal/cmd/cmdlipuninstall"
+	"github.com/lippkg/lip/internal/cmd/cmdlipupgrade"
+	"github.com/lippkg/lip/internal/cmd/cmdlipverify"
+	"github.com/lippkg/lip/internal/cmd/cmdlipwhy"
 	"github.com/lippkg/lip/internal/context"
 
 	log "github.com/sirupsen/logrus"
@@ -31,13 +37,19 @@ Usage:
   lip [options] [<command> [subcommand options]] ...
 
 Commands:
+  autoremove                  Uninstall unused dependencies.
   cache                       Inspect and manage lip's cache.
+  check                       Check the dependencies of installed teeth.
   config                      Manage configuration.
   install                     Install a tooth.
   list                        List installed teeth.
   show                        Show information about installed teeth.
   tooth                       Maintain a tooth.
+  tree                        Show the dependency graph of installed teeth.
   uninstall                   Uninstall a tooth.
+  upgrade                     Upgrade installed teeth.
+  verify                      Verify the files of installed teeth.
+  why                         Show why a tooth is installed.
 
 Options:
   -h, --help                  Show help.
@@ -104,12 +116,24 @@ func Run(ctx *context.Context, args []string) error {
 	// If there is a subcommand, run it and exit.
 	if flagSet.NArg() >= 1 {
 		switch flagSet.Arg(0) {
+		case "autoremove":
+			if err := cmdlipautoremove.Run(ctx, flagSet.Args()[1:]); err != nil {
+				return err
+			}
+			return nil
+
 		case "cache":
 			if err := cmdlipcache.Run(ctx, flagSet.Args()[1:]); err != nil {
 				return err
 			}
 			return nil
 
+		case "check":
+			if err := cmdlipcheck.Run(ctx, flagSet.Args()[1:]); err != nil {
+				return err
+			}
+			return nil
+
 		case "config":
 			if err := cmdlipconfig.Run(ctx, flagSet.Args()[1:]); err != nil {
 				return err
@@ -140,12 +164,36 @@ func Run(ctx *context.Context, args []string) error {
 			}
 			return nil
 
+		case "tree":
+			if err := cmdliptree.Run(ctx, flagSet.Args()[1:]); err != nil {
+				return err
+			}
+			return nil
+
 		case "uninstall":
 			if err := cmdlipuninstall.Run(ctx, flagSet.Args()[1:]); err != nil {
 				return err
 			}
 			return nil
 
+		case "upgrade":
+			if err := cmdlipupgrade.Run(ctx, flagSet.Args()[1:]); err != nil {
+				return err
+			}
+			return nil
+
+		case "verify":
+			if err := cmdlipverify.Run(ctx, flagSet.Args()[1:]); err != nil {
+				return err
+			}
+			return nil
+
+		case "why":
+			if err := cmdlipwhy.Run(ctx, flagSet.Args()[1:]); err != nil {
+				return err
+			}
+			return nil
+
 		default:
 			return fmt.Errorf("unknown command: lip %v", flagSet.Arg(0))
 		}
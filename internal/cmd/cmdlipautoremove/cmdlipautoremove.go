@@ -0,0 +1,246 @@
+package cmdlipautoremove
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+
+	"github.com/lippkg/lip/internal/context"
+	"github.com/lippkg/lip/internal/install"
+	"github.com/lippkg/lip/internal/prompt"
+	"github.com/lippkg/lip/internal/tooth"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type FlagDict struct {
+	helpFlag          bool
+	yesFlag           bool
+	dryRunFlag        bool
+	waitLockFlag      bool
+	ignoreScriptsFlag bool
+}
+
+const helpMessage = `
+Usage:
+  lip autoremove [options]
+
+Description:
+  Uninstall teeth that were installed as dependencies and are no longer required by
+  any installed tooth.
+
+Options:
+  -h, --help                  Show help.
+  -y, --yes                   Skip confirmation.
+  --dry-run                   Show the teeth to uninstall without uninstalling them.
+  --wait-lock                 Wait for other lip processes using the workspace instead of failing.
+  --ignore-scripts, --no-scripts
+                              Do not run commands in tooth.json.
+`
+
+func Run(ctx *context.Context, args []string) error {
+
+	flagSet := flag.NewFlagSet("autoremove", flag.ContinueOnError)
+
+	// Rewrite the default usage message.
+	flagSet.Usage = func() {
+		// Do nothing.
+	}
+
+	var flagDict FlagDict
+	flagSet.BoolVar(&flagDict.helpFlag, "help", false, "")
+	flagSet.BoolVar(&flagDict.helpFlag, "h", false, "")
+	flagSet.BoolVar(&flagDict.yesFlag, "yes", false, "")
+	flagSet.BoolVar(&flagDict.yesFlag, "y", false, "")
+	flagSet.BoolVar(&flagDict.dryRunFlag, "dry-run", false, "")
+	flagSet.BoolVar(&flagDict.waitLockFlag, "wait-lock", false, "")
+	flagSet.BoolVar(&flagDict.ignoreScriptsFlag, "ignore-scripts", false, "")
+	flagSet.BoolVar(&flagDict.ignoreScriptsFlag, "no-scripts", false, "")
+	err := flagSet.Parse(args)
+	if err != nil {
+		return fmt.Errorf("failed to parse flags\n\t%w", err)
+	}
+
+	// Help flag has the highest priority.
+	if flagDict.helpFlag {
+		fmt.Print(helpMessage)
+		return nil
+	}
+
+	// Check if there are unexpected arguments.
+	if flagSet.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments: %v", flagSet.Args())
+	}
+
+	// Prevent other lip processes from changing the workspace. A dry run does not
+	// change anything.
+	if !flagDict.dryRunFlag {
+		workspaceLock, err := install.LockWorkspace(ctx, flagDict.waitLockFlag)
+		if err != nil {
+			return err
+		}
+		defer workspaceLock.Release()
+	}
+
+	// 1. Find unused dependencies.
+
+	toothRepoPathList, err := findUnusedDependencies(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to find unused dependencies\n\t%w", err)
+	}
+
+	if len(toothRepoPathList) == 0 {
+		log.Info("No unused dependencies found.")
+		return nil
+	}
+
+	if flagDict.dryRunFlag {
+		log.Info("The following teeth would be uninstalled:")
+		if err := printTeeth(ctx, toothRepoPathList); err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	// 2. Prompt for confirmation, listing the commands to run.
+
+	hookCommands := make([]install.HookCommand, 0)
+	if !flagDict.ignoreScriptsFlag {
+		hookCommands, err = install.GetTeethUninstallHookCommands(ctx, toothRepoPathList)
+		if err != nil {
+			return fmt.Errorf("failed to get hook commands\n\t%w", err)
+		}
+	}
+
+	if !flagDict.yesFlag {
+		log.Info("The following teeth will be uninstalled:")
+		if err := printTeeth(ctx, toothRepoPathList); err != nil {
+			return err
+		}
+
+		install.LogHookCommands(hookCommands)
+
+		if ok, err := prompt.Confirm(ctx, "Do you want to continue?"); err != nil {
+			return err
+		} else if !ok {
+			return fmt.Errorf("aborted")
+		}
+	}
+
+	if err := install.ApproveHookCommands(ctx, hookCommands, flagDict.yesFlag); err != nil {
+		return fmt.Errorf("failed to approve hook commands\n\t%w", err)
+	}
+
+	// 3. Uninstall all teeth. If any of them fails, roll back all changes.
+
+	tx, err := install.NewTransaction(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction\n\t%w", err)
+	}
+
+	for _, toothRepoPath := range toothRepoPathList {
+		log.Infof("Uninstalling tooth %v", toothRepoPath)
+
+		if err := install.Uninstall(ctx, tx, toothRepoPath, flagDict.ignoreScriptsFlag); err != nil {
+			tx.RollbackAndLog()
+			return fmt.Errorf("failed to uninstall tooth %v\n\t%w", toothRepoPath, err)
+		}
+	}
+
+	if err := install.SaveLockFile(ctx, tx); err != nil {
+		tx.RollbackAndLog()
+		return fmt.Errorf("failed to save lockfile\n\t%w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction\n\t%w", err)
+	}
+
+	install.WarnWorkspaceProblems(ctx)
+
+	log.Info("Done.")
+
+	return nil
+}
+
+// ---------------------------------------------------------------------
+
+// findUnusedDependencies finds the teeth installed as dependencies that are not required
+// by any installed tooth, other than those to be removed. They are returned in the order
+// to uninstall them.
+func findUnusedDependencies(ctx *context.Context) ([]string, error) {
+	metadataList, err := tooth.GetAllMetadata(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list all installed teeth\n\t%w", err)
+	}
+
+	reverseDependencies, err := tooth.GetReverseDependencies(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reverse dependencies\n\t%w", err)
+	}
+
+	dependencyOnlyTeeth := make([]string, 0)
+	for _, metadata := range metadataList {
+		installReason, err := tooth.GetInstallReason(ctx, metadata.ToothRepoPath())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get install reason of %v\n\t%w", metadata.ToothRepoPath(), err)
+		}
+
+		if installReason == tooth.InstallReasonDependency {
+			dependencyOnlyTeeth = append(dependencyOnlyTeeth, metadata.ToothRepoPath())
+		}
+	}
+	sort.Strings(dependencyOnlyTeeth)
+
+	// Removing a tooth may leave its dependencies unused, so repeat until nothing
+	// changes.
+	toRemove := make(map[string]bool)
+	for {
+		changed := false
+
+		for _, toothRepoPath := range dependencyOnlyTeeth {
+			if toRemove[toothRepoPath] {
+				continue
+			}
+
+			isRequired := false
+			for _, dependent := range reverseDependencies[toothRepoPath] {
+				if !toRemove[dependent] {
+					isRequired = true
+					break
+				}
+			}
+
+			if !isRequired {
+				toRemove[toothRepoPath] = true
+				changed = true
+			}
+		}
+
+		if !changed {
+			break
+		}
+	}
+
+	toothRepoPathList := make([]string, 0, len(toRemove))
+	for toothRepoPath := range toRemove {
+		toothRepoPathList = append(toothRepoPathList, toothRepoPath)
+	}
+
+	return install.SortForUninstall(ctx, toothRepoPathList)
+}
+
+// printTeeth logs the teeth with their versions and names.
+func printTeeth(ctx *context.Context, toothRepoPathList []string) error {
+	for _, toothRepoPath := range toothRepoPathList {
+		metadata, err := tooth.GetMetadata(ctx, toothRepoPath)
+		if err != nil {
+			return fmt.Errorf("failed to get installed tooth metadata\n\t%w", err)
+		}
+
+		log.Infof("  %v@%v: %v", toothRepoPath, metadata.Version(), metadata.Info().Name)
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package cmdlipautoremove
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/blang/semver/v4"
+	"github.com/lippkg/lip/internal/context"
+	"github.com/lippkg/lip/internal/tooth"
+)
+
+// testTooth is an installed tooth. If installReason is empty, the tooth has no
+// manifest, as if installed by an older version of lip.
+type testTooth struct {
+	toothRepoPath string
+	dependencies  []string
+	installReason string
+}
+
+func TestFindUnusedDependencies(t *testing.T) {
+	testCases := []struct {
+		name  string
+		teeth []testTooth
+		want  []string
+	}{
+		{
+			name: "dependency required by explicitly installed tooth",
+			teeth: []testTooth{
+				{"example.com/a", []string{"example.com/b"}, tooth.InstallReasonExplicit},
+				{"example.com/b", nil, tooth.InstallReasonDependency},
+			},
+			want: []string{},
+		},
+		{
+			name: "dependency no longer required",
+			teeth: []testTooth{
+				{"example.com/a", nil, tooth.InstallReasonExplicit},
+				{"example.com/b", nil, tooth.InstallReasonDependency},
+			},
+			want: []string{"example.com/b"},
+		},
+		{
+			name: "dependency required only by unused dependency",
+			teeth: []testTooth{
+				{"example.com/a", nil, tooth.InstallReasonExplicit},
+				{"example.com/b", nil, tooth.InstallReasonDependency},
+				{"example.com/c", []string{"example.com/b"}, tooth.InstallReasonDependency},
+			},
+			want: []string{"example.com/c", "example.com/b"},
+		},
+		{
+			name: "dependency required through another dependency",
+			teeth: []testTooth{
+				{"example.com/a", []string{"example.com/c"}, tooth.InstallReasonExplicit},
+				{"example.com/b", nil, tooth.InstallReasonDependency},
+				{"example.com/c", []string{"example.com/b"}, tooth.InstallReasonDependency},
+			},
+			want: []string{},
+		},
+		{
+			name: "tooth without manifest",
+			teeth: []testTooth{
+				{"example.com/a", nil, ""},
+			},
+			want: []string{},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			setUpWorkspace(t, testCase.teeth)
+
+			got, err := findUnusedDependencies(context.New(context.Config{}, semver.Version{}))
+			if err != nil {
+				t.Fatalf("findUnusedDependencies() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got, testCase.want) {
+				t.Errorf("findUnusedDependencies() = %v, want %v", got, testCase.want)
+			}
+		})
+	}
+}
+
+// setUpWorkspace creates a workspace with the teeth installed, and changes the working
+// directory to it until the test ends.
+func setUpWorkspace(t *testing.T, teeth []testTooth) {
+	workspaceDir := t.TempDir()
+
+	metadataDir := filepath.Join(workspaceDir, ".lip", "metadata")
+	if err := os.MkdirAll(metadataDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, testTooth := range teeth {
+		rawMetadata := tooth.RawMetadata{
+			FormatVersion: 2,
+			Tooth:         testTooth.toothRepoPath,
+			Version:       "1.0.0",
+			Info:          tooth.RawMetadataInfo{Tags: []string{}},
+			Dependencies:  make(map[string]string),
+		}
+		for _, dependency := range testTooth.dependencies {
+			rawMetadata.Dependencies[dependency] = "1.x"
+		}
+
+		writeJSONFile(t, filepath.Join(metadataDir, url.QueryEscape(testTooth.toothRepoPath)+".json"), rawMetadata)
+
+		if testTooth.installReason != "" {
+			writeJSONFile(t, filepath.Join(metadataDir, url.QueryEscape(testTooth.toothRepoPath)+".manifest"),
+				tooth.Manifest{
+					ToothRepoPath: testTooth.toothRepoPath,
+					Version:       "1.0.0",
+					InstallReason: testTooth.installReason,
+					Files:         []tooth.ManifestFile{},
+				})
+		}
+	}
+
+	workingDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chdir(workspaceDir); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		os.Chdir(workingDir)
+	})
+}
+
+func writeJSONFile(t *testing.T, filePath string, v interface{}) {
+	jsonBytes, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filePath, jsonBytes, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,103 @@
+package cmdlipcheck
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/lippkg/lip/internal/context"
+	"github.com/lippkg/lip/internal/install"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type FlagDict struct {
+	helpFlag bool
+	jsonFlag bool
+}
+
+const helpMessage = `
+Usage:
+  lip check [options]
+
+Description:
+  Check that the dependencies and prerequisites of all installed teeth are satisfied by
+  the installed versions and that no installed teeth conflict with each other.
+
+Options:
+  -h, --help                  Show help.
+  --json                      Output in JSON format.
+`
+
+func Run(ctx *context.Context, args []string) error {
+
+	flagSet := flag.NewFlagSet("check", flag.ContinueOnError)
+
+	// Rewrite the default usage message.
+	flagSet.Usage = func() {
+		// Do nothing.
+	}
+
+	var flagDict FlagDict
+	flagSet.BoolVar(&flagDict.helpFlag, "help", false, "")
+	flagSet.BoolVar(&flagDict.helpFlag, "h", false, "")
+	flagSet.BoolVar(&flagDict.jsonFlag, "json", false, "")
+	err := flagSet.Parse(args)
+	if err != nil {
+		return fmt.Errorf("failed to parse flags\n\t%w", err)
+	}
+
+	// Help flag has the highest priority.
+	if flagDict.helpFlag {
+		fmt.Print(helpMessage)
+		return nil
+	}
+
+	// Check if there are unexpected arguments.
+	if flagSet.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments: %v", flagSet.Args())
+	}
+
+	problems, err := install.CheckWorkspace(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check the workspace\n\t%w", err)
+	}
+
+	if err := printProblems(problems, flagDict.jsonFlag); err != nil {
+		return fmt.Errorf("failed to print problems\n\t%w", err)
+	}
+
+	if len(problems) != 0 {
+		return fmt.Errorf("found %v problems in the workspace", len(problems))
+	}
+
+	log.Info("No problems found in the workspace")
+
+	return nil
+}
+
+// ---------------------------------------------------------------------
+
+// printProblems prints the problems one per line or in JSON format.
+func printProblems(problems []install.WorkspaceProblem, jsonFlag bool) error {
+	if jsonFlag {
+		jsonBytes, err := json.Marshal(problems)
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON\n\t%w", err)
+		}
+
+		fmt.Print(string(jsonBytes))
+
+		return nil
+	}
+
+	builder := &strings.Builder{}
+	for _, problem := range problems {
+		builder.WriteString(fmt.Sprintf("%v\n", problem))
+	}
+
+	fmt.Print(builder.String())
+
+	return nil
+}
@@ -2,18 +2,17 @@ package cmdlipinstall
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/blang/semver/v4"
 	"github.com/lippkg/lip/internal/context"
 	"github.com/lippkg/lip/internal/install"
-	"github.com/lippkg/lip/internal/network"
-	"github.com/lippkg/lip/internal/path"
 	"github.com/lippkg/lip/internal/tooth"
 	log "github.com/sirupsen/logrus"
 )
 
 func filterInstalledToothArchives(ctx *context.Context, archives []tooth.Archive, upgradeFlag bool,
-	forceReinstallFlag bool) ([]tooth.Archive, error) {
+	allowDowngradeFlag bool, forceReinstallFlag bool) ([]tooth.Archive, error) {
 
 	if forceReinstallFlag {
 		return archives, nil
@@ -26,18 +25,28 @@ func filterInstalledToothArchives(ctx *context.Context, archives []tooth.Archive
 			return nil, fmt.Errorf("failed to check if tooth is installed\n\t%w", err)
 		}
 
-		if !isInstalled {
+		// Enabling features of the installed version reinstalls it.
+		featuresToEnable, err := getFeaturesToEnable(ctx, archive.Metadata())
+		if err != nil {
+			return nil, err
+		}
+
+		if !isInstalled || len(featuresToEnable) != 0 {
 			filteredArchives = append(filteredArchives, archive)
-		} else if upgradeFlag {
+		} else if upgradeFlag || allowDowngradeFlag {
 			currentMetadata, err := tooth.GetMetadata(ctx, archive.Metadata().ToothRepoPath())
 			if err != nil {
 				return nil, fmt.Errorf("failed to find installed tooth metadata\n\t%w", err)
 			}
 
-			if archive.Metadata().Version().GT(currentMetadata.Version()) {
+			if upgradeFlag && archive.Metadata().Version().GT(currentMetadata.Version()) {
 				filteredArchives = append(filteredArchives, archive)
-			} else {
+			} else if allowDowngradeFlag && archive.Metadata().Version().LT(currentMetadata.Version()) {
+				filteredArchives = append(filteredArchives, archive)
+			} else if upgradeFlag {
 				log.Infof("Tooth %v is already up-to-date", archive.Metadata().ToothRepoPath())
+			} else {
+				log.Infof("Tooth %v is already installed", archive.Metadata().ToothRepoPath())
 			}
 		} else {
 			log.Infof("Tooth %v is already installed", archive.Metadata().ToothRepoPath())
@@ -47,8 +56,13 @@ func filterInstalledToothArchives(ctx *context.Context, archives []tooth.Archive
 	return filteredArchives, nil
 }
 
-// installToothArchive installs the tooth archive.
-func installToothArchive(ctx *context.Context, archive tooth.Archive, forceReinstall bool, upgrade bool, yes bool) error {
+// installToothArchive installs the tooth archive, which must have the asset archive
+// attached. Changes to the workspace are recorded in tx. isSpecified tells whether the
+// tooth is requested by the user rather than pulled in as a dependency, and source is
+// where the archives were downloaded from.
+func installToothArchive(ctx *context.Context, tx *install.Transaction, archive tooth.Archive, isSpecified bool,
+	source tooth.Source, forceReinstall bool, upgrade bool, allowDowngrade bool, yes bool,
+	allowOverwrite bool, ignoreScripts bool) error {
 	debugLogger := log.WithFields(log.Fields{
 		"package": "cmdlipinstall",
 		"method":  "installToothArchive",
@@ -59,6 +73,11 @@ func installToothArchive(ctx *context.Context, archive tooth.Archive, forceReins
 		return fmt.Errorf("failed to check if tooth is installed\n\t%w", err)
 	}
 
+	featuresToEnable, err := getFeaturesToEnable(ctx, archive.Metadata())
+	if err != nil {
+		return err
+	}
+
 	shouldInstall := false
 	shouldUninstall := false
 
@@ -68,16 +87,29 @@ func installToothArchive(ctx *context.Context, archive tooth.Archive, forceReins
 		shouldInstall = true
 		shouldUninstall = true
 
-	} else if isInstalled && upgrade {
+	} else if len(featuresToEnable) != 0 {
+		log.Infof("Enabling features %v of tooth %v", strings.Join(featuresToEnable, ", "),
+			archive.Metadata().ToothRepoPath())
+
+		shouldInstall = true
+		shouldUninstall = true
+
+	} else if isInstalled && (upgrade || allowDowngrade) {
 		currentMetadata, err := tooth.GetMetadata(ctx,
 			archive.Metadata().ToothRepoPath())
 		if err != nil {
 			return fmt.Errorf("failed to find installed tooth metadata\n\t%w", err)
 		}
 
-		if archive.Metadata().Version().GT(currentMetadata.Version()) {
+		if upgrade && archive.Metadata().Version().GT(currentMetadata.Version()) {
 			log.Infof("Upgrading tooth %v", archive.Metadata().ToothRepoPath())
 
+			shouldInstall = true
+			shouldUninstall = true
+		} else if allowDowngrade && archive.Metadata().Version().LT(currentMetadata.Version()) {
+			log.Infof("Downgrading tooth %v from %v to %v", archive.Metadata().ToothRepoPath(),
+				currentMetadata.Version(), archive.Metadata().Version())
+
 			shouldInstall = true
 			shouldUninstall = true
 		} else {
@@ -100,53 +132,35 @@ func installToothArchive(ctx *context.Context, archive tooth.Archive, forceReins
 		shouldUninstall = false
 	}
 
-	if shouldUninstall {
-		err := install.Uninstall(ctx, archive.Metadata().ToothRepoPath())
-		if err != nil {
-			return fmt.Errorf("failed to uninstall tooth\n\t%w", err)
-		}
-		debugLogger.Debugf("Uninstalled tooth %v", archive.Metadata().ToothRepoPath())
+	if !shouldInstall {
+		return nil
 	}
 
-	if shouldInstall {
-		assetURL, err := archive.Metadata().AssetURL()
+	// A tooth installed explicitly stays explicit when replaced as a dependency.
+	installReason := tooth.InstallReasonDependency
+	if isSpecified {
+		installReason = tooth.InstallReasonExplicit
+	} else if isInstalled {
+		installReason, err = tooth.GetInstallReason(ctx, archive.Metadata().ToothRepoPath())
 		if err != nil {
-			return fmt.Errorf("failed to get asset URL\n\t%w", err)
-		}
-
-		assetArchiveFilePath := path.MakeEmpty()
-		if assetURL.String() != "" {
-			gitHubMirrorURL, err := ctx.GitHubMirrorURL()
-			if err != nil {
-				return fmt.Errorf("failed to get GitHub mirror URL\n\t%w", err)
-			}
-
-			mirroredURL := assetURL
-			if network.IsGitHubDirectDownloadURL(assetURL) {
-				// Rewrite GitHub URL to GitHub mirror URL if it is set.
-				mirroredURL, err = network.GenerateGitHubMirrorURL(assetURL, gitHubMirrorURL)
-				if err != nil {
-					return fmt.Errorf("failed to generate GitHub mirror URL\n\t%w", err)
-				}
-			}
-
-			cachePath, err := getCachePath(ctx, mirroredURL)
-			if err != nil {
-				return fmt.Errorf("failed to get cache path of asset URL %v\n\t%w", assetURL, err)
-			}
-
-			assetArchiveFilePath = cachePath
+			return fmt.Errorf("failed to get install reason\n\t%w", err)
 		}
+	}
 
-		archiveWithAssets, err := archive.ToAssetArchiveAttached(assetArchiveFilePath)
-		if err != nil {
-			return fmt.Errorf("failed to attach asset archive %v\n\t%w", assetArchiveFilePath.LocalString(), err)
+	if shouldUninstall {
+		// The installed version is only removed after the new version is staged, and is
+		// restored by rolling back tx if anything goes wrong.
+		if err := install.Upgrade(ctx, tx, archive, installReason, source, yes, allowOverwrite, ignoreScripts); err != nil {
+			return fmt.Errorf("failed to replace installed tooth with tooth archive %v\n\t%w",
+				archive.FilePath().LocalString(), err)
 		}
+		debugLogger.Debugf("Replaced installed tooth with tooth archive %v", archive.FilePath().LocalString())
 
-		if err := install.Install(ctx, archiveWithAssets, yes); err != nil {
-			return fmt.Errorf("failed to install tooth archive %v\n\t%w", archiveWithAssets.FilePath().LocalString(), err)
+	} else {
+		if err := install.Install(ctx, tx, archive, installReason, source, yes, allowOverwrite, ignoreScripts); err != nil {
+			return fmt.Errorf("failed to install tooth archive %v\n\t%w", archive.FilePath().LocalString(), err)
 		}
-		debugLogger.Debugf("Installed tooth archive %v", archiveWithAssets.FilePath().LocalString())
+		debugLogger.Debugf("Installed tooth archive %v", archive.FilePath().LocalString())
 	}
 
 	return nil
@@ -3,8 +3,11 @@ package cmdlipinstall
 import (
 	"flag"
 	"fmt"
+	"strings"
 
 	"github.com/lippkg/lip/internal/context"
+	"github.com/lippkg/lip/internal/install"
+	"github.com/lippkg/lip/internal/prompt"
 	"github.com/lippkg/lip/internal/specifier"
 
 	"github.com/lippkg/lip/internal/tooth"
@@ -14,27 +17,53 @@ import (
 type FlagDict struct {
 	helpFlag           bool
 	upgradeFlag        bool
+	allowDowngradeFlag bool
 	forceReinstallFlag bool
 	yesFlag            bool
 	noDependenciesFlag bool
+	dryRunFlag         bool
+	jsonFlag           bool
+	allowOverwriteFlag bool
+	waitLockFlag       bool
+	requirementsFiles  requirementsFileFlag
+	lockedFlag         bool
+	ignoreScriptsFlag  bool
 }
 
 const helpMessage = `
 Usage:
   lip install [options] <specifier> [...]
+  lip install [options] -r <requirements file> [...]
 
 Description:
   Install teeth from:
 
   - tooth repositories. (e.g. "github.com/tooth-hub/llbds3@3.1.0")
+    The version can also be a version range (e.g. "@1.x", "@^3.1", "@>=3.1.0 <4.0.0")
+    or one of "latest", "latest-pre" and "installed". Optional features can be enabled
+    in brackets (e.g. "github.com/tooth-hub/foo[mysql,redis]@1.x").
   - local tooth archives. (e.g. "./foo.tth")
+  - requirements files, listing one specifier per line. Blank lines and comments
+    starting with "#" are ignored.
 
 Options:
   -h, --help                  Show help.
+  -r, --requirement <file>    Install the teeth listed in the requirements file. Can be repeated.
   --upgrade                   Upgrade the specified tooth to the newest available version.
+  --allow-downgrade           Allow installing a version older than the installed one.
   --force-reinstall           Reinstall the tooth even if they are already up-to-date.
   -y, --yes                   Assume yes to all prompts and run non-interactively.
   --no-dependencies           Do not install dependencies. Also bypass prerequisite checks.
+  --dry-run                   Show what would be done without changing the workspace. Assets are still
+                              downloaded to the cache.
+  --json                      Output the plan of --dry-run in JSON format.
+  --allow-overwrite           Allow overwriting files owned by other installed teeth.
+  --wait-lock                 Wait for other lip processes using the workspace instead of failing.
+  --locked                    Install exactly the teeth in lip.lock of the workspace. Fail if the
+                              hash of any archive differs from lip.lock, or if teeth not in
+                              lip.lock are installed.
+  --ignore-scripts, --no-scripts
+                              Do not run commands in tooth.json.
 `
 
 func Run(ctx *context.Context, args []string) error {
@@ -54,10 +83,20 @@ func Run(ctx *context.Context, args []string) error {
 	flagSet.BoolVar(&flagDict.helpFlag, "help", false, "")
 	flagSet.BoolVar(&flagDict.helpFlag, "h", false, "")
 	flagSet.BoolVar(&flagDict.upgradeFlag, "upgrade", false, "")
+	flagSet.BoolVar(&flagDict.allowDowngradeFlag, "allow-downgrade", false, "")
 	flagSet.BoolVar(&flagDict.forceReinstallFlag, "force-reinstall", false, "")
 	flagSet.BoolVar(&flagDict.yesFlag, "yes", false, "")
 	flagSet.BoolVar(&flagDict.yesFlag, "y", false, "")
 	flagSet.BoolVar(&flagDict.noDependenciesFlag, "no-dependencies", false, "")
+	flagSet.BoolVar(&flagDict.dryRunFlag, "dry-run", false, "")
+	flagSet.BoolVar(&flagDict.jsonFlag, "json", false, "")
+	flagSet.BoolVar(&flagDict.allowOverwriteFlag, "allow-overwrite", false, "")
+	flagSet.BoolVar(&flagDict.waitLockFlag, "wait-lock", false, "")
+	flagSet.Var(&flagDict.requirementsFiles, "requirement", "")
+	flagSet.Var(&flagDict.requirementsFiles, "r", "")
+	flagSet.BoolVar(&flagDict.lockedFlag, "locked", false, "")
+	flagSet.BoolVar(&flagDict.ignoreScriptsFlag, "ignore-scripts", false, "")
+	flagSet.BoolVar(&flagDict.ignoreScriptsFlag, "no-scripts", false, "")
 
 	if err := flagSet.Parse(args); err != nil {
 		return fmt.Errorf("failed to parse flags\n\t%w", err)
@@ -69,16 +108,48 @@ func Run(ctx *context.Context, args []string) error {
 		return nil
 	}
 
-	// At least one specifier is required.
-	if flagSet.NArg() == 0 {
+	// The lockfile replaces specifiers. Otherwise at least one specifier is required.
+	if flagDict.lockedFlag && (flagSet.NArg() != 0 || len(flagDict.requirementsFiles) != 0) {
+		return fmt.Errorf("--locked cannot be used with specifiers or requirements files")
+	} else if !flagDict.lockedFlag && flagSet.NArg() == 0 && len(flagDict.requirementsFiles) == 0 {
 		return fmt.Errorf("at least one specifier is required")
 	}
 
+	// Prevent other lip processes from changing the workspace. A dry run does not
+	// change anything.
+	if !flagDict.dryRunFlag {
+		workspaceLock, err := install.LockWorkspace(ctx, flagDict.waitLockFlag)
+		if err != nil {
+			return err
+		}
+		defer workspaceLock.Release()
+	}
+
 	log.Info("Downloading teeth and resolving dependencies...")
 
-	// Parse specifiers.
+	// Install the locked teeth at the locked versions, whether newer or older than the
+	// installed ones.
+	if flagDict.lockedFlag {
+		lockedArchives, lockedTeeth, err := downloadLockedToothArchives(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to download locked teeth\n\t%w", err)
+		}
+
+		if err := checkInstalledTeethLocked(ctx, lockedTeeth, flagDict.forceReinstallFlag); err != nil {
+			return fmt.Errorf("installed teeth differ from the lockfile\n\t%w", err)
+		}
+
+		flagDict.upgradeFlag = true
+		flagDict.allowDowngradeFlag = true
+
+		return installArchives(ctx, lockedArchives, false, lockedTeeth, flagDict)
+	}
+
+	// Parse specifiers. Those from requirements files are resolved together with those
+	// from arguments as a single batch. Origins tell where each specifier comes from.
 
 	specifiers := make([]specifier.Specifier, 0)
+	specifierOrigins := make([]string, 0)
 	for _, specifierString := range flagSet.Args() {
 		specifier, err := specifier.Parse(specifierString)
 		if err != nil {
@@ -86,6 +157,17 @@ func Run(ctx *context.Context, args []string) error {
 		}
 
 		specifiers = append(specifiers, specifier)
+		specifierOrigins = append(specifierOrigins, "")
+	}
+
+	for _, requirementsFile := range flagDict.requirementsFiles {
+		fileSpecifiers, fileSpecifierOrigins, err := parseRequirementsFile(requirementsFile)
+		if err != nil {
+			return fmt.Errorf("failed to parse requirements file\n\t%w", err)
+		}
+
+		specifiers = append(specifiers, fileSpecifiers...)
+		specifierOrigins = append(specifierOrigins, fileSpecifierOrigins...)
 	}
 
 	debugLogger.Debug("Got specifiers from arguments:")
@@ -95,7 +177,7 @@ func Run(ctx *context.Context, args []string) error {
 
 	// Download remote tooth archives. Then open all specified tooth archives.
 
-	specifiedArchives, err := resolveSpecifiers(ctx, specifiers)
+	specifiedArchives, err := resolveSpecifiers(ctx, specifiers, specifierOrigins)
 	if err != nil {
 		return fmt.Errorf("failed to parse and download specifier string list\n\t%w", err)
 	}
@@ -105,12 +187,35 @@ func Run(ctx *context.Context, args []string) error {
 		debugLogger.Debugf("  %v@%v: %v", archive.Metadata().ToothRepoPath(), archive.Metadata().Version(), archive.FilePath().LocalString())
 	}
 
+	return installArchives(ctx, specifiedArchives, true, nil, flagDict)
+}
+
+// installArchives resolves the dependencies of the specified tooth archives and
+// installs them all in one transaction. If specifiedAreExplicit is true, the specified
+// teeth are recorded as explicitly installed. Otherwise every tooth keeps its install
+// reason, and teeth newly pulled in are recorded as dependencies. If lockedTeeth is not
+// nil, the specified archives are the locked teeth, which keep the install reasons in the
+// lockfile, and their asset archives must match the lockfile.
+func installArchives(ctx *context.Context, specifiedArchives []tooth.Archive, specifiedAreExplicit bool,
+	lockedTeeth map[string]tooth.LockedTooth, flagDict FlagDict) error {
+	debugLogger := log.WithFields(log.Fields{
+		"package": "cmdlipinstall",
+		"method":  "installArchives",
+	})
+
+	// Installed teeth replaced by the specified teeth are uninstalled before installing.
+
+	replacedTeeth, err := getReplacedTeeth(ctx, specifiedArchives)
+	if err != nil {
+		return fmt.Errorf("failed to find replaced teeth\n\t%w", err)
+	}
+
 	// Resolve dependencies and check prerequisites.
 
 	archivesToInstall := specifiedArchives
 	if !flagDict.noDependenciesFlag {
-		archives, err := resolveDependencies(ctx, specifiedArchives, flagDict.upgradeFlag,
-			flagDict.forceReinstallFlag)
+		archives, err := resolveDependencies(ctx, specifiedArchives, replacedTeeth, flagDict.upgradeFlag,
+			flagDict.allowDowngradeFlag, flagDict.forceReinstallFlag)
 		if err != nil {
 			return fmt.Errorf("failed to resolve dependencies\n\t%w", err)
 		}
@@ -122,7 +227,13 @@ func Run(ctx *context.Context, args []string) error {
 			debugLogger.Debugf("  %v@%v: %v", archive.Metadata().ToothRepoPath(), archive.Metadata().Version(), archive.FilePath().LocalString())
 		}
 
-		_, missingPrerequisites, err := getMissingPrerequisites(ctx, archivesToInstall)
+		// Installed teeth not being replaced must still accept the versions of their
+		// dependencies.
+		if err := checkInstalledDependents(ctx, archivesToInstall, replacedTeeth); err != nil {
+			return fmt.Errorf("failed to check installed dependents\n\t%w", err)
+		}
+
+		_, missingPrerequisites, err := getMissingPrerequisites(ctx, archivesToInstall, replacedTeeth)
 		if err != nil {
 			return fmt.Errorf("failed to find missing prerequisites\n\t%w", err)
 		}
@@ -136,10 +247,14 @@ func Run(ctx *context.Context, args []string) error {
 		}
 	}
 
+	if err := checkConflicts(ctx, archivesToInstall, replacedTeeth); err != nil {
+		return fmt.Errorf("failed to check conflicts\n\t%w", err)
+	}
+
 	// Filter installed teeth.
 
 	filteredArchives, err := filterInstalledToothArchives(ctx, archivesToInstall, flagDict.upgradeFlag,
-		flagDict.forceReinstallFlag)
+		flagDict.allowDowngradeFlag, flagDict.forceReinstallFlag)
 	if err != nil {
 		return fmt.Errorf("failed to filter installed teeth\n\t%w", err)
 	}
@@ -149,54 +264,229 @@ func Run(ctx *context.Context, args []string) error {
 		debugLogger.Debugf("  %v@%v: %v", archive.Metadata().ToothRepoPath(), archive.Metadata().Version(), archive.FilePath().LocalString())
 	}
 
-	// Download tooth assets if necessary.
+	// Download tooth assets if necessary and attach them to the tooth archives. The
+	// sources of the archives are recorded in the manifests and the lockfile.
 
-	for _, archive := range filteredArchives {
-		if err := downloadToothAssetArchiveIfNotCached(ctx, archive); err != nil {
-			return fmt.Errorf("failed to download tooth assets\n\t%w", err)
+	archivesWithAssets := make([]tooth.Archive, len(filteredArchives))
+	sources := make([]tooth.Source, len(filteredArchives))
+	err = runConcurrently(ctx, len(filteredArchives), func(i int) error {
+		archiveWithAssets, source, err := downloadAndAttachAssetArchive(ctx, filteredArchives[i], lockedTeeth)
+		if err != nil {
+			return fmt.Errorf("failed to download assets of %v\n\t%w", filteredArchives[i].Metadata().ToothRepoPath(),
+				err)
+		}
+
+		archivesWithAssets[i] = archiveWithAssets
+		sources[i] = source
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to download tooth assets\n\t%w", err)
+	}
+
+	// Print the plan and exit if it is a dry run.
+
+	if flagDict.dryRunFlag {
+		plan, err := makePlan(ctx, archivesWithAssets, replacedTeeth, flagDict.ignoreScriptsFlag)
+		if err != nil {
+			return fmt.Errorf("failed to make plan\n\t%w", err)
+		}
+
+		if err := printPlan(plan, flagDict.jsonFlag); err != nil {
+			return fmt.Errorf("failed to print plan\n\t%w", err)
+		}
+
+		return nil
+	}
+
+	// Check file conflicts before changing anything.
+
+	for _, archiveWithAssets := range archivesWithAssets {
+		if err := install.CheckFileConflicts(ctx, archiveWithAssets.Metadata(), flagDict.allowOverwriteFlag); err != nil {
+			return fmt.Errorf("failed to check file conflicts, use --allow-overwrite to overwrite\n\t%w", err)
+		}
+	}
+
+	// Collect the commands to run so that they can be reviewed and approved.
+
+	hookCommands := make([]install.HookCommand, 0)
+	if !flagDict.ignoreScriptsFlag {
+		hookCommands, err = getHookCommands(ctx, archivesWithAssets, replacedTeeth)
+		if err != nil {
+			return fmt.Errorf("failed to get hook commands\n\t%w", err)
 		}
 	}
 
 	// Ask for confirmation.
 
 	if !flagDict.yesFlag {
-		err := askForConfirmation(ctx, filteredArchives)
+		err := askForConfirmation(ctx, filteredArchives, replacedTeeth, hookCommands)
 		if err != nil {
 			return err
 		}
 	}
 
-	// Install teeth.
+	if err := install.ApproveHookCommands(ctx, hookCommands, flagDict.yesFlag); err != nil {
+		return fmt.Errorf("failed to approve hook commands\n\t%w", err)
+	}
+
+	// Install teeth. If any of them fails, roll back all changes made to the workspace.
 
 	log.Info("Installing teeth...")
 
-	for _, archive := range filteredArchives {
-		if err := installToothArchive(ctx, archive, flagDict.forceReinstallFlag, flagDict.upgradeFlag, flagDict.yesFlag); err != nil {
+	tx, err := install.NewTransaction(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction\n\t%w", err)
+	}
+
+	isSpecified := make(map[string]bool)
+	if lockedTeeth != nil {
+		for toothRepoPath, lockedTooth := range lockedTeeth {
+			if lockedTooth.InstallReason == tooth.InstallReasonExplicit {
+				isSpecified[toothRepoPath] = true
+			}
+		}
+	} else if specifiedAreExplicit {
+		for _, archive := range specifiedArchives {
+			isSpecified[archive.Metadata().ToothRepoPath()] = true
+		}
+	}
+
+	for _, replacedTooth := range replacedTeeth {
+		log.Infof("Uninstalling replaced tooth %v", replacedTooth)
+
+		if err := install.Uninstall(ctx, tx, replacedTooth, flagDict.ignoreScriptsFlag); err != nil {
+			tx.RollbackAndLog()
+			return fmt.Errorf("failed to uninstall replaced tooth %v\n\t%w", replacedTooth, err)
+		}
+	}
+
+	for i, archive := range archivesWithAssets {
+		if err := installToothArchive(ctx, tx, archive, isSpecified[archive.Metadata().ToothRepoPath()],
+			sources[i], flagDict.forceReinstallFlag, flagDict.upgradeFlag, flagDict.allowDowngradeFlag, flagDict.yesFlag,
+			flagDict.allowOverwriteFlag, flagDict.ignoreScriptsFlag); err != nil {
+			tx.RollbackAndLog()
 			return fmt.Errorf("failed to install tooth archive %v\n\t%w", archive.FilePath().LocalString(), err)
 		}
 	}
 
+	// Teeth installed as dependencies before are now requested by the user.
+	for toothRepoPath := range isSpecified {
+		if err := install.MarkAsExplicit(ctx, tx, toothRepoPath); err != nil {
+			tx.RollbackAndLog()
+			return fmt.Errorf("failed to mark tooth %v as explicitly installed\n\t%w", toothRepoPath, err)
+		}
+	}
+
+	if err := install.SaveLockFile(ctx, tx); err != nil {
+		tx.RollbackAndLog()
+		return fmt.Errorf("failed to save lockfile\n\t%w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction\n\t%w", err)
+	}
+
+	install.WarnWorkspaceProblems(ctx)
+
 	log.Info("Done.")
 
 	return nil
 }
 
-// askForConfirmation asks for confirmation before installing the tooth.
+// getHookCommands returns the commands to run when uninstalling the replaced teeth and
+// installing the tooth archives.
+func getHookCommands(ctx *context.Context, archives []tooth.Archive, replacedTeeth []string) (
+	[]install.HookCommand, error) {
+
+	hookCommands, err := install.GetTeethUninstallHookCommands(ctx, replacedTeeth)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, archive := range archives {
+		installHookCommands, err := install.GetInstallHookCommands(ctx, archive.Metadata())
+		if err != nil {
+			return nil, err
+		}
+
+		hookCommands = append(hookCommands, installHookCommands...)
+	}
+
+	return hookCommands, nil
+}
+
+// askForConfirmation asks for confirmation before installing the tooth, listing the hook
+// commands to run.
 func askForConfirmation(ctx *context.Context,
-	archiveList []tooth.Archive) error {
+	archiveList []tooth.Archive, replacedTeeth []string, hookCommands []install.HookCommand) error {
+
+	if len(replacedTeeth) != 0 {
+		log.Info("The following teeth will be replaced and uninstalled:")
+		for _, replacedTooth := range replacedTeeth {
+			metadata, err := tooth.GetMetadata(ctx, replacedTooth)
+			if err != nil {
+				return fmt.Errorf("failed to find installed tooth metadata\n\t%w", err)
+			}
+
+			log.Infof("  %v@%v: %v", replacedTooth, metadata.Version(), metadata.Info().Name)
+		}
+	}
 
-	// Print the list of teeth to be installed.
+	// Print the list of teeth to be installed, labelling those replacing installed versions.
 	log.Info("The following teeth will be installed:")
+	hasDowngrade := false
 	for _, archive := range archiveList {
-		log.Infof("  %v@%v: %v", archive.Metadata().ToothRepoPath(), archive.Metadata().Version(),
-			archive.Metadata().Info().Name)
+		label := ""
+
+		isInstalled, err := tooth.IsInstalled(ctx, archive.Metadata().ToothRepoPath())
+		if err != nil {
+			return fmt.Errorf("failed to check if tooth is installed\n\t%w", err)
+		}
+
+		if isInstalled {
+			currentMetadata, err := tooth.GetMetadata(ctx, archive.Metadata().ToothRepoPath())
+			if err != nil {
+				return fmt.Errorf("failed to find installed tooth metadata\n\t%w", err)
+			}
+
+			featuresToEnable, err := getFeaturesToEnable(ctx, archive.Metadata())
+			if err != nil {
+				return err
+			}
+
+			if archive.Metadata().Version().GT(currentMetadata.Version()) {
+				label = fmt.Sprintf(" (upgrade from %v)", currentMetadata.Version())
+			} else if archive.Metadata().Version().LT(currentMetadata.Version()) {
+				label = fmt.Sprintf(" (downgrade from %v)", currentMetadata.Version())
+				hasDowngrade = true
+			} else if len(featuresToEnable) != 0 {
+				label = fmt.Sprintf(" (enable %v)", strings.Join(featuresToEnable, ", "))
+			} else {
+				label = " (reinstall)"
+			}
+		}
+
+		features := ""
+		if len(archive.Metadata().EnabledFeatures()) != 0 {
+			features = "[" + strings.Join(archive.Metadata().EnabledFeatures(), ",") + "]"
+		}
+
+		log.Infof("  %v%v@%v: %v%v", archive.Metadata().ToothRepoPath(), features, archive.Metadata().Version(),
+			archive.Metadata().Info().Name, label)
+	}
+
+	install.LogHookCommands(hookCommands)
+
+	if hasDowngrade {
+		log.Warn("Some teeth will be downgraded. Data written by newer versions might not be compatible.")
 	}
 
 	// Ask for confirmation.
-	log.Info("Do you want to continue? [y/N]")
-	var ans string
-	fmt.Scanln(&ans)
-	if ans != "y" && ans != "Y" {
+	if ok, err := prompt.Confirm(ctx, "Do you want to continue?"); err != nil {
+		return err
+	} else if !ok {
 		return fmt.Errorf("aborted")
 	}
 
@@ -0,0 +1,40 @@
+package cmdlipinstall
+
+import (
+	"sync"
+
+	"github.com/lippkg/lip/internal/context"
+)
+
+// runConcurrently calls f with each index in [0, n), running at most
+// ctx.MaxConcurrentDownloads() calls at a time. If any call fails, the error of the
+// call with the smallest index is returned so that the result does not depend on
+// scheduling.
+func runConcurrently(ctx *context.Context, n int, f func(i int) error) error {
+	errs := make([]error, n)
+
+	semaphore := make(chan struct{}, ctx.MaxConcurrentDownloads())
+	var waitGroup sync.WaitGroup
+
+	for i := 0; i < n; i++ {
+		semaphore <- struct{}{}
+		waitGroup.Add(1)
+
+		go func(i int) {
+			defer waitGroup.Done()
+			defer func() { <-semaphore }()
+
+			errs[i] = f(i)
+		}(i)
+	}
+
+	waitGroup.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
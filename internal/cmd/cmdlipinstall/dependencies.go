@@ -1,19 +1,23 @@
 package cmdlipinstall
 
 import (
-	"container/list"
 	"fmt"
+	"sort"
+	"strings"
 
-	"github.com/blang/semver/v4"
 	"github.com/lippkg/lip/internal/context"
 	"github.com/lippkg/lip/internal/tooth"
 	log "github.com/sirupsen/logrus"
 )
 
-func getFixedToothAndVersionMap(ctx *context.Context, specifiedArchives []tooth.Archive, upgradeFlag bool,
-	forceReinstallFlag bool) (map[string]semver.Version, error) {
+// getFixedToothAndMetadataMap returns the metadata of the teeth keeping their versions
+// when resolving dependencies, i.e. the installed teeth not to be replaced and the
+// specified teeth.
+func getFixedToothAndMetadataMap(ctx *context.Context, specifiedArchives []tooth.Archive,
+	replacedTeeth []string, upgradeFlag bool, allowDowngradeFlag bool,
+	forceReinstallFlag bool) (map[string]tooth.Metadata, error) {
 
-	fixedTeethAndVersions := make(map[string]semver.Version)
+	fixedTeethAndMetadata := make(map[string]tooth.Metadata)
 
 	installedToothMetadataList, err := tooth.GetAllMetadata(ctx)
 	if err != nil {
@@ -21,102 +25,162 @@ func getFixedToothAndVersionMap(ctx *context.Context, specifiedArchives []tooth.
 	}
 
 	for _, installedToothMetadata := range installedToothMetadataList {
-		fixedTeethAndVersions[installedToothMetadata.ToothRepoPath()] = installedToothMetadata.Version()
+		fixedTeethAndMetadata[installedToothMetadata.ToothRepoPath()] = installedToothMetadata
+	}
+
+	for _, replacedTooth := range replacedTeeth {
+		delete(fixedTeethAndMetadata, replacedTooth)
 	}
 
 	for _, archive := range specifiedArchives {
-		if fixedVersion, ok := fixedTeethAndVersions[archive.Metadata().ToothRepoPath()]; !ok {
+		featuresToEnable, err := getFeaturesToEnable(ctx, archive.Metadata())
+		if err != nil {
+			return nil, err
+		}
+
+		if fixedMetadata, ok := fixedTeethAndMetadata[archive.Metadata().ToothRepoPath()]; !ok {
 			// If not installed, fix it.
-			fixedTeethAndVersions[archive.Metadata().ToothRepoPath()] = archive.Metadata().Version()
+			fixedTeethAndMetadata[archive.Metadata().ToothRepoPath()] = archive.Metadata()
 
 		} else if forceReinstallFlag {
 			// If to force reinstall, fix it.
-			fixedTeethAndVersions[archive.Metadata().ToothRepoPath()] = archive.Metadata().Version()
+			fixedTeethAndMetadata[archive.Metadata().ToothRepoPath()] = archive.Metadata()
 
-		} else if upgradeFlag &&
-			archive.Metadata().Version().GT(fixedTeethAndVersions[archive.Metadata().ToothRepoPath()]) {
+		} else if upgradeFlag && archive.Metadata().Version().GT(fixedMetadata.Version()) {
 			// If to upgrade and the version is newer, fix it.
-			fixedTeethAndVersions[archive.Metadata().ToothRepoPath()] = archive.Metadata().Version()
+			fixedTeethAndMetadata[archive.Metadata().ToothRepoPath()] = archive.Metadata()
+
+		} else if allowDowngradeFlag && archive.Metadata().Version().LT(fixedMetadata.Version()) {
+			// If to allow downgrading and the version is older, fix it.
+			fixedTeethAndMetadata[archive.Metadata().ToothRepoPath()] = archive.Metadata()
 
-		} else if fixedVersion.NE(archive.Metadata().Version()) {
+		} else if len(featuresToEnable) != 0 {
+			// If to enable features of the installed version, fix it.
+			fixedTeethAndMetadata[archive.Metadata().ToothRepoPath()] = archive.Metadata()
+
+		} else if fixedMetadata.Version().NE(archive.Metadata().Version()) {
 			return nil, fmt.Errorf(
-				"trying to fix tooth %v with version %v, but found version %v fixed",
-				archive.Metadata().ToothRepoPath(), archive.Metadata().Version(), fixedVersion)
+				"trying to fix tooth %v with version %v, but found version %v fixed, use --upgrade, --allow-downgrade or --force-reinstall to change it",
+				archive.Metadata().ToothRepoPath(), archive.Metadata().Version(), fixedMetadata.Version())
 		}
 	}
 
-	return fixedTeethAndVersions, nil
+	return fixedTeethAndMetadata, nil
 }
 
-// resolveDependencies resolves the dependencies of the tooth specified by the
-// specifier and returns the paths to the downloaded teeth. rootArchiveList
-// contains the root tooth archives to resolve dependencies.
-// The first return value indicates whether the dependencies are resolved.
-func resolveDependencies(ctx *context.Context, rootArchiveList []tooth.Archive,
-	upgradeFlag bool, forceReinstallFlag bool) ([]tooth.Archive, error) {
-	debugLogger := log.WithFields(log.Fields{
-		"package": "cmdlipinstall",
-		"method":  "resolveDependencies",
-	})
+// checkInstalledDependents checks that the installed teeth not replaced by the tooth
+// archives still get their dependencies in the required version ranges, either from the
+// dependencies themselves or from teeth providing them, after the archives are installed
+// and replacedTeeth are uninstalled. Dependencies unsatisfied already are ignored.
+func checkInstalledDependents(ctx *context.Context, archives []tooth.Archive, replacedTeeth []string) error {
+	newMetadata := make(map[string]tooth.Metadata)
+	for _, archive := range archives {
+		newMetadata[archive.Metadata().ToothRepoPath()] = archive.Metadata()
+	}
 
-	fixedToothAndVersionMap, err := getFixedToothAndVersionMap(ctx, rootArchiveList, upgradeFlag,
-		forceReinstallFlag)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get fixed tooth and version map\n\t%w", err)
+	isReplaced := make(map[string]bool)
+	for _, replacedTooth := range replacedTeeth {
+		isReplaced[replacedTooth] = true
 	}
 
-	notResolvedArchiveQueue := list.New()
-	for _, rootArchive := range rootArchiveList {
-		notResolvedArchiveQueue.PushBack(rootArchive)
+	metadataList, err := tooth.GetAllMetadata(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get all installed tooth metadata\n\t%w", err)
 	}
 
-	resolvedArchiveList := make([]tooth.Archive, 0)
+	resultingMetadataList, err := getResultingMetadataList(ctx, archives, replacedTeeth)
+	if err != nil {
+		return err
+	}
 
-	for notResolvedArchiveQueue.Len() > 0 {
-		archive := notResolvedArchiveQueue.Front().Value.(tooth.Archive)
-		notResolvedArchiveQueue.Remove(notResolvedArchiveQueue.Front())
+	unsatisfiedMessages := make([]string, 0)
+	for _, metadata := range metadataList {
+		if _, ok := newMetadata[metadata.ToothRepoPath()]; ok || isReplaced[metadata.ToothRepoPath()] {
+			continue
+		}
 
-		depMap, err := archive.Metadata().Dependencies()
+		depMap, err := metadata.Dependencies()
 		if err != nil {
-			return nil, fmt.Errorf("failed to get dependencies of %v\n\t%w", archive.FilePath().LocalString(), err)
+			return fmt.Errorf("failed to get dependencies of %v\n\t%w", metadata.ToothRepoPath(), err)
 		}
 
-		depStrMap := archive.Metadata().DependenciesAsStrings()
+		depStrMap := metadata.DependenciesAsStrings()
 
-		for dep, versionRange := range depMap {
-			if fixedVersion, ok := fixedToothAndVersionMap[dep]; ok {
-				if !versionRange(fixedToothAndVersionMap[dep]) {
-					return nil, fmt.Errorf("fixed tooth %v of version %v does not satisfy the version range %v",
-						dep, fixedVersion.String(), depStrMap[dep])
-				}
+		deps := make([]string, 0, len(depMap))
+		for dep := range depMap {
+			deps = append(deps, dep)
+		}
+		sort.Strings(deps)
 
-				// Avoid downloading the same tooth multiple times.
-				debugLogger.Debugf("Dependency %v@%v is already fixed, skip", dep, fixedVersion)
-				continue
+		for _, dep := range deps {
+			_, wasSatisfied, err := tooth.FindSatisfyingTooth(metadataList, dep, depMap[dep])
+			if err != nil {
+				return err
 			}
 
-			targetVersion, err := tooth.GetLatestVersionInVersionRange(ctx, dep, versionRange)
+			_, isSatisfied, err := tooth.FindSatisfyingTooth(resultingMetadataList, dep, depMap[dep])
 			if err != nil {
-				return nil, fmt.Errorf("no available version in %v found for dependency %v", depStrMap[dep], dep)
+				return err
 			}
 
-			debugLogger.Debugf("Dependency %v of range %v is resolved to version %v", dep, depStrMap[dep], targetVersion)
+			if !wasSatisfied || isSatisfied {
+				continue
+			}
 
-			currentArchive, err := downloadToothArchiveIfNotCached(ctx, dep, targetVersion)
-			if err != nil {
-				return nil, fmt.Errorf("failed to download tooth\n\t%w", err)
+			if newDepMetadata, ok := newMetadata[dep]; ok {
+				unsatisfiedMessages = append(unsatisfiedMessages, fmt.Sprintf(
+					"installed tooth %v requires %v in %v, but version %v is to be installed",
+					metadata.ToothRepoPath(), dep, depStrMap[dep], newDepMetadata.Version()))
+			} else {
+				unsatisfiedMessages = append(unsatisfiedMessages, fmt.Sprintf(
+					"installed tooth %v requires %v in %v, but no tooth would satisfy it after replacing %v",
+					metadata.ToothRepoPath(), dep, depStrMap[dep], strings.Join(replacedTeeth, ", ")))
 			}
+		}
+	}
 
-			debugLogger.Debugf("Downloaded tooth archive %v", currentArchive.FilePath().LocalString())
+	if len(unsatisfiedMessages) != 0 {
+		return fmt.Errorf("%v", strings.Join(unsatisfiedMessages, "\n\t"))
+	}
 
-			notResolvedArchiveQueue.PushBack(currentArchive)
+	return nil
+}
 
-			fixedToothAndVersionMap[dep] = targetVersion
-		}
+// resolveDependencies resolves the dependencies of the root tooth archives and returns
+// all tooth archives to install, topologically sorted. Installed teeth other than
+// replacedTeeth and the root teeth keep their versions, and the other dependencies are resolved to the newest versions
+// satisfying all version ranges, trying older versions if newer ones conflict.
+func resolveDependencies(ctx *context.Context, rootArchiveList []tooth.Archive, replacedTeeth []string,
+	upgradeFlag bool, allowDowngradeFlag bool, forceReinstallFlag bool) ([]tooth.Archive, error) {
+	debugLogger := log.WithFields(log.Fields{
+		"package": "cmdlipinstall",
+		"method":  "resolveDependencies",
+	})
+
+	fixedToothAndMetadataMap, err := getFixedToothAndMetadataMap(ctx, rootArchiveList, replacedTeeth, upgradeFlag,
+		allowDowngradeFlag, forceReinstallFlag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fixed tooth and metadata map\n\t%w", err)
+	}
+
+	// Tell in explanations why each fixed tooth has its version.
+	fixedReasons := make(map[string]string)
+	for toothRepoPath := range fixedToothAndMetadataMap {
+		fixedReasons[toothRepoPath] = "installed"
+	}
+	for _, archive := range rootArchiveList {
+		fixedReasons[archive.Metadata().ToothRepoPath()] = "specified"
+	}
+
+	resolver := newDependencyResolver(ctx, fixedToothAndMetadataMap, fixedReasons)
 
-		resolvedArchiveList = append(resolvedArchiveList, archive)
+	depArchiveList, err := resolver.resolve(rootArchiveList)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find versions satisfying all dependencies\n\t%w", err)
 	}
 
+	resolvedArchiveList := append(append([]tooth.Archive{}, rootArchiveList...), depArchiveList...)
+
 	sortedArchives, err := topoSortToothArchives(resolvedArchiveList)
 	if err != nil {
 		return nil, fmt.Errorf("failed to sort teeth\n\t%w", err)
@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"sync"
 
 	"github.com/blang/semver/v4"
 	"github.com/lippkg/lip/internal/context"
+	"github.com/lippkg/lip/internal/lock"
 	"github.com/lippkg/lip/internal/network"
 	"github.com/lippkg/lip/internal/path"
 	"github.com/lippkg/lip/internal/tooth"
@@ -14,6 +16,9 @@ import (
 	"golang.org/x/mod/module"
 )
 
+// cacheEntryMutexes maps cache paths to the mutexes guarding them.
+var cacheEntryMutexes sync.Map
+
 func downloadFileIfNotCached(ctx *context.Context, downloadURL *url.URL) (path.Path, error) {
 	debugLogger := log.WithFields(log.Fields{
 		"package": "cmdlipinstall",
@@ -25,8 +30,29 @@ func downloadFileIfNotCached(ctx *context.Context, downloadURL *url.URL) (path.P
 		return path.Path{}, fmt.Errorf("failed to get cache path of %v\n\t%w", downloadURL, err)
 	}
 
+	// Prevent concurrent downloads of the same file in this process.
+	cacheEntryMutex, _ := cacheEntryMutexes.LoadOrStore(cachePath.String(), &sync.Mutex{})
+	cacheEntryMutex.(*sync.Mutex).Lock()
+	defer cacheEntryMutex.(*sync.Mutex).Unlock()
+
+	// Prevent other lip processes from downloading the same file at the same time. Lock
+	// files and partial downloads are hidden files so that they never collide with
+	// cache entries.
+	cacheDir, err := cachePath.Dir()
+	if err != nil {
+		return path.Path{}, fmt.Errorf("failed to get cache directory\n\t%w", err)
+	}
+
+	cacheEntryLock, err := lock.Acquire(ctx.GoContext(), cacheDir.Join(path.MustParse("."+cachePath.Base()+".lock")),
+		true)
+	if err != nil {
+		return path.Path{}, fmt.Errorf("failed to lock cache entry %v\n\t%w", cachePath.LocalString(), err)
+	}
+	defer cacheEntryLock.ReleaseAndRemove()
+
 	// Skip downloading if the file is already in the cache.
 	if _, err := os.Stat(cachePath.LocalString()); os.IsNotExist(err) {
+		network.ClearProgressBar()
 		log.Infof("Downloading %v", downloadURL)
 
 		var enableProgressBar bool
@@ -42,10 +68,19 @@ func downloadFileIfNotCached(ctx *context.Context, downloadURL *url.URL) (path.P
 			return path.Path{}, fmt.Errorf("failed to get proxy URL\n\t%w", err)
 		}
 
-		if err := network.DownloadFile(downloadURL, proxyURL, cachePath, enableProgressBar); err != nil {
+		// Download to a temporary file first so that an interrupted download is never
+		// taken as cached.
+		downloadPath := cacheDir.Join(path.MustParse("." + cachePath.Base() + ".download"))
+
+		if err := network.DownloadFile(ctx.GoContext(), downloadURL, proxyURL, downloadPath, enableProgressBar); err != nil {
+			os.Remove(downloadPath.LocalString())
 			return path.Path{}, fmt.Errorf("failed to download file\n\t%w", err)
 		}
 
+		if err := os.Rename(downloadPath.LocalString(), cachePath.LocalString()); err != nil {
+			return path.Path{}, fmt.Errorf("failed to move downloaded file to the cache\n\t%w", err)
+		}
+
 	} else if err != nil {
 		return path.Path{}, fmt.Errorf("failed to check if file exists\n\t%w", err)
 	} else {
@@ -95,22 +130,22 @@ func downloadToothArchiveIfNotCached(ctx *context.Context, toothRepoPath string,
 	return archive, nil
 }
 
-func downloadToothAssetArchiveIfNotCached(ctx *context.Context, archive tooth.Archive) error {
-	metadata := archive.Metadata()
+// getAssetDownloadURL returns the URL to download the asset archive of the tooth from.
+// GitHub URLs are rewritten to the GitHub mirror and Go module paths to the Go module
+// proxy. The returned URL is empty if the tooth has no asset URL.
+func getAssetDownloadURL(ctx *context.Context, metadata tooth.Metadata) (*url.URL, error) {
 	assetURL, err := metadata.AssetURL()
 	if err != nil {
-		return fmt.Errorf("failed to get asset URL\n\t%w", err)
+		return nil, fmt.Errorf("failed to get asset URL\n\t%w", err)
 	}
 
 	if assetURL.String() == "" {
-		return nil
+		return assetURL, nil
 	}
 
-	// Rewrite GitHub URL to GitHub mirror URL if it is set.
-
 	gitHubMirrorURL, err := ctx.GitHubMirrorURL()
 	if err != nil {
-		return fmt.Errorf("failed to get GitHub mirror URL\n\t%w", err)
+		return nil, fmt.Errorf("failed to get GitHub mirror URL\n\t%w", err)
 	}
 
 	if network.IsGitHubDirectDownloadURL(assetURL) {
@@ -118,42 +153,60 @@ func downloadToothAssetArchiveIfNotCached(ctx *context.Context, archive tooth.Ar
 
 		mirroredURL, err := network.GenerateGitHubMirrorURL(assetURL, gitHubMirrorURL)
 		if err != nil {
-			return fmt.Errorf("failed to generate GitHub mirror URL\n\t%w", err)
+			return nil, fmt.Errorf("failed to generate GitHub mirror URL\n\t%w", err)
 		}
 
-		if _, err := downloadFileIfNotCached(ctx, mirroredURL); err != nil {
-			return fmt.Errorf("failed to download file\n\t%w", err)
-		}
+		return mirroredURL, nil
 
 	} else if assetURL.Scheme == "http" || assetURL.Scheme == "https" {
 		// Other HTTP or HTTPS URL.
 
-		if _, err := downloadFileIfNotCached(ctx, assetURL); err != nil {
-			return fmt.Errorf("failed to download file\n\t%w", err)
-		}
+		return assetURL, nil
 
 	} else if err := module.CheckPath(assetURL.String()); err == nil {
 		// Go module path.
 
 		goModuleProxyURL, err := ctx.GoModuleProxyURL()
 		if err != nil {
-			return fmt.Errorf("failed to get Go module proxy URL\n\t%w", err)
+			return nil, fmt.Errorf("failed to get Go module proxy URL\n\t%w", err)
 		}
 
-		downloadURL, err := network.GenerateGoModuleZipFileURL(assetURL.String(), archive.Metadata().Version(), goModuleProxyURL)
+		downloadURL, err := network.GenerateGoModuleZipFileURL(assetURL.String(), metadata.Version(), goModuleProxyURL)
 		if err != nil {
-			return fmt.Errorf("failed to generate Go module zip file URL\n\t%w", err)
+			return nil, fmt.Errorf("failed to generate Go module zip file URL\n\t%w", err)
 		}
 
-		if _, err := downloadFileIfNotCached(ctx, downloadURL); err != nil {
-			return fmt.Errorf("failed to download file\n\t%w", err)
-		}
+		return downloadURL, nil
 
 	} else {
-		return fmt.Errorf("unsupported asset URL: %v", assetURL)
+		return nil, fmt.Errorf("unsupported asset URL: %v", assetURL)
+	}
+}
+
+// downloadToothAssetArchiveIfNotCached downloads the asset archive of the tooth from
+// assetDownloadURL if it is not cached, and returns the tooth archive with the asset
+// archive attached. If assetDownloadURL is empty, the tooth archive itself will be used
+// as the asset archive.
+func downloadToothAssetArchiveIfNotCached(ctx *context.Context, archive tooth.Archive,
+	assetDownloadURL *url.URL) (tooth.Archive, error) {
+
+	assetArchiveFilePath := path.MakeEmpty()
+	if assetDownloadURL.String() != "" {
+		cachePath, err := downloadFileIfNotCached(ctx, assetDownloadURL)
+		if err != nil {
+			return tooth.Archive{}, fmt.Errorf("failed to download file\n\t%w", err)
+		}
+
+		assetArchiveFilePath = cachePath
+	}
+
+	archiveWithAssets, err := archive.ToAssetArchiveAttached(assetArchiveFilePath)
+	if err != nil {
+		return tooth.Archive{}, fmt.Errorf("failed to attach asset archive %v\n\t%w",
+			assetArchiveFilePath.LocalString(), err)
 	}
 
-	return nil
+	return archiveWithAssets, nil
 }
 
 func getCachePath(ctx *context.Context, u *url.URL) (path.Path, error) {
@@ -0,0 +1,82 @@
+package cmdlipinstall
+
+import (
+	"fmt"
+
+	"github.com/lippkg/lip/internal/context"
+	"github.com/lippkg/lip/internal/tooth"
+	log "github.com/sirupsen/logrus"
+)
+
+// enableFeatures returns the archive with the given features enabled, together with the
+// features enabled in the installed version of the tooth, so that reinstalling or
+// upgrading a tooth keeps its features. Installed features no longer declared by the
+// archive are dropped with a warning.
+func enableFeatures(ctx *context.Context, archive tooth.Archive, features []string) (tooth.Archive, error) {
+	toothRepoPath := archive.Metadata().ToothRepoPath()
+
+	isInstalled, err := tooth.IsInstalled(ctx, toothRepoPath)
+	if err != nil {
+		return tooth.Archive{}, fmt.Errorf("failed to check if tooth is installed\n\t%w", err)
+	}
+
+	enabledFeatures := append([]string{}, features...)
+
+	if isInstalled {
+		currentMetadata, err := tooth.GetMetadata(ctx, toothRepoPath)
+		if err != nil {
+			return tooth.Archive{}, fmt.Errorf("failed to find installed tooth metadata\n\t%w", err)
+		}
+
+		declaredFeatures := archive.Metadata().Features()
+		for _, feature := range currentMetadata.EnabledFeatures() {
+			if _, ok := declaredFeatures[feature]; !ok {
+				log.Warnf("Feature %v of tooth %v is no longer available in version %v and will be disabled",
+					feature, toothRepoPath, archive.Metadata().Version())
+				continue
+			}
+
+			enabledFeatures = append(enabledFeatures, feature)
+		}
+	}
+
+	archiveWithFeatures, err := archive.ToFeaturesEnabled(enabledFeatures)
+	if err != nil {
+		return tooth.Archive{}, fmt.Errorf("failed to enable features of %v\n\t%w", toothRepoPath, err)
+	}
+
+	return archiveWithFeatures, nil
+}
+
+// getFeaturesToEnable returns the features enabled in the metadata but not in the
+// installed version of the tooth. It returns nothing if a different version or no version
+// of the tooth is installed.
+func getFeaturesToEnable(ctx *context.Context, metadata tooth.Metadata) ([]string, error) {
+	isInstalled, err := tooth.IsInstalled(ctx, metadata.ToothRepoPath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if tooth is installed\n\t%w", err)
+	} else if !isInstalled {
+		return nil, nil
+	}
+
+	currentMetadata, err := tooth.GetMetadata(ctx, metadata.ToothRepoPath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to find installed tooth metadata\n\t%w", err)
+	} else if currentMetadata.Version().NE(metadata.Version()) {
+		return nil, nil
+	}
+
+	isInstalledFeature := make(map[string]bool)
+	for _, feature := range currentMetadata.EnabledFeatures() {
+		isInstalledFeature[feature] = true
+	}
+
+	featuresToEnable := make([]string, 0)
+	for _, feature := range metadata.EnabledFeatures() {
+		if !isInstalledFeature[feature] {
+			featuresToEnable = append(featuresToEnable, feature)
+		}
+	}
+
+	return featuresToEnable, nil
+}
@@ -0,0 +1,281 @@
+package cmdlipinstall
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/blang/semver/v4"
+	"github.com/lippkg/lip/internal/context"
+	"github.com/lippkg/lip/internal/network"
+	"github.com/lippkg/lip/internal/tooth"
+)
+
+// makeSource records where the tooth archive was downloaded from and where its asset
+// archive will be downloaded from. The hash of the asset archive is left empty until
+// the asset archive is downloaded.
+func makeSource(ctx *context.Context, archive tooth.Archive) (tooth.Source, error) {
+	var source tooth.Source
+
+	archiveSHA256, err := tooth.HashFile(archive.FilePath())
+	if err != nil {
+		return tooth.Source{}, fmt.Errorf("failed to hash tooth archive\n\t%w", err)
+	}
+
+	source.ArchiveSHA256 = archiveSHA256
+
+	// A tooth archive in the cache entry of its Go module proxy URL was downloaded from
+	// there. Otherwise it is a local tooth archive.
+	goModuleProxyURL, err := ctx.GoModuleProxyURL()
+	if err != nil {
+		return tooth.Source{}, fmt.Errorf("failed to get Go module proxy URL\n\t%w", err)
+	}
+
+	archiveURL, err := network.GenerateGoModuleZipFileURL(archive.Metadata().ToothRepoPath(),
+		archive.Metadata().Version(), goModuleProxyURL)
+	if err != nil {
+		return tooth.Source{}, fmt.Errorf("failed to generate Go module zip file URL\n\t%w", err)
+	}
+
+	cachePath, err := getCachePath(ctx, archiveURL)
+	if err != nil {
+		return tooth.Source{}, fmt.Errorf("failed to get cache path of %v\n\t%w", archiveURL, err)
+	}
+
+	if cachePath.Equal(archive.FilePath()) {
+		source.ArchiveURL = archiveURL.String()
+	}
+
+	assetDownloadURL, err := getAssetDownloadURL(ctx, archive.Metadata())
+	if err != nil {
+		return tooth.Source{}, fmt.Errorf("failed to get asset download URL\n\t%w", err)
+	}
+
+	source.AssetURL = assetDownloadURL.String()
+
+	return source, nil
+}
+
+// downloadAndAttachAssetArchive downloads the asset archive of the tooth archive and
+// attaches it. If lockedTeeth is not nil, the asset archive is downloaded from the URL in
+// the lockfile, and its hash must match the lockfile. It returns the tooth archive with
+// the asset archive attached and the source of the archives.
+func downloadAndAttachAssetArchive(ctx *context.Context, archive tooth.Archive,
+	lockedTeeth map[string]tooth.LockedTooth) (tooth.Archive, tooth.Source, error) {
+
+	var source tooth.Source
+	if lockedTeeth != nil {
+		source = lockedTeeth[archive.Metadata().ToothRepoPath()].Source
+	} else {
+		madeSource, err := makeSource(ctx, archive)
+		if err != nil {
+			return tooth.Archive{}, tooth.Source{}, fmt.Errorf("failed to make source\n\t%w", err)
+		}
+
+		source = madeSource
+	}
+
+	assetDownloadURL, err := url.Parse(source.AssetURL)
+	if err != nil {
+		return tooth.Archive{}, tooth.Source{}, fmt.Errorf("failed to parse asset URL %v\n\t%w", source.AssetURL, err)
+	}
+
+	archiveWithAssets, err := downloadToothAssetArchiveIfNotCached(ctx, archive, assetDownloadURL)
+	if err != nil {
+		return tooth.Archive{}, tooth.Source{}, fmt.Errorf("failed to download asset archive\n\t%w", err)
+	}
+
+	if source.AssetURL == "" {
+		return archiveWithAssets, source, nil
+	}
+
+	assetFilePath, err := archiveWithAssets.AssetFilePath()
+	if err != nil {
+		return tooth.Archive{}, tooth.Source{}, fmt.Errorf("failed to get asset archive path\n\t%w", err)
+	}
+
+	assetSHA256, err := tooth.HashFile(assetFilePath)
+	if err != nil {
+		return tooth.Archive{}, tooth.Source{}, fmt.Errorf("failed to hash asset archive\n\t%w", err)
+	}
+
+	if lockedTeeth != nil && assetSHA256 != source.AssetSHA256 {
+		return tooth.Archive{}, tooth.Source{}, fmt.Errorf(
+			"hash of asset archive %v is %v, but %v is locked", source.AssetURL, assetSHA256, source.AssetSHA256)
+	}
+
+	source.AssetSHA256 = assetSHA256
+
+	return archiveWithAssets, source, nil
+}
+
+// downloadLockedToothArchive downloads the tooth archive from the URL in the lockfile and
+// checks its hash.
+func downloadLockedToothArchive(ctx *context.Context, lockedTooth tooth.LockedTooth) (tooth.Archive, error) {
+	if lockedTooth.ArchiveURL == "" {
+		return tooth.Archive{}, fmt.Errorf("tooth %v was installed from a local tooth archive and cannot be downloaded",
+			lockedTooth.ToothRepoPath)
+	}
+
+	version, err := semver.Parse(lockedTooth.Version)
+	if err != nil {
+		return tooth.Archive{}, fmt.Errorf("failed to parse locked version %v\n\t%w", lockedTooth.Version, err)
+	}
+
+	archiveURL, err := url.Parse(lockedTooth.ArchiveURL)
+	if err != nil {
+		return tooth.Archive{}, fmt.Errorf("failed to parse archive URL %v\n\t%w", lockedTooth.ArchiveURL, err)
+	}
+
+	cachePath, err := downloadFileIfNotCached(ctx, archiveURL)
+	if err != nil {
+		return tooth.Archive{}, fmt.Errorf("failed to download file\n\t%w", err)
+	}
+
+	archiveSHA256, err := tooth.HashFile(cachePath)
+	if err != nil {
+		return tooth.Archive{}, fmt.Errorf("failed to hash tooth archive\n\t%w", err)
+	}
+
+	if archiveSHA256 != lockedTooth.ArchiveSHA256 {
+		return tooth.Archive{}, fmt.Errorf("hash of tooth archive %v is %v, but %v is locked",
+			lockedTooth.ArchiveURL, archiveSHA256, lockedTooth.ArchiveSHA256)
+	}
+
+	archive, err := tooth.MakeArchive(cachePath)
+	if err != nil {
+		return tooth.Archive{}, fmt.Errorf("failed to open archive %v\n\t%w", cachePath.LocalString(), err)
+	}
+
+	if err := validateToothArchive(archive, lockedTooth.ToothRepoPath, version); err != nil {
+		return tooth.Archive{}, fmt.Errorf("failed to validate archive\n\t%w", err)
+	}
+
+	archive, err = archive.ToFeaturesEnabled(lockedTooth.Features)
+	if err != nil {
+		return tooth.Archive{}, fmt.Errorf("failed to enable locked features\n\t%w", err)
+	}
+
+	return archive, nil
+}
+
+// downloadLockedToothArchives reads the lockfile and downloads all locked tooth archives.
+// It returns the archives and the locked teeth by tooth repo path. Versions are never
+// looked up, so the lockfile must include all dependencies of the locked teeth.
+func downloadLockedToothArchives(ctx *context.Context) ([]tooth.Archive, map[string]tooth.LockedTooth, error) {
+	lockFile, err := tooth.GetLockFile(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read lockfile\n\t%w", err)
+	}
+
+	lockedTeeth := make(map[string]tooth.LockedTooth)
+	for _, lockedTooth := range lockFile.Teeth {
+		lockedTeeth[lockedTooth.ToothRepoPath] = lockedTooth
+	}
+
+	archives := make([]tooth.Archive, len(lockFile.Teeth))
+	err = runConcurrently(ctx, len(lockFile.Teeth), func(i int) error {
+		archive, err := downloadLockedToothArchive(ctx, lockFile.Teeth[i])
+		if err != nil {
+			return fmt.Errorf("failed to download locked tooth %v@%v\n\t%w", lockFile.Teeth[i].ToothRepoPath,
+				lockFile.Teeth[i].Version, err)
+		}
+
+		archives[i] = archive
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lockedMetadataList := make([]tooth.Metadata, 0, len(archives))
+	for _, archive := range archives {
+		lockedMetadataList = append(lockedMetadataList, archive.Metadata())
+	}
+
+	for _, archive := range archives {
+		dependencies, err := archive.Metadata().Dependencies()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get dependencies of %v\n\t%w", archive.Metadata().ToothRepoPath(),
+				err)
+		}
+
+		deps := make([]string, 0, len(dependencies))
+		for dep := range dependencies {
+			deps = append(deps, dep)
+		}
+		sort.Strings(deps)
+
+		// A dependency may also be provided by a locked tooth.
+		for _, dep := range deps {
+			_, ok, err := tooth.FindSatisfyingTooth(lockedMetadataList, dep, dependencies[dep])
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if _, isLocked := lockedTeeth[dep]; !isLocked && !ok {
+				return nil, nil, fmt.Errorf("locked tooth %v depends on %v, which is not locked",
+					archive.Metadata().ToothRepoPath(), dep)
+			}
+		}
+	}
+
+	return archives, lockedTeeth, nil
+}
+
+// checkInstalledTeethLocked makes sure that the installed teeth can be made the same as
+// the locked teeth. Installed teeth not in the lockfile fail. Teeth installed at their
+// locked versions are not installed again, so they must have been installed from the
+// locked archives, unless forceReinstall is true.
+func checkInstalledTeethLocked(ctx *context.Context, lockedTeeth map[string]tooth.LockedTooth,
+	forceReinstall bool) error {
+
+	metadataList, err := tooth.GetAllMetadata(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list all installed teeth\n\t%w", err)
+	}
+
+	unlockedTeeth := make([]string, 0)
+	for _, metadata := range metadataList {
+		if _, ok := lockedTeeth[metadata.ToothRepoPath()]; !ok {
+			unlockedTeeth = append(unlockedTeeth, metadata.ToothRepoPath())
+		}
+	}
+
+	if len(unlockedTeeth) != 0 {
+		sort.Strings(unlockedTeeth)
+		return fmt.Errorf("installed teeth not in the lockfile, uninstall them first: %v",
+			strings.Join(unlockedTeeth, ", "))
+	}
+
+	if forceReinstall {
+		return nil
+	}
+
+	for _, metadata := range metadataList {
+		lockedTooth := lockedTeeth[metadata.ToothRepoPath()]
+		if metadata.Version().String() != lockedTooth.Version {
+			continue
+		}
+
+		manifest, err := tooth.GetManifest(ctx, metadata.ToothRepoPath())
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("installed tooth %v has no recorded hashes to check against the lockfile, "+
+				"use --force-reinstall to install it again", metadata.ToothRepoPath())
+		} else if err != nil {
+			return fmt.Errorf("failed to get manifest of %v\n\t%w", metadata.ToothRepoPath(), err)
+		}
+
+		if manifest.Source.ArchiveSHA256 != lockedTooth.ArchiveSHA256 ||
+			manifest.Source.AssetSHA256 != lockedTooth.AssetSHA256 {
+			return fmt.Errorf("installed tooth %v was not installed from the locked archives, "+
+				"use --force-reinstall to install it again", metadata.ToothRepoPath())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,312 @@
+package cmdlipinstall
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lippkg/lip/internal/context"
+	"github.com/lippkg/lip/internal/install"
+	"github.com/lippkg/lip/internal/path"
+	"github.com/lippkg/lip/internal/tooth"
+	"github.com/olekukonko/tablewriter"
+)
+
+// planItem describes what installing a tooth archive will do to the workspace.
+type planItem struct {
+	Tooth           string            `json:"tooth"`
+	Action          string            `json:"action"`
+	Version         string            `json:"version"`
+	PreviousVersion string            `json:"previous_version,omitempty"`
+	Features        []string          `json:"features,omitempty"`
+	Files           []planFileItem    `json:"files"`
+	Commands        []planCommandItem `json:"commands"`
+}
+
+type planFileItem struct {
+	Operation string `json:"operation"`
+	Path      string `json:"path"`
+	// Owner is the tooth owning the file if it is owned by another tooth.
+	Owner string `json:"owner,omitempty"`
+}
+
+type planCommandItem struct {
+	Hook    string `json:"hook"`
+	Command string `json:"command"`
+}
+
+const (
+	planActionInstall   = "install"
+	planActionUpgrade   = "upgrade"
+	planActionReinstall = "reinstall"
+	planActionDowngrade = "downgrade"
+	// planActionUninstall is for installed teeth replaced by other teeth.
+	planActionUninstall = "uninstall"
+
+	planFileOperationCreate    = "create"
+	planFileOperationOverwrite = "overwrite"
+	planFileOperationRemove    = "remove"
+)
+
+// makePlan makes the plan of uninstalling the replaced teeth and installing the tooth
+// archives. The asset archives must have been attached to the tooth archives. If
+// ignoreScripts is true, no commands are planned.
+func makePlan(ctx *context.Context, archives []tooth.Archive, replacedTeeth []string,
+	ignoreScripts bool) ([]planItem, error) {
+	plan := make([]planItem, 0)
+
+	fileOwners, err := tooth.GetFileOwners(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file owners\n\t%w", err)
+	}
+
+	for _, replacedTooth := range replacedTeeth {
+		currentMetadata, err := tooth.GetMetadata(ctx, replacedTooth)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find installed tooth metadata\n\t%w", err)
+		}
+
+		item := planItem{
+			Tooth:           replacedTooth,
+			Action:          planActionUninstall,
+			PreviousVersion: currentMetadata.Version().String(),
+			Files:           make([]planFileItem, 0),
+			Commands:        make([]planCommandItem, 0),
+		}
+
+		if err := addUninstallSteps(&item, currentMetadata, make(map[string]bool), fileOwners); err != nil {
+			return nil, fmt.Errorf("failed to make plan for %v\n\t%w", replacedTooth, err)
+		}
+
+		if !ignoreScripts {
+			hookCommands, err := install.GetUninstallHookCommands(currentMetadata)
+			if err != nil {
+				return nil, fmt.Errorf("failed to make plan for %v\n\t%w", replacedTooth, err)
+			}
+
+			addCommandSteps(&item, hookCommands)
+		}
+
+		plan = append(plan, item)
+	}
+
+	for _, archive := range archives {
+		item, err := makePlanItem(ctx, archive, ignoreScripts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to make plan for %v\n\t%w", archive.Metadata().ToothRepoPath(), err)
+		}
+
+		plan = append(plan, item)
+	}
+
+	return plan, nil
+}
+
+// makePlanItem makes the plan of installing a tooth archive with the asset archive attached.
+func makePlanItem(ctx *context.Context, archive tooth.Archive, ignoreScripts bool) (planItem, error) {
+	metadata := archive.Metadata()
+
+	item := planItem{
+		Tooth:    metadata.ToothRepoPath(),
+		Action:   planActionInstall,
+		Version:  metadata.Version().String(),
+		Features: metadata.EnabledFeatures(),
+		Files:    make([]planFileItem, 0),
+		Commands: make([]planCommandItem, 0),
+	}
+
+	files, err := metadata.Files()
+	if err != nil {
+		return planItem{}, fmt.Errorf("failed to get files from metadata\n\t%w", err)
+	}
+
+	isInstalled, err := tooth.IsInstalled(ctx, metadata.ToothRepoPath())
+	if err != nil {
+		return planItem{}, fmt.Errorf("failed to check if tooth is installed\n\t%w", err)
+	}
+
+	fileOwners, err := tooth.GetFileOwners(ctx)
+	if err != nil {
+		return planItem{}, fmt.Errorf("failed to get file owners\n\t%w", err)
+	}
+
+	// The installed version will be uninstalled first.
+
+	if isInstalled {
+		currentMetadata, err := tooth.GetMetadata(ctx, metadata.ToothRepoPath())
+		if err != nil {
+			return planItem{}, fmt.Errorf("failed to find installed tooth metadata\n\t%w", err)
+		}
+
+		if metadata.Version().GT(currentMetadata.Version()) {
+			item.Action = planActionUpgrade
+		} else if metadata.Version().LT(currentMetadata.Version()) {
+			item.Action = planActionDowngrade
+		} else {
+			item.Action = planActionReinstall
+		}
+		item.PreviousVersion = currentMetadata.Version().String()
+
+		newDests := make(map[string]bool)
+		for _, place := range files.Place {
+			newDests[place.Dest.String()] = true
+		}
+
+		if err := addUninstallSteps(&item, currentMetadata, newDests, fileOwners); err != nil {
+			return planItem{}, err
+		}
+	}
+
+	// Then the tooth archive will be installed.
+
+	for _, place := range files.Place {
+		operation := planFileOperationCreate
+		if _, err := os.Stat(place.Dest.LocalString()); err == nil {
+			operation = planFileOperationOverwrite
+		} else if !os.IsNotExist(err) {
+			return planItem{}, fmt.Errorf("failed to get info of %v\n\t%w", place.Dest.LocalString(), err)
+		}
+
+		owner := fileOwners[place.Dest.String()]
+		if owner == metadata.ToothRepoPath() {
+			owner = ""
+		}
+
+		item.Files = append(item.Files, planFileItem{operation, place.Dest.String(), owner})
+	}
+
+	if !ignoreScripts {
+		hookCommands, err := install.GetInstallHookCommands(ctx, metadata)
+		if err != nil {
+			return planItem{}, err
+		}
+
+		addCommandSteps(&item, hookCommands)
+	}
+
+	return item, nil
+}
+
+// addUninstallSteps adds the steps of removing the files of the installed tooth to the
+// plan item. Files placed by the installed tooth at newDests are replaced rather than
+// removed, and paths containing files owned by other teeth are kept.
+func addUninstallSteps(item *planItem, currentMetadata tooth.Metadata, newDests map[string]bool,
+	fileOwners map[string]string) error {
+	currentFiles, err := currentMetadata.Files()
+	if err != nil {
+		return fmt.Errorf("failed to get files from installed tooth metadata\n\t%w", err)
+	}
+
+	preserved := make(map[string]bool)
+	for _, preserve := range currentFiles.Preserve {
+		preserved[preserve.String()] = true
+	}
+
+	// isOwnedByOthers checks if files at or under the path are owned by other teeth.
+	isOwnedByOthers := func(filePath path.Path) (bool, error) {
+		otherOwners, err := install.GetOtherOwners(fileOwners, currentMetadata.ToothRepoPath(), filePath)
+		if err != nil {
+			return false, fmt.Errorf("failed to get owners of %v\n\t%w", filePath, err)
+		}
+
+		return len(otherOwners) != 0, nil
+	}
+
+	// Files placed by the installed version will be removed unless preserved, replaced
+	// or owned by other teeth, and files in files.remove will be removed unless owned by
+	// other teeth.
+	removed := make(map[string]bool)
+	for _, place := range currentFiles.Place {
+		dest := place.Dest.String()
+		if preserved[dest] || newDests[dest] || removed[dest] {
+			continue
+		}
+
+		if isOwned, err := isOwnedByOthers(place.Dest); err != nil {
+			return err
+		} else if isOwned {
+			continue
+		}
+
+		item.Files = append(item.Files, planFileItem{planFileOperationRemove, dest, ""})
+		removed[dest] = true
+	}
+
+	for _, removal := range currentFiles.Remove {
+		if removed[removal.String()] {
+			continue
+		}
+
+		if isOwned, err := isOwnedByOthers(removal); err != nil {
+			return err
+		} else if isOwned {
+			continue
+		}
+
+		item.Files = append(item.Files, planFileItem{planFileOperationRemove, removal.String(), ""})
+		removed[removal.String()] = true
+	}
+
+	return nil
+}
+
+// addCommandSteps adds the hook commands to run to the plan item.
+func addCommandSteps(item *planItem, hookCommands []install.HookCommand) {
+	for _, hookCommand := range hookCommands {
+		item.Commands = append(item.Commands, planCommandItem{hookCommand.Hook, hookCommand.Command.String()})
+	}
+}
+
+// printPlan prints the plan as tables or in JSON format.
+func printPlan(plan []planItem, jsonFlag bool) error {
+	if jsonFlag {
+		jsonBytes, err := json.Marshal(plan)
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON\n\t%w", err)
+		}
+
+		fmt.Print(string(jsonBytes))
+
+		return nil
+	}
+
+	toothTableData := make([][]string, 0)
+	fileTableData := make([][]string, 0)
+	commandTableData := make([][]string, 0)
+
+	for _, item := range plan {
+		toothTableData = append(toothTableData, []string{
+			item.Tooth, item.Action, item.PreviousVersion, item.Version, strings.Join(item.Features, ", "),
+		})
+
+		for _, file := range item.Files {
+			fileTableData = append(fileTableData, []string{item.Tooth, file.Operation, file.Path, file.Owner})
+		}
+
+		for _, command := range item.Commands {
+			commandTableData = append(commandTableData, []string{item.Tooth, command.Hook, command.Command})
+		}
+	}
+
+	tableString := &strings.Builder{}
+
+	toothTable := tablewriter.NewWriter(tableString)
+	toothTable.SetHeader([]string{"Tooth", "Action", "Installed", "Version", "Features"})
+	toothTable.AppendBulk(toothTableData)
+	toothTable.Render()
+
+	fileTable := tablewriter.NewWriter(tableString)
+	fileTable.SetHeader([]string{"Tooth", "Operation", "File", "Owner"})
+	fileTable.AppendBulk(fileTableData)
+	fileTable.Render()
+
+	commandTable := tablewriter.NewWriter(tableString)
+	commandTable.SetHeader([]string{"Tooth", "Hook", "Command"})
+	commandTable.AppendBulk(commandTableData)
+	commandTable.Render()
+
+	fmt.Print(tableString.String())
+
+	return nil
+}
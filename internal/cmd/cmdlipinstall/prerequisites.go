@@ -9,12 +9,19 @@ import (
 )
 
 // getMissingPrerequisites finds missing prerequisites of the tooth specified
-// by the specifier and returns the map of missing prerequisites.
+// by the specifier and returns the map of missing prerequisites. A prerequisite is
+// satisfied by a tooth installed after the archives are installed and replacedTeeth are
+// uninstalled, either the prerequisite itself or a tooth providing it.
 func getMissingPrerequisites(ctx *context.Context,
-	archiveList []tooth.Archive) (map[string]semver.Range, map[string]string, error) {
+	archiveList []tooth.Archive, replacedTeeth []string) (map[string]semver.Range, map[string]string, error) {
 	missingPrerequisiteMap := make(map[string]semver.Range)
 	missingPrerequisitesAsStrings := make(map[string]string)
 
+	resultingMetadataList, err := getResultingMetadataList(ctx, archiveList, replacedTeeth)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	for _, archive := range archiveList {
 		prerequisites, err := archive.Metadata().Prerequisites()
 		if err != nil {
@@ -24,37 +31,14 @@ func getMissingPrerequisites(ctx *context.Context,
 		prerequisitesAsStrings := archive.Metadata().PrerequisitesAsStrings()
 
 		for prerequisite, versionRange := range prerequisites {
-			isInstalled, err := tooth.IsInstalled(ctx, prerequisite)
+			_, isSatisfied, err := tooth.FindSatisfyingTooth(resultingMetadataList, prerequisite, versionRange)
 			if err != nil {
-				return nil, nil, fmt.Errorf("failed to check if tooth is installed\n\t%w", err)
+				return nil, nil, fmt.Errorf("failed to find tooth satisfying prerequisite %v\n\t%w", prerequisite, err)
 			}
 
-			if isInstalled {
-				currentMetadata, err := tooth.GetMetadata(ctx, prerequisite)
-				if err != nil {
-					return nil, nil, fmt.Errorf("failed to find installed tooth metadata\n\t%w", err)
-				}
-
-				if !versionRange(currentMetadata.Version()) {
-					missingPrerequisiteMap[prerequisite] = versionRange
-					missingPrerequisitesAsStrings[prerequisite] = prerequisitesAsStrings[prerequisite]
-				}
-
-				break
-			} else {
-				// Check if the tooth is in the archive list.
-				isInArchiveList := false
-				for _, archive := range archiveList {
-					if archive.Metadata().ToothRepoPath() == prerequisite && versionRange(archive.Metadata().Version()) {
-						isInArchiveList = true
-						break
-					}
-				}
-
-				if !isInArchiveList {
-					missingPrerequisiteMap[prerequisite] = versionRange
-					missingPrerequisitesAsStrings[prerequisite] = prerequisitesAsStrings[prerequisite]
-				}
+			if !isSatisfied {
+				missingPrerequisiteMap[prerequisite] = versionRange
+				missingPrerequisitesAsStrings[prerequisite] = prerequisitesAsStrings[prerequisite]
 			}
 		}
 	}
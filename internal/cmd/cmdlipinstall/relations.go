@@ -0,0 +1,125 @@
+package cmdlipinstall
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lippkg/lip/internal/context"
+	"github.com/lippkg/lip/internal/tooth"
+)
+
+// getReplacedTeeth returns the sorted installed teeth replaced by the tooth archives,
+// which are to be uninstalled before installing the archives.
+func getReplacedTeeth(ctx *context.Context, archives []tooth.Archive) ([]string, error) {
+	isInArchives := make(map[string]bool)
+	for _, archive := range archives {
+		isInArchives[archive.Metadata().ToothRepoPath()] = true
+	}
+
+	replacedTeeth := make([]string, 0)
+	for _, archive := range archives {
+		replaces, err := archive.Metadata().Replaces()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get replaced teeth of %v\n\t%w", archive.Metadata().ToothRepoPath(), err)
+		}
+
+		for replacedTooth, versionRange := range replaces {
+			if isInArchives[replacedTooth] {
+				continue
+			}
+
+			isInstalled, err := tooth.IsInstalled(ctx, replacedTooth)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check if tooth is installed\n\t%w", err)
+			} else if !isInstalled {
+				continue
+			}
+
+			metadata, err := tooth.GetMetadata(ctx, replacedTooth)
+			if err != nil {
+				return nil, fmt.Errorf("failed to find installed tooth metadata\n\t%w", err)
+			}
+
+			if versionRange(metadata.Version()) {
+				replacedTeeth = append(replacedTeeth, replacedTooth)
+			}
+		}
+	}
+
+	sort.Strings(replacedTeeth)
+
+	return replacedTeeth, nil
+}
+
+// getResultingMetadataList returns the metadata of the teeth that will be installed after
+// the archives are installed and replacedTeeth are uninstalled.
+func getResultingMetadataList(ctx *context.Context, archives []tooth.Archive,
+	replacedTeeth []string) ([]tooth.Metadata, error) {
+
+	isRemoved := make(map[string]bool)
+	for _, replacedTooth := range replacedTeeth {
+		isRemoved[replacedTooth] = true
+	}
+	for _, archive := range archives {
+		isRemoved[archive.Metadata().ToothRepoPath()] = true
+	}
+
+	installedMetadataList, err := tooth.GetAllMetadata(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get all installed tooth metadata\n\t%w", err)
+	}
+
+	metadataList := make([]tooth.Metadata, 0)
+	for _, metadata := range installedMetadataList {
+		if !isRemoved[metadata.ToothRepoPath()] {
+			metadataList = append(metadataList, metadata)
+		}
+	}
+
+	for _, archive := range archives {
+		metadataList = append(metadataList, archive.Metadata())
+	}
+
+	return metadataList, nil
+}
+
+// checkConflicts checks that none of the tooth archives conflicts with another archive or
+// with an installed tooth remaining after the archives are installed and replacedTeeth
+// are uninstalled.
+func checkConflicts(ctx *context.Context, archives []tooth.Archive, replacedTeeth []string) error {
+	resultingMetadataList, err := getResultingMetadataList(ctx, archives, replacedTeeth)
+	if err != nil {
+		return err
+	}
+
+	conflictMessages := make([]string, 0)
+	checked := make(map[string]bool)
+	for _, archive := range archives {
+		for _, other := range resultingMetadataList {
+			pair := []string{archive.Metadata().ToothRepoPath(), other.ToothRepoPath()}
+			sort.Strings(pair)
+			if checked[strings.Join(pair, "\n")] {
+				continue
+			}
+			checked[strings.Join(pair, "\n")] = true
+
+			conflicts, description, err := archive.Metadata().ConflictsWith(other)
+			if err != nil {
+				return fmt.Errorf("failed to check conflicts of %v\n\t%w", archive.Metadata().ToothRepoPath(), err)
+			}
+
+			if conflicts {
+				conflictMessages = append(conflictMessages, fmt.Sprintf("%v@%v conflicts with %v@%v (%v)",
+					archive.Metadata().ToothRepoPath(), archive.Metadata().Version(), other.ToothRepoPath(),
+					other.Version(), description))
+			}
+		}
+	}
+
+	if len(conflictMessages) != 0 {
+		return fmt.Errorf("%v", strings.Join(conflictMessages, "\n\t"))
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package cmdlipinstall
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	specifierpkg "github.com/lippkg/lip/internal/specifier"
+)
+
+// requirementsFileFlag collects the requirements files given by repeated -r flags.
+type requirementsFileFlag []string
+
+func (f *requirementsFileFlag) String() string {
+	return strings.Join(*f, ", ")
+}
+
+func (f *requirementsFileFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// parseRequirementsFile reads the specifiers in a requirements file. Each line holds one
+// specifier in the same syntax as on the command line. Blank lines are ignored, and
+// everything after a "#" at the start of a line or after whitespace is a comment.
+// Relative paths of tooth archives are relative to the directory of the requirements
+// file. The returned origins tell the file and line number of each specifier.
+func parseRequirementsFile(requirementsFilePath string) ([]specifierpkg.Specifier, []string, error) {
+	file, err := os.Open(requirementsFilePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open requirements file %v\n\t%w", requirementsFilePath, err)
+	}
+	defer file.Close()
+
+	specifiers := make([]specifierpkg.Specifier, 0)
+	origins := make([]string, 0)
+
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		origin := fmt.Sprintf("%v:%v", requirementsFilePath, lineNumber)
+
+		line := stripRequirementsComment(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		specifier, err := specifierpkg.Parse(line)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%v: failed to parse specifier\n\t%w", origin, err)
+		}
+
+		if specifier.Kind() == specifierpkg.ToothArchiveKind && !filepath.IsAbs(line) {
+			specifier, err = specifierpkg.Parse(filepath.Join(filepath.Dir(requirementsFilePath), line))
+			if err != nil {
+				return nil, nil, fmt.Errorf("%v: failed to parse specifier\n\t%w", origin, err)
+			}
+		}
+
+		specifiers = append(specifiers, specifier)
+		origins = append(origins, origin)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read requirements file %v\n\t%w", requirementsFilePath, err)
+	}
+
+	return specifiers, origins, nil
+}
+
+// stripRequirementsComment removes the comment and surrounding whitespace of a line in
+// a requirements file.
+func stripRequirementsComment(line string) string {
+	for i, r := range line {
+		if r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t') {
+			line = line[:i]
+			break
+		}
+	}
+
+	return strings.TrimSpace(line)
+}
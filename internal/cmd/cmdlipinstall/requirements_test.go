@@ -0,0 +1,102 @@
+package cmdlipinstall
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRequirementsFile(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		// want are the string representations of the specifiers. "<dir>" is replaced by the
+		// directory of the requirements file.
+		want []string
+		// wantLines are the line numbers in the origins of the specifiers.
+		wantLines []int
+		// wantErrLine is the line number in the error, or zero if no error is expected.
+		wantErrLine int
+	}{
+		{
+			name:      "specifiers",
+			content:   "example.com/foo\nexample.com/bar@^1.2\nexample.com/baz[mysql]@latest\n",
+			want:      []string{"example.com/foo", "example.com/bar@^1.2", "example.com/baz[mysql]@latest"},
+			wantLines: []int{1, 2, 3},
+		},
+		{
+			name:      "blank lines and comments",
+			content:   "# Plugins\n\n  example.com/foo@1.0.0  # pinned\n\t\ndist/bar#1.tth\n",
+			want:      []string{"example.com/foo@1.0.0", "<dir>/dist/bar#1.tth"},
+			wantLines: []int{3, 5},
+		},
+		{
+			name:      "Windows line endings",
+			content:   "example.com/foo\r\nexample.com/bar\r\n",
+			want:      []string{"example.com/foo", "example.com/bar"},
+			wantLines: []int{1, 2},
+		},
+		{
+			name:      "relative archive path",
+			content:   "dist/foo.tth\n",
+			want:      []string{"<dir>/dist/foo.tth"},
+			wantLines: []int{1},
+		},
+		{
+			name:        "invalid specifier",
+			content:     "example.com/foo\nexample.com/bar@^x\n",
+			wantErrLine: 2,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			dir := t.TempDir()
+			requirementsFilePath := filepath.Join(dir, "requirements.txt")
+			if err := os.WriteFile(requirementsFilePath, []byte(testCase.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			specifiers, origins, err := parseRequirementsFile(requirementsFilePath)
+			if testCase.wantErrLine != 0 {
+				wantOrigin := fmt.Sprintf("%v:%v", requirementsFilePath, testCase.wantErrLine)
+				if err == nil || !strings.Contains(err.Error(), wantOrigin) {
+					t.Errorf("parseRequirementsFile() error = %v, want an error at %v", err, wantOrigin)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("parseRequirementsFile() error = %v", err)
+			}
+
+			specifierStrings := make([]string, 0, len(specifiers))
+			for _, specifier := range specifiers {
+				specifierStrings = append(specifierStrings, specifier.String())
+			}
+
+			want := make([]string, 0, len(testCase.want))
+			for _, specifierString := range testCase.want {
+				if strings.HasPrefix(specifierString, "<dir>/") {
+					specifierString = filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(specifierString, "<dir>/")))
+				}
+
+				want = append(want, specifierString)
+			}
+
+			if !reflect.DeepEqual(specifierStrings, want) {
+				t.Errorf("parseRequirementsFile() specifiers = %v, want %v", specifierStrings, want)
+			}
+
+			wantOrigins := make([]string, 0, len(testCase.wantLines))
+			for _, line := range testCase.wantLines {
+				wantOrigins = append(wantOrigins, fmt.Sprintf("%v:%v", requirementsFilePath, line))
+			}
+
+			if !reflect.DeepEqual(origins, wantOrigins) {
+				t.Errorf("parseRequirementsFile() origins = %v, want %v", origins, wantOrigins)
+			}
+		})
+	}
+}
@@ -0,0 +1,864 @@
+package cmdlipinstall
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/blang/semver/v4"
+	"github.com/lippkg/lip/internal/context"
+	"github.com/lippkg/lip/internal/tooth"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxResolveAttempts limits the number of candidate versions tried when resolving
+// dependencies, so that a pathological dependency graph cannot make lip run forever.
+const maxResolveAttempts = 10000
+
+// maxListedCandidateFailures limits the number of candidate versions listed when
+// explaining why none of them works.
+const maxListedCandidateFailures = 5
+
+// versionRequirement is a version range of a tooth required by another tooth.
+type versionRequirement struct {
+	requirer string
+	// requirerVersion is the version of the requirer, or the version range of the
+	// requirer if the requirement holds for all its versions in the range. It is empty
+	// if the requirer is not a tooth.
+	requirerVersion    string
+	versionRange       semver.Range
+	versionRangeString string
+}
+
+// requirerString returns the requirer with its version for messages.
+func (req versionRequirement) requirerString() string {
+	if req.requirerVersion == "" {
+		return req.requirer
+	}
+
+	return fmt.Sprintf("%v %v", req.requirer, req.requirerVersion)
+}
+
+// resolveFailure explains why the dependencies cannot be resolved. Either the
+// requirements on a tooth conflict, the tooth conflicts with another tooth, or every
+// candidate version of a tooth fails.
+type resolveFailure struct {
+	toothRepoPath string
+
+	// requirements are the conflicting requirements on the tooth.
+	requirements []versionRequirement
+	// selectedVersion is set if the requirements conflict with the version of the tooth
+	// that is installed, specified or selected before, as told by selectedReason.
+	selectedVersion string
+	selectedReason  string
+
+	// conflictingTooth is set if the version of the tooth given by version cannot be
+	// installed together with the tooth, which is installed, specified or selected as
+	// told by conflictingReason. conflictDescription tells which relationship causes it.
+	version             string
+	conflictingTooth    string
+	conflictingVersion  string
+	conflictingReason   string
+	conflictDescription string
+
+	// candidateFailures are set if every candidate version of the tooth fails.
+	candidateVersionRange string
+	candidateVersions     []semver.Version
+	candidateFailures     []*resolveFailure
+}
+
+// Error renders the explanation in human-readable form.
+func (f *resolveFailure) Error() string {
+	if len(f.candidateFailures) != 0 {
+		message := fmt.Sprintf("no version of %v in %v works:", f.toothRepoPath, f.candidateVersionRange)
+		for i, candidateFailure := range f.candidateFailures {
+			if i == maxListedCandidateFailures {
+				message += fmt.Sprintf("\n\t  ... and %v more versions", len(f.candidateFailures)-i)
+				break
+			}
+
+			message += fmt.Sprintf("\n\t  %v %v: %v", f.toothRepoPath, f.candidateVersions[i],
+				strings.ReplaceAll(candidateFailure.Error(), "\n\t", "\n\t  "))
+		}
+
+		return message
+	}
+
+	if f.conflictingTooth != "" {
+		return fmt.Sprintf("%v %v conflicts with %v %v, which is %v (%v)", f.toothRepoPath, f.version,
+			f.conflictingTooth, f.conflictingVersion, f.conflictingReason, f.conflictDescription)
+	}
+
+	requirementStrings := make([]string, 0, len(f.requirements))
+	requirerStrings := make([]string, 0, len(f.requirements))
+	for _, requirement := range f.requirements {
+		requirementStrings = append(requirementStrings, fmt.Sprintf("%v requires %v %v", requirement.requirerString(),
+			f.toothRepoPath, requirement.versionRangeString))
+		requirerStrings = append(requirerStrings, requirement.requirerString())
+	}
+
+	if f.selectedVersion != "" {
+		return fmt.Sprintf("%v, but %v %v is %v", strings.Join(requirementStrings, ", "), f.toothRepoPath,
+			f.selectedVersion, f.selectedReason)
+	}
+
+	if len(f.requirements) == 1 {
+		return fmt.Sprintf("%v, but no such version is available", requirementStrings[0])
+	}
+
+	return fmt.Sprintf("%v, so %v and %v are incompatible", strings.Join(requirementStrings, ", "),
+		strings.Join(requirerStrings[:len(requirerStrings)-1], ", "), requirerStrings[len(requirerStrings)-1])
+}
+
+// generalize returns a copy of the failure with the version of the tooth in requirements
+// and conflicts replaced by versionRangeString.
+func (f *resolveFailure) generalize(toothRepoPath string, versionRangeString string) *resolveFailure {
+	generalized := *f
+	if f.conflictingTooth != "" && f.toothRepoPath == toothRepoPath {
+		generalized.version = versionRangeString
+	}
+
+	generalized.requirements = make([]versionRequirement, len(f.requirements))
+	for i, requirement := range f.requirements {
+		if requirement.requirer == toothRepoPath {
+			requirement.requirerVersion = versionRangeString
+		}
+		generalized.requirements[i] = requirement
+	}
+
+	return &generalized
+}
+
+// resolverState is a partial solution of the dependencies.
+type resolverState struct {
+	// selected maps the teeth selected so far, not including fixed teeth, to their
+	// versions.
+	selected map[string]semver.Version
+	// requirements maps teeth to the requirements on them from the selected and fixed
+	// teeth.
+	requirements map[string][]versionRequirement
+	// queue is the teeth required but not selected yet, in the order they are found.
+	queue []string
+}
+
+func (s resolverState) clone() resolverState {
+	cloned := resolverState{
+		selected:     make(map[string]semver.Version, len(s.selected)),
+		requirements: make(map[string][]versionRequirement, len(s.requirements)),
+		queue:        append([]string{}, s.queue...),
+	}
+
+	for toothRepoPath, version := range s.selected {
+		cloned.selected[toothRepoPath] = version
+	}
+
+	for toothRepoPath, requirements := range s.requirements {
+		cloned.requirements[toothRepoPath] = append([]versionRequirement{}, requirements...)
+	}
+
+	return cloned
+}
+
+// dependencyResolver finds versions of dependencies satisfying all version ranges by
+// backtracking. Fixed teeth, i.e. installed or specified ones, keep their versions.
+// Dependencies provided by fixed or selected teeth are not selected themselves, and no
+// tooth conflicting with a fixed or selected tooth is selected.
+type dependencyResolver struct {
+	ctx           *context.Context
+	fixedMetadata map[string]tooth.Metadata
+	fixedVersions map[string]semver.Version
+	fixedReasons  map[string]string
+
+	// mutex guards the caches below, which are filled concurrently when prefetching.
+	mutex             sync.Mutex
+	availableVersions map[string]semver.Versions
+	// versionListErrors caches the errors of listing versions.
+	versionListErrors map[string]error
+	archives          map[string]tooth.Archive
+
+	// features maps teeth to the features to enable in their archives if declared.
+	features map[string][]string
+
+	attempts int
+}
+
+func newDependencyResolver(ctx *context.Context, fixedMetadata map[string]tooth.Metadata,
+	fixedReasons map[string]string) *dependencyResolver {
+
+	fixedVersions := make(map[string]semver.Version)
+	for toothRepoPath, metadata := range fixedMetadata {
+		fixedVersions[toothRepoPath] = metadata.Version()
+	}
+
+	return &dependencyResolver{
+		ctx:               ctx,
+		fixedMetadata:     fixedMetadata,
+		fixedVersions:     fixedVersions,
+		fixedReasons:      fixedReasons,
+		availableVersions: make(map[string]semver.Versions),
+		versionListErrors: make(map[string]error),
+		archives:          make(map[string]tooth.Archive),
+		features:          make(map[string][]string),
+	}
+}
+
+// resolve selects versions of all dependencies of the root archives, which must be
+// fixed. It returns the archives of the selected teeth. If no solution exists, the
+// returned error is a *resolveFailure explaining why.
+func (r *dependencyResolver) resolve(rootArchives []tooth.Archive) ([]tooth.Archive, error) {
+	state := resolverState{
+		selected:     make(map[string]semver.Version),
+		requirements: make(map[string][]versionRequirement),
+		queue:        make([]string, 0),
+	}
+
+	for _, archive := range rootArchives {
+		failure, err := r.checkConflicts(state, archive.Metadata())
+		if err != nil {
+			return nil, err
+		} else if failure != nil {
+			return nil, failure
+		}
+
+		failure, err = r.addRequirements(&state, archive)
+		if err != nil {
+			return nil, err
+		} else if failure != nil {
+			return nil, failure
+		}
+	}
+
+	selected, failure, err := r.solve(state)
+	if err != nil {
+		return nil, err
+	} else if failure != nil {
+		return nil, failure
+	}
+
+	return r.getSelectedArchives(selected)
+}
+
+// resolveUpgrade selects versions of the installed teeth to upgrade together with their
+// dependencies, so that the teeth requiring each other get versions chosen together. The
+// teeth to upgrade must not be fixed. Each of them is no older than its installed
+// version, satisfies the version ranges required by the fixed teeth and keeps the
+// features enabled in its installed version. Teeth with no newer versions available keep
+// their installed versions. It returns the archives of the selected teeth. If no solution
+// exists, the returned error is a *resolveFailure explaining why.
+func (r *dependencyResolver) resolveUpgrade(installedMetadataList []tooth.Metadata) ([]tooth.Archive, error) {
+	err := runConcurrently(r.ctx, len(installedMetadataList), func(i int) error {
+		_, err := r.getAvailableVersions(installedMetadataList[i].ToothRepoPath())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	upgradableMetadataList := make([]tooth.Metadata, 0)
+	for _, metadata := range installedMetadataList {
+		availableVersions, err := r.getAvailableVersions(metadata.ToothRepoPath())
+		if err != nil {
+			return nil, err
+		}
+
+		hasNewerVersion := false
+		for _, version := range availableVersions {
+			if version.GT(metadata.Version()) {
+				hasNewerVersion = true
+				break
+			}
+		}
+
+		if hasNewerVersion {
+			upgradableMetadataList = append(upgradableMetadataList, metadata)
+		} else {
+			r.fixedMetadata[metadata.ToothRepoPath()] = metadata
+			r.fixedVersions[metadata.ToothRepoPath()] = metadata.Version()
+			r.fixedReasons[metadata.ToothRepoPath()] = "installed"
+		}
+	}
+
+	state := resolverState{
+		selected:     make(map[string]semver.Version),
+		requirements: make(map[string][]versionRequirement),
+		queue:        make([]string, 0),
+	}
+
+	for _, metadata := range upgradableMetadataList {
+		toothRepoPath := metadata.ToothRepoPath()
+		installedVersion := metadata.Version()
+
+		state.requirements[toothRepoPath] = []versionRequirement{{
+			requirer: "lip upgrade",
+			versionRange: func(version semver.Version) bool {
+				return version.GTE(installedVersion)
+			},
+			versionRangeString: ">=" + installedVersion.String(),
+		}}
+		state.queue = append(state.queue, toothRepoPath)
+
+		r.features[toothRepoPath] = metadata.EnabledFeatures()
+	}
+
+	// The installed versions of the teeth to upgrade are replaced, so only the fixed
+	// teeth restrict their versions in advance.
+	fixedToothRepoPaths := make([]string, 0, len(r.fixedMetadata))
+	for toothRepoPath := range r.fixedMetadata {
+		fixedToothRepoPaths = append(fixedToothRepoPaths, toothRepoPath)
+	}
+	sort.Strings(fixedToothRepoPaths)
+
+	for _, fixedToothRepoPath := range fixedToothRepoPaths {
+		fixedMetadata := r.fixedMetadata[fixedToothRepoPath]
+
+		depMap, err := fixedMetadata.Dependencies()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get dependencies of %v\n\t%w", fixedToothRepoPath, err)
+		}
+
+		depStrMap := fixedMetadata.DependenciesAsStrings()
+
+		for _, metadata := range upgradableMetadataList {
+			toothRepoPath := metadata.ToothRepoPath()
+			if depRange, ok := depMap[toothRepoPath]; ok {
+				state.requirements[toothRepoPath] = append(state.requirements[toothRepoPath], versionRequirement{
+					requirer:           fixedToothRepoPath,
+					requirerVersion:    fixedMetadata.Version().String(),
+					versionRange:       depRange,
+					versionRangeString: depStrMap[toothRepoPath],
+				})
+			}
+		}
+	}
+
+	selected, failure, err := r.solve(state)
+	if err != nil {
+		return nil, err
+	} else if failure != nil {
+		return nil, failure
+	}
+
+	return r.getSelectedArchives(selected)
+}
+
+// getSelectedArchives returns the archives of the selected teeth sorted by tooth
+// repository path.
+func (r *dependencyResolver) getSelectedArchives(selected map[string]semver.Version) ([]tooth.Archive, error) {
+	toothRepoPaths := make([]string, 0, len(selected))
+	for toothRepoPath := range selected {
+		toothRepoPaths = append(toothRepoPaths, toothRepoPath)
+	}
+	sort.Strings(toothRepoPaths)
+
+	archives := make([]tooth.Archive, 0, len(toothRepoPaths))
+	for _, toothRepoPath := range toothRepoPaths {
+		archive, err := r.getArchive(toothRepoPath, selected[toothRepoPath])
+		if err != nil {
+			return nil, err
+		}
+
+		archives = append(archives, archive)
+	}
+
+	return archives, nil
+}
+
+// solve selects a version of the first tooth in the queue and recursively solves the
+// rest, trying older versions if newer ones lead to conflicts. Teeth whose versions
+// cannot be listed, e.g. virtual teeth, are put off in the hope that a tooth selected
+// later provides them. It returns the selected versions, or the failure if no solution
+// exists.
+func (r *dependencyResolver) solve(state resolverState) (map[string]semver.Version, *resolveFailure, error) {
+	debugLogger := log.WithFields(log.Fields{
+		"package": "cmdlipinstall",
+		"method":  "dependencyResolver.solve",
+	})
+
+	if len(state.queue) == 0 {
+		return state.selected, nil, nil
+	}
+
+	if err := r.prefetch(state); err != nil {
+		return nil, nil, err
+	}
+
+	index, provider, err := r.pickNext(state)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	toothRepoPath := state.queue[index]
+	requirements := state.requirements[toothRepoPath]
+
+	if provider != "" {
+		debugLogger.Debugf("%v is provided by %v", toothRepoPath, provider)
+
+		nextState := state.clone()
+		nextState.queue = removeFromQueue(nextState.queue, index)
+
+		return r.solve(nextState)
+	}
+
+	candidates, err := r.getCandidates(toothRepoPath, requirements)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(candidates) == 0 {
+		return nil, &resolveFailure{toothRepoPath: toothRepoPath, requirements: requirements}, nil
+	}
+
+	failures := make([]*resolveFailure, 0, len(candidates))
+	for _, candidate := range candidates {
+		r.attempts++
+		if r.attempts > maxResolveAttempts {
+			return nil, nil, fmt.Errorf("gave up resolving dependencies after trying %v versions", maxResolveAttempts)
+		}
+
+		debugLogger.Debugf("Trying %v@%v", toothRepoPath, candidate)
+
+		archive, err := r.getArchive(toothRepoPath, candidate)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		failure, err := r.checkConflicts(state, archive.Metadata())
+		if err != nil {
+			return nil, nil, err
+		} else if failure != nil {
+			debugLogger.Debugf("Rejected %v@%v: %v", toothRepoPath, candidate, failure)
+
+			failures = append(failures, failure)
+			continue
+		}
+
+		nextState := state.clone()
+		nextState.queue = removeFromQueue(nextState.queue, index)
+		nextState.selected[toothRepoPath] = candidate
+
+		failure, err = r.addRequirements(&nextState, archive)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if failure == nil {
+			var selected map[string]semver.Version
+			selected, failure, err = r.solve(nextState)
+			if err != nil {
+				return nil, nil, err
+			} else if failure == nil {
+				return selected, nil, nil
+			}
+		}
+
+		debugLogger.Debugf("Rejected %v@%v: %v", toothRepoPath, candidate, failure)
+
+		failures = append(failures, failure)
+	}
+
+	return nil, explainCandidateFailures(toothRepoPath, requirements, candidates, failures), nil
+}
+
+// pickNext picks the tooth in the queue to solve next, i.e. the first one either
+// provided by a selected tooth, which is returned as well, or with its version list
+// available. If there is no such tooth, the error of listing the versions of the first
+// tooth is returned.
+func (r *dependencyResolver) pickNext(state resolverState) (int, string, error) {
+	var firstErr error
+	for i, toothRepoPath := range state.queue {
+		// A tooth selected after the requirements were found may provide the tooth.
+		provider, err := r.findSelectedProvider(state, toothRepoPath, state.requirements[toothRepoPath])
+		if err != nil {
+			return 0, "", err
+		} else if provider != "" {
+			return i, provider, nil
+		}
+
+		if _, err := r.getAvailableVersions(toothRepoPath); err == nil {
+			return i, "", nil
+		} else if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return 0, "", firstErr
+}
+
+func removeFromQueue(queue []string, index int) []string {
+	return append(queue[:index:index], queue[index+1:]...)
+}
+
+// explainCandidateFailures explains why every candidate version of the tooth fails. If
+// all candidates fail for the same reason regardless of their versions, the reason is
+// returned with the versions replaced by the required version range.
+func explainCandidateFailures(toothRepoPath string, requirements []versionRequirement,
+	candidates []semver.Version, failures []*resolveFailure) *resolveFailure {
+
+	versionRangeStrings := make([]string, 0, len(requirements))
+	for _, requirement := range requirements {
+		versionRangeStrings = append(versionRangeStrings, requirement.versionRangeString)
+	}
+	versionRangeString := strings.Join(versionRangeStrings, ", ")
+
+	generalized := failures[0].generalize(toothRepoPath, versionRangeString)
+	for _, failure := range failures[1:] {
+		if failure.generalize(toothRepoPath, versionRangeString).Error() != generalized.Error() {
+			return &resolveFailure{
+				toothRepoPath:         toothRepoPath,
+				candidateVersionRange: versionRangeString,
+				candidateVersions:     candidates,
+				candidateFailures:     failures,
+			}
+		}
+	}
+
+	return generalized
+}
+
+// addRequirements adds the dependencies of the selected or fixed tooth archive to the
+// state. Dependencies provided by fixed or selected teeth are satisfied already. It
+// returns a failure if a dependency conflicts with a fixed or selected tooth, or with
+// other requirements on it.
+func (r *dependencyResolver) addRequirements(state *resolverState, archive tooth.Archive) (*resolveFailure,
+	error) {
+
+	metadata := archive.Metadata()
+
+	depMap, err := metadata.Dependencies()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dependencies of %v\n\t%w", archive.FilePath().LocalString(), err)
+	}
+
+	depStrMap := metadata.DependenciesAsStrings()
+
+	deps := make([]string, 0, len(depMap))
+	for dep := range depMap {
+		deps = append(deps, dep)
+	}
+	sort.Strings(deps)
+
+	for _, dep := range deps {
+		requirement := versionRequirement{
+			requirer:           metadata.ToothRepoPath(),
+			requirerVersion:    metadata.Version().String(),
+			versionRange:       depMap[dep],
+			versionRangeString: depStrMap[dep],
+		}
+
+		if fixedVersion, ok := r.fixedVersions[dep]; ok {
+			if !requirement.versionRange(fixedVersion) {
+				return &resolveFailure{
+					toothRepoPath:   dep,
+					requirements:    []versionRequirement{requirement},
+					selectedVersion: fixedVersion.String(),
+					selectedReason:  r.fixedReasons[dep],
+				}, nil
+			}
+
+			continue
+		}
+
+		if _, isSelected := state.selected[dep]; !isSelected {
+			provided, err := r.isProvidedByFixedTooth(dep, requirement)
+			if err != nil {
+				return nil, err
+			} else if provided {
+				continue
+			}
+		}
+
+		requirements := append(state.requirements[dep], requirement)
+		state.requirements[dep] = requirements
+
+		if selectedVersion, ok := state.selected[dep]; ok {
+			if requirement.versionRange(selectedVersion) {
+				continue
+			}
+
+			// Tell whether the requirements conflict at all, or only with the
+			// version selected before.
+			candidates, err := r.getCandidates(dep, requirements)
+			if err != nil {
+				return nil, err
+			}
+
+			if len(candidates) == 0 {
+				return &resolveFailure{toothRepoPath: dep, requirements: requirements}, nil
+			}
+
+			return &resolveFailure{
+				toothRepoPath:   dep,
+				requirements:    []versionRequirement{requirement},
+				selectedVersion: selectedVersion.String(),
+				selectedReason:  "selected",
+			}, nil
+		}
+
+		provider, err := r.findSelectedProvider(*state, dep, requirements)
+		if err != nil {
+			return nil, err
+		}
+
+		if provider == "" && !isQueued(*state, dep) {
+			state.queue = append(state.queue, dep)
+		}
+	}
+
+	return nil, nil
+}
+
+// isProvidedByFixedTooth tells whether a fixed tooth provides the tooth in the required
+// version range.
+func (r *dependencyResolver) isProvidedByFixedTooth(toothRepoPath string,
+	requirement versionRequirement) (bool, error) {
+
+	for _, metadata := range r.fixedMetadata {
+		if metadata.ToothRepoPath() == toothRepoPath {
+			continue
+		}
+
+		satisfies, err := metadata.Satisfies(toothRepoPath, requirement.versionRange)
+		if err != nil {
+			return false, err
+		} else if satisfies {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// findSelectedProvider returns the selected tooth providing the tooth in all required
+// version ranges, or an empty string if there is none.
+func (r *dependencyResolver) findSelectedProvider(state resolverState, toothRepoPath string,
+	requirements []versionRequirement) (string, error) {
+
+	for _, selectedToothRepoPath := range sortedSelectedTeeth(state) {
+		if selectedToothRepoPath == toothRepoPath {
+			continue
+		}
+
+		archive, err := r.getArchive(selectedToothRepoPath, state.selected[selectedToothRepoPath])
+		if err != nil {
+			return "", err
+		}
+
+		satisfiesAll := true
+		for _, requirement := range requirements {
+			satisfies, err := archive.Metadata().Satisfies(toothRepoPath, requirement.versionRange)
+			if err != nil {
+				return "", err
+			} else if !satisfies {
+				satisfiesAll = false
+				break
+			}
+		}
+
+		if satisfiesAll {
+			return selectedToothRepoPath, nil
+		}
+	}
+
+	return "", nil
+}
+
+// checkConflicts returns a failure if the tooth conflicts with a fixed or selected tooth.
+func (r *dependencyResolver) checkConflicts(state resolverState, metadata tooth.Metadata) (*resolveFailure,
+	error) {
+
+	fixedToothRepoPaths := make([]string, 0, len(r.fixedMetadata))
+	for toothRepoPath := range r.fixedMetadata {
+		fixedToothRepoPaths = append(fixedToothRepoPaths, toothRepoPath)
+	}
+	sort.Strings(fixedToothRepoPaths)
+
+	others := make([]tooth.Metadata, 0)
+	reasons := make([]string, 0)
+	for _, toothRepoPath := range fixedToothRepoPaths {
+		others = append(others, r.fixedMetadata[toothRepoPath])
+		reasons = append(reasons, r.fixedReasons[toothRepoPath])
+	}
+
+	for _, toothRepoPath := range sortedSelectedTeeth(state) {
+		archive, err := r.getArchive(toothRepoPath, state.selected[toothRepoPath])
+		if err != nil {
+			return nil, err
+		}
+
+		others = append(others, archive.Metadata())
+		reasons = append(reasons, "selected")
+	}
+
+	for i, other := range others {
+		conflicts, description, err := metadata.ConflictsWith(other)
+		if err != nil {
+			return nil, err
+		}
+
+		if conflicts {
+			return &resolveFailure{
+				toothRepoPath:       metadata.ToothRepoPath(),
+				version:             metadata.Version().String(),
+				conflictingTooth:    other.ToothRepoPath(),
+				conflictingVersion:  other.Version().String(),
+				conflictingReason:   reasons[i],
+				conflictDescription: description,
+			}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func sortedSelectedTeeth(state resolverState) []string {
+	toothRepoPaths := make([]string, 0, len(state.selected))
+	for toothRepoPath := range state.selected {
+		toothRepoPaths = append(toothRepoPaths, toothRepoPath)
+	}
+	sort.Strings(toothRepoPaths)
+
+	return toothRepoPaths
+}
+
+func isQueued(state resolverState, toothRepoPath string) bool {
+	for _, queued := range state.queue {
+		if queued == toothRepoPath {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getCandidates returns the available versions of the tooth satisfying all requirements,
+// in the order to try them: stable versions from newest to oldest, then prereleases from
+// newest to oldest.
+func (r *dependencyResolver) getCandidates(toothRepoPath string,
+	requirements []versionRequirement) ([]semver.Version, error) {
+
+	availableVersions, err := r.getAvailableVersions(toothRepoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	stableVersions := make([]semver.Version, 0)
+	prereleaseVersions := make([]semver.Version, 0)
+	for _, version := range availableVersions {
+		satisfied := true
+		for _, requirement := range requirements {
+			if !requirement.versionRange(version) {
+				satisfied = false
+				break
+			}
+		}
+
+		if !satisfied {
+			continue
+		}
+
+		if len(version.Pre) == 0 {
+			stableVersions = append(stableVersions, version)
+		} else {
+			prereleaseVersions = append(prereleaseVersions, version)
+		}
+	}
+
+	sort.Slice(stableVersions, func(i, j int) bool { return stableVersions[i].GT(stableVersions[j]) })
+	sort.Slice(prereleaseVersions, func(i, j int) bool { return prereleaseVersions[i].GT(prereleaseVersions[j]) })
+
+	return append(stableVersions, prereleaseVersions...), nil
+}
+
+// prefetch fetches the version lists of the teeth in the queue and the archives of their
+// newest candidate versions concurrently, so that they are cached when tried. Failing to
+// list versions is left to be reported when the tooth is tried, as the tooth might be
+// a virtual tooth provided by another one.
+func (r *dependencyResolver) prefetch(state resolverState) error {
+	runConcurrently(r.ctx, len(state.queue), func(i int) error {
+		r.getAvailableVersions(state.queue[i])
+		return nil
+	})
+
+	return runConcurrently(r.ctx, len(state.queue), func(i int) error {
+		candidates, err := r.getCandidates(state.queue[i], state.requirements[state.queue[i]])
+		if err != nil || len(candidates) == 0 {
+			return nil
+		}
+
+		_, err = r.getArchive(state.queue[i], candidates[0])
+		return err
+	})
+}
+
+// getAvailableVersions returns the cached version list of the tooth, fetching it if
+// necessary.
+func (r *dependencyResolver) getAvailableVersions(toothRepoPath string) (semver.Versions, error) {
+	r.mutex.Lock()
+	availableVersions, ok := r.availableVersions[toothRepoPath]
+	versionListErr := r.versionListErrors[toothRepoPath]
+	r.mutex.Unlock()
+
+	if ok {
+		return availableVersions, nil
+	} else if versionListErr != nil {
+		return nil, versionListErr
+	}
+
+	availableVersions, err := tooth.GetAvailableVersions(r.ctx, toothRepoPath)
+	if err != nil {
+		err = fmt.Errorf("failed to get available versions of %v\n\t%w", toothRepoPath, err)
+
+		r.mutex.Lock()
+		r.versionListErrors[toothRepoPath] = err
+		r.mutex.Unlock()
+
+		return nil, err
+	}
+
+	r.mutex.Lock()
+	r.availableVersions[toothRepoPath] = availableVersions
+	r.mutex.Unlock()
+
+	return availableVersions, nil
+}
+
+// getArchive returns the cached tooth archive, downloading it if necessary.
+func (r *dependencyResolver) getArchive(toothRepoPath string, version semver.Version) (tooth.Archive, error) {
+	key := toothRepoPath + "@" + version.String()
+
+	r.mutex.Lock()
+	archive, ok := r.archives[key]
+	r.mutex.Unlock()
+
+	if ok {
+		return archive, nil
+	}
+
+	archive, err := downloadToothArchiveIfNotCached(r.ctx, toothRepoPath, version)
+	if err != nil {
+		return tooth.Archive{}, fmt.Errorf("failed to download tooth %v@%v\n\t%w", toothRepoPath, version, err)
+	}
+
+	declaredFeatures := archive.Metadata().Features()
+	enabledFeatures := make([]string, 0)
+	for _, feature := range r.features[toothRepoPath] {
+		if _, ok := declaredFeatures[feature]; ok {
+			enabledFeatures = append(enabledFeatures, feature)
+		}
+	}
+
+	if len(enabledFeatures) != 0 {
+		archive, err = archive.ToFeaturesEnabled(enabledFeatures)
+		if err != nil {
+			return tooth.Archive{}, fmt.Errorf("failed to enable features of %v@%v\n\t%w", toothRepoPath, version,
+				err)
+		}
+	}
+
+	r.mutex.Lock()
+	r.archives[key] = archive
+	r.mutex.Unlock()
+
+	return archive, nil
+}
@@ -0,0 +1,353 @@
+package cmdlipinstall
+
+import (
+	gozip "archive/zip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/blang/semver/v4"
+	"github.com/lippkg/lip/internal/context"
+	"github.com/lippkg/lip/internal/path"
+	"github.com/lippkg/lip/internal/tooth"
+)
+
+// testToothVersion is a version of a tooth available to or installed in the tests. Tooth
+// repo paths are short names prefixed with "example.com/".
+type testToothVersion struct {
+	name         string
+	version      string
+	dependencies map[string]string
+	conflicts    map[string]string
+}
+
+func TestDependencyResolverResolve(t *testing.T) {
+	testCases := []struct {
+		name      string
+		available []testToothVersion
+		installed []testToothVersion
+		// root is specified and depends on the teeth to resolve.
+		root    testToothVersion
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "newest version in range",
+			available: []testToothVersion{
+				{name: "c", version: "1.0.0"},
+				{name: "c", version: "1.1.0"},
+				{name: "c", version: "2.0.0"},
+			},
+			root: testToothVersion{name: "r", version: "1.0.0", dependencies: map[string]string{"c": "1.x"}},
+			want: []string{"example.com/c@1.1.0"},
+		},
+		{
+			name: "stable version before prerelease",
+			available: []testToothVersion{
+				{name: "c", version: "1.0.0"},
+				{name: "c", version: "2.0.0-beta.1"},
+			},
+			root: testToothVersion{name: "r", version: "1.0.0", dependencies: map[string]string{"c": ">=1.0.0"}},
+			want: []string{"example.com/c@1.0.0"},
+		},
+		{
+			name: "older version if newer one conflicts",
+			available: []testToothVersion{
+				{name: "a", version: "1.0.0", dependencies: map[string]string{"c": "1.x"}},
+				{name: "a", version: "2.0.0", dependencies: map[string]string{"c": "2.x"}},
+				{name: "c", version: "1.0.0"},
+				{name: "c", version: "2.0.0"},
+			},
+			root: testToothVersion{name: "r", version: "1.0.0", dependencies: map[string]string{"a": ">=1.0.0", "c": "1.x"}},
+			want: []string{"example.com/a@1.0.0", "example.com/c@1.0.0"},
+		},
+		{
+			name: "older version if newer one conflicts with installed tooth",
+			available: []testToothVersion{
+				{name: "a", version: "1.0.0"},
+				{name: "a", version: "2.0.0", conflicts: map[string]string{"x": "1.x"}},
+			},
+			installed: []testToothVersion{{name: "x", version: "1.0.0"}},
+			root:      testToothVersion{name: "r", version: "1.0.0", dependencies: map[string]string{"a": ">=1.0.0"}},
+			want:      []string{"example.com/a@1.0.0"},
+		},
+		{
+			name: "installed version kept",
+			available: []testToothVersion{
+				{name: "c", version: "1.0.0"},
+				{name: "c", version: "1.1.0"},
+			},
+			installed: []testToothVersion{{name: "c", version: "1.0.0"}},
+			root:      testToothVersion{name: "r", version: "1.0.0", dependencies: map[string]string{"c": "1.x"}},
+			want:      []string{},
+		},
+		{
+			name: "installed version out of range",
+			available: []testToothVersion{
+				{name: "c", version: "1.0.0"},
+				{name: "c", version: "2.0.0"},
+			},
+			installed: []testToothVersion{{name: "c", version: "1.0.0"}},
+			root:      testToothVersion{name: "r", version: "1.0.0", dependencies: map[string]string{"c": "2.x"}},
+			wantErr:   "example.com/r 1.0.0 requires example.com/c 2.x, but example.com/c 1.0.0 is installed",
+		},
+		{
+			name:      "no version in range",
+			available: []testToothVersion{{name: "c", version: "1.0.0"}},
+			root:      testToothVersion{name: "r", version: "1.0.0", dependencies: map[string]string{"c": "3.x"}},
+			wantErr:   "example.com/r 1.0.0 requires example.com/c 3.x, but no such version is available",
+		},
+		{
+			name: "incompatible dependencies",
+			available: []testToothVersion{
+				{name: "a", version: "1.0.0", dependencies: map[string]string{"c": "1.x"}},
+				{name: "a", version: "1.1.0", dependencies: map[string]string{"c": "1.x"}},
+				{name: "b", version: "1.0.0", dependencies: map[string]string{"c": "2.x"}},
+				{name: "c", version: "1.0.0"},
+				{name: "c", version: "2.0.0"},
+			},
+			root: testToothVersion{name: "r", version: "1.0.0", dependencies: map[string]string{"a": "1.x", "b": "1.x"}},
+			wantErr: "example.com/a 1.x requires example.com/c 1.x, example.com/b 1.x requires example.com/c 2.x, " +
+				"so example.com/a 1.x and example.com/b 1.x are incompatible",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			resolver, archiveMaker := newTestResolver(t, testCase.available, testCase.installed)
+
+			rootArchive := archiveMaker(testCase.root)
+			resolver.fixedMetadata[rootArchive.Metadata().ToothRepoPath()] = rootArchive.Metadata()
+			resolver.fixedVersions[rootArchive.Metadata().ToothRepoPath()] = rootArchive.Metadata().Version()
+			resolver.fixedReasons[rootArchive.Metadata().ToothRepoPath()] = "specified"
+
+			archives, err := resolver.resolve([]tooth.Archive{rootArchive})
+			checkResolveResult(t, archives, err, testCase.want, testCase.wantErr)
+		})
+	}
+}
+
+func TestDependencyResolverResolveUpgrade(t *testing.T) {
+	testCases := []struct {
+		name      string
+		available []testToothVersion
+		installed []testToothVersion
+		upgraded  []string
+		want      []string
+		wantErr   string
+	}{
+		{
+			name: "dependency upgraded together",
+			available: []testToothVersion{
+				{name: "a", version: "1.0.0", dependencies: map[string]string{"c": "1.x"}},
+				{name: "a", version: "2.0.0", dependencies: map[string]string{"c": "2.x"}},
+				{name: "c", version: "1.0.0"},
+				{name: "c", version: "2.0.0"},
+			},
+			installed: []testToothVersion{
+				{name: "a", version: "1.0.0", dependencies: map[string]string{"c": "1.x"}},
+				{name: "c", version: "1.0.0"},
+			},
+			upgraded: []string{"a", "c"},
+			want:     []string{"example.com/a@2.0.0", "example.com/c@2.0.0"},
+		},
+		{
+			name: "dependency not upgraded",
+			available: []testToothVersion{
+				{name: "a", version: "1.0.0", dependencies: map[string]string{"c": "1.x"}},
+				{name: "a", version: "1.5.0", dependencies: map[string]string{"c": "1.x"}},
+				{name: "a", version: "2.0.0", dependencies: map[string]string{"c": "2.x"}},
+				{name: "c", version: "1.0.0"},
+				{name: "c", version: "2.0.0"},
+			},
+			installed: []testToothVersion{
+				{name: "a", version: "1.0.0", dependencies: map[string]string{"c": "1.x"}},
+				{name: "c", version: "1.0.0"},
+			},
+			upgraded: []string{"a"},
+			want:     []string{"example.com/a@1.5.0"},
+		},
+		{
+			name: "range required by installed dependent",
+			available: []testToothVersion{
+				{name: "c", version: "1.0.0"},
+				{name: "c", version: "1.1.0"},
+				{name: "c", version: "2.0.0"},
+			},
+			installed: []testToothVersion{
+				{name: "b", version: "1.0.0", dependencies: map[string]string{"c": "1.x"}},
+				{name: "c", version: "1.0.0"},
+			},
+			upgraded: []string{"c"},
+			want:     []string{"example.com/c@1.1.0"},
+		},
+		{
+			name: "new dependency",
+			available: []testToothVersion{
+				{name: "a", version: "1.0.0"},
+				{name: "a", version: "2.0.0", dependencies: map[string]string{"d": "1.x"}},
+				{name: "d", version: "1.0.0"},
+			},
+			installed: []testToothVersion{{name: "a", version: "1.0.0"}},
+			upgraded:  []string{"a"},
+			want:      []string{"example.com/a@2.0.0", "example.com/d@1.0.0"},
+		},
+		{
+			name: "no newer version",
+			available: []testToothVersion{
+				{name: "a", version: "1.0.0"},
+				{name: "a", version: "2.0.0"},
+			},
+			installed: []testToothVersion{{name: "a", version: "2.0.0"}},
+			upgraded:  []string{"a"},
+			want:      []string{},
+		},
+		{
+			name: "newer version conflicting with installed tooth",
+			available: []testToothVersion{
+				{name: "a", version: "1.0.0"},
+				{name: "a", version: "2.0.0", conflicts: map[string]string{"x": "1.x"}},
+			},
+			installed: []testToothVersion{
+				{name: "a", version: "1.0.0"},
+				{name: "x", version: "1.0.0"},
+			},
+			upgraded: []string{"a"},
+			want:     []string{"example.com/a@1.0.0"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			resolver, _ := newTestResolver(t, testCase.available, testCase.installed)
+
+			upgradedMetadataList := make([]tooth.Metadata, 0, len(testCase.upgraded))
+			for _, name := range testCase.upgraded {
+				toothRepoPath := "example.com/" + name
+
+				upgradedMetadataList = append(upgradedMetadataList, resolver.fixedMetadata[toothRepoPath])
+				delete(resolver.fixedMetadata, toothRepoPath)
+				delete(resolver.fixedVersions, toothRepoPath)
+				delete(resolver.fixedReasons, toothRepoPath)
+			}
+
+			archives, err := resolver.resolveUpgrade(upgradedMetadataList)
+			checkResolveResult(t, archives, err, testCase.want, testCase.wantErr)
+		})
+	}
+}
+
+// newTestResolver returns a resolver with the available teeth cached, so that it never
+// goes online, and the installed teeth fixed. It also returns a function making archives
+// of teeth.
+func newTestResolver(t *testing.T, available []testToothVersion,
+	installed []testToothVersion) (*dependencyResolver, func(testToothVersion) tooth.Archive) {
+
+	dir := t.TempDir()
+	archiveCount := 0
+	archiveMaker := func(testTooth testToothVersion) tooth.Archive {
+		archiveCount++
+		return makeTestArchive(t, filepath.Join(dir, strconv.Itoa(archiveCount)+".tth"), testTooth)
+	}
+
+	fixedMetadata := make(map[string]tooth.Metadata)
+	fixedReasons := make(map[string]string)
+	for _, testTooth := range installed {
+		metadata := archiveMaker(testTooth).Metadata()
+		fixedMetadata[metadata.ToothRepoPath()] = metadata
+		fixedReasons[metadata.ToothRepoPath()] = "installed"
+	}
+
+	resolver := newDependencyResolver(context.New(context.Config{}, semver.Version{}), fixedMetadata, fixedReasons)
+
+	for _, testTooth := range available {
+		archive := archiveMaker(testTooth)
+		toothRepoPath := archive.Metadata().ToothRepoPath()
+
+		resolver.availableVersions[toothRepoPath] = append(resolver.availableVersions[toothRepoPath],
+			archive.Metadata().Version())
+		resolver.archives[toothRepoPath+"@"+archive.Metadata().Version().String()] = archive
+	}
+
+	return resolver, archiveMaker
+}
+
+func makeTestArchive(t *testing.T, archiveFilePath string, testTooth testToothVersion) tooth.Archive {
+	prefixToothRepoPaths := func(versionRanges map[string]string) map[string]string {
+		prefixed := make(map[string]string)
+		for name, versionRange := range versionRanges {
+			prefixed["example.com/"+name] = versionRange
+		}
+		return prefixed
+	}
+
+	toothJSONBytes, err := json.Marshal(tooth.RawMetadata{
+		FormatVersion: 2,
+		Tooth:         "example.com/" + testTooth.name,
+		Version:       testTooth.version,
+		Info: tooth.RawMetadataInfo{
+			Name:        testTooth.name,
+			Description: "A tooth for testing.",
+			Author:      "lippkg",
+			Tags:        []string{},
+		},
+		Dependencies: prefixToothRepoPaths(testTooth.dependencies),
+		Conflicts:    prefixToothRepoPaths(testTooth.conflicts),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Create(archiveFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	writer := gozip.NewWriter(file)
+
+	toothJSONWriter, err := writer.Create(testTooth.name + "/tooth.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := toothJSONWriter.Write(toothJSONBytes); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := tooth.MakeArchive(path.MustParse(archiveFilePath))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return archive
+}
+
+// checkResolveResult checks the archives returned by the resolver, given as
+// "toothRepoPath@version", or the error if wantErr is not empty.
+func checkResolveResult(t *testing.T, archives []tooth.Archive, err error, want []string, wantErr string) {
+	if wantErr != "" {
+		if err == nil || err.Error() != wantErr {
+			t.Errorf("error = %v, want %v", err, wantErr)
+		}
+		return
+	} else if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+
+	got := make([]string, 0, len(archives))
+	for _, archive := range archives {
+		got = append(got, archive.Metadata().ToothRepoPath()+"@"+archive.Metadata().Version().String())
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("archives = %v, want %v", got, want)
+	}
+}
@@ -20,24 +20,9 @@ func downloadToothRepoSpecifier(ctx *context.Context,
 
 	toothRepoPath := must.Must(specifier.ToothRepoPath())
 
-	// Parse or get the tooth version.
-
-	var toothVersion semver.Version
-	isToothVersionSpecified, err := specifier.IsToothVersionSpecified()
+	toothVersion, err := getSpecifiedToothVersion(ctx, specifier)
 	if err != nil {
-		return tooth.Archive{}, fmt.Errorf("failed to get is tooth version specified\n\t%w", err)
-	}
-
-	if isToothVersionSpecified {
-		toothVersion = must.Must(specifier.ToothVersion())
-
-	} else {
-		latestVersion, err := tooth.GetLatestVersion(ctx, toothRepoPath)
-		if err != nil {
-			return tooth.Archive{}, fmt.Errorf("failed to look up tooth version\n\t%w", err)
-		}
-
-		toothVersion = latestVersion
+		return tooth.Archive{}, fmt.Errorf("failed to look up tooth version\n\t%w", err)
 	}
 
 	archive, err := downloadToothArchiveIfNotCached(ctx, toothRepoPath, toothVersion)
@@ -49,41 +34,120 @@ func downloadToothRepoSpecifier(ctx *context.Context,
 	return archive, nil
 }
 
-// resolveSpecifiers parses the specifier string list and
-// downloads the tooth specified by the specifier, and returns the list of
-// downloaded tooth archives.
-func resolveSpecifiers(ctx *context.Context,
-	specifiers []specifierpkg.Specifier) ([]tooth.Archive, error) {
+// getSpecifiedToothVersion returns the version of the tooth selected by the tooth repo
+// specifier.
+func getSpecifiedToothVersion(ctx *context.Context, specifier specifierpkg.Specifier) (semver.Version,
+	error) {
+	toothRepoPath := must.Must(specifier.ToothRepoPath())
+
+	versionKind := must.Must(specifier.VersionKind())
 
-	archiveList := make([]tooth.Archive, 0)
+	switch versionKind {
+	case specifierpkg.UnspecifiedVersionKind:
+		return tooth.GetLatestVersion(ctx, toothRepoPath)
 
-	for _, specifier := range specifiers {
-		var archive tooth.Archive
+	case specifierpkg.ExactVersionKind:
+		return must.Must(specifier.ToothVersion()), nil
 
-		switch specifier.Kind() {
-		case specifierpkg.ToothArchiveKind:
-			archivePath := must.Must(specifier.ToothArchivePath())
-			localArchive, err := tooth.MakeArchive(archivePath)
+	case specifierpkg.VersionRangeKind:
+		versionRange := must.Must(specifier.ToothVersionRange())
+		return tooth.GetLatestVersionInVersionRange(ctx, toothRepoPath, versionRange)
+
+	case specifierpkg.DistTagKind:
+		switch must.Must(specifier.DistTag()) {
+		case specifierpkg.DistTagLatest:
+			return tooth.GetLatestVersion(ctx, toothRepoPath)
+
+		case specifierpkg.DistTagLatestPre:
+			availableVersions, err := tooth.GetAvailableVersions(ctx, toothRepoPath)
 			if err != nil {
-				return nil, fmt.Errorf("failed to open archive %v\n\t%w", archivePath.LocalString(), err)
+				return semver.Version{}, fmt.Errorf("failed to get available version list\n\t%w", err)
 			}
 
-			archive = localArchive
+			if len(availableVersions) == 0 {
+				return semver.Version{}, fmt.Errorf("no available version found")
+			}
+
+			semver.Sort(availableVersions)
+
+			return availableVersions[len(availableVersions)-1], nil
 
-		case specifierpkg.ToothRepoKind:
-			downloadedArchive, err := downloadToothRepoSpecifier(ctx, specifier)
+		case specifierpkg.DistTagInstalled:
+			isInstalled, err := tooth.IsInstalled(ctx, toothRepoPath)
 			if err != nil {
-				return nil, fmt.Errorf("failed to download specifier %v\n\t%w", specifier, err)
+				return semver.Version{}, fmt.Errorf("failed to check if tooth is installed\n\t%w", err)
 			}
 
-			archive = downloadedArchive
+			if !isInstalled {
+				return semver.Version{}, fmt.Errorf("tooth %v is not installed", toothRepoPath)
+			}
 
-		default:
-			panic("unreachable")
+			metadata, err := tooth.GetMetadata(ctx, toothRepoPath)
+			if err != nil {
+				return semver.Version{}, fmt.Errorf("failed to find installed tooth metadata\n\t%w", err)
+			}
+
+			return metadata.Version(), nil
 		}
+	}
 
-		archiveList = append(archiveList, archive)
+	// Never reached.
+	panic("unreachable")
+}
+
+// resolveSpecifiers parses the specifier string list and
+// downloads the tooth specified by the specifier, and returns the list of
+// downloaded tooth archives. specifierOrigins tells where each specifier comes from,
+// e.g. "requirements.txt:3", and is empty for specifiers from arguments.
+func resolveSpecifiers(ctx *context.Context, specifiers []specifierpkg.Specifier,
+	specifierOrigins []string) ([]tooth.Archive, error) {
+
+	archiveList := make([]tooth.Archive, len(specifiers))
+
+	// Remote tooth archives are downloaded concurrently.
+	err := runConcurrently(ctx, len(specifiers), func(i int) error {
+		archive, err := resolveSpecifier(ctx, specifiers[i])
+		if err != nil && specifierOrigins[i] != "" {
+			return fmt.Errorf("%v: failed to resolve specifier %v\n\t%w", specifierOrigins[i], specifiers[i], err)
+		} else if err != nil {
+			return err
+		}
+
+		archiveList[i] = archive
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return archiveList, nil
 }
+
+// resolveSpecifier opens the tooth archive specified by the specifier, downloading it
+// if it is in a tooth repository. The features in the specifier are enabled, together
+// with those enabled in the installed version.
+func resolveSpecifier(ctx *context.Context, specifier specifierpkg.Specifier) (tooth.Archive, error) {
+	var archive tooth.Archive
+
+	switch specifier.Kind() {
+	case specifierpkg.ToothArchiveKind:
+		archivePath := must.Must(specifier.ToothArchivePath())
+		localArchive, err := tooth.MakeArchive(archivePath)
+		if err != nil {
+			return tooth.Archive{}, fmt.Errorf("failed to open archive %v\n\t%w", archivePath.LocalString(), err)
+		}
+
+		archive = localArchive
+
+	case specifierpkg.ToothRepoKind:
+		downloadedArchive, err := downloadToothRepoSpecifier(ctx, specifier)
+		if err != nil {
+			return tooth.Archive{}, fmt.Errorf("failed to download specifier %v\n\t%w", specifier, err)
+		}
+
+		archive = downloadedArchive
+	}
+
+	return enableFeatures(ctx, archive, specifier.Features())
+}
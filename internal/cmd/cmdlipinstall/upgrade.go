@@ -0,0 +1,109 @@
+package cmdlipinstall
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/lippkg/lip/internal/context"
+	"github.com/lippkg/lip/internal/tooth"
+	log "github.com/sirupsen/logrus"
+)
+
+// Upgrade upgrades the installed teeth to the newest versions satisfying the version
+// ranges required by each other, by their new dependencies and by the installed teeth
+// not upgraded. If toothRepoPaths is empty, every installed tooth is upgraded. The
+// versions are resolved together and installed in one transaction, and every tooth
+// keeps its install reason. The caller must hold the workspace lock unless dryRun is
+// true.
+func Upgrade(ctx *context.Context, toothRepoPaths []string, yes bool, dryRun bool, jsonFlag bool,
+	allowOverwrite bool, ignoreScripts bool) error {
+	debugLogger := log.WithFields(log.Fields{
+		"package": "cmdlipinstall",
+		"method":  "Upgrade",
+	})
+
+	metadataList, err := tooth.GetAllMetadata(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list all installed teeth\n\t%w", err)
+	}
+
+	installedMetadata := make(map[string]tooth.Metadata)
+	for _, metadata := range metadataList {
+		installedMetadata[metadata.ToothRepoPath()] = metadata
+	}
+
+	if len(toothRepoPaths) == 0 {
+		for toothRepoPath := range installedMetadata {
+			toothRepoPaths = append(toothRepoPaths, toothRepoPath)
+		}
+		sort.Strings(toothRepoPaths)
+	}
+
+	upgradedMetadataList := make([]tooth.Metadata, 0, len(toothRepoPaths))
+	for _, toothRepoPath := range toothRepoPaths {
+		metadata, ok := installedMetadata[toothRepoPath]
+		if !ok {
+			return fmt.Errorf("tooth %v is not installed", toothRepoPath)
+		}
+
+		upgradedMetadataList = append(upgradedMetadataList, metadata)
+	}
+
+	// The installed teeth not upgraded keep their versions.
+	fixedMetadata := make(map[string]tooth.Metadata)
+	fixedReasons := make(map[string]string)
+	for toothRepoPath, metadata := range installedMetadata {
+		fixedMetadata[toothRepoPath] = metadata
+		fixedReasons[toothRepoPath] = "installed"
+	}
+	for _, toothRepoPath := range toothRepoPaths {
+		delete(fixedMetadata, toothRepoPath)
+		delete(fixedReasons, toothRepoPath)
+	}
+
+	log.Info("Looking up new versions and resolving dependencies...")
+
+	resolver := newDependencyResolver(ctx, fixedMetadata, fixedReasons)
+
+	resolvedArchives, err := resolver.resolveUpgrade(upgradedMetadataList)
+	if err != nil {
+		return fmt.Errorf("failed to find versions satisfying all dependencies\n\t%w", err)
+	}
+
+	archives := make([]tooth.Archive, 0)
+	for _, archive := range resolvedArchives {
+		toothRepoPath := archive.Metadata().ToothRepoPath()
+
+		metadata, isInstalled := installedMetadata[toothRepoPath]
+		if isInstalled && archive.Metadata().Version().EQ(metadata.Version()) {
+			continue
+		}
+
+		if isInstalled {
+			debugLogger.Debugf("Tooth %v can be upgraded from %v to %v", toothRepoPath, metadata.Version(),
+				archive.Metadata().Version())
+
+			// Warn about the installed features no longer available.
+			archive, err = enableFeatures(ctx, archive, nil)
+			if err != nil {
+				return err
+			}
+		}
+
+		archives = append(archives, archive)
+	}
+
+	if len(archives) == 0 {
+		log.Info("All teeth are up-to-date.")
+		return nil
+	}
+
+	return installArchives(ctx, archives, false, nil, FlagDict{
+		upgradeFlag:        true,
+		yesFlag:            yes,
+		dryRunFlag:         dryRun,
+		jsonFlag:           jsonFlag,
+		allowOverwriteFlag: allowOverwrite,
+		ignoreScriptsFlag:  ignoreScripts,
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/lippkg/lip/internal/context"
+	"github.com/lippkg/lip/internal/path"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/lippkg/lip/internal/tooth"
@@ -16,6 +17,7 @@ import (
 type FlagDict struct {
 	helpFlag       bool
 	upgradableFlag bool
+	ownerOfFlag    string
 	jsonFlag       bool
 }
 
@@ -29,6 +31,7 @@ Description:
 Options:
   -h, --help                  Show help.
   --upgradable                List upgradable teeth.
+  --owner-of <file>           List the tooth owning the file.
   --json                      Output in JSON format.
 `
 
@@ -45,6 +48,7 @@ func Run(ctx *context.Context, args []string) error {
 	flagSet.BoolVar(&flagDict.helpFlag, "help", false, "")
 	flagSet.BoolVar(&flagDict.helpFlag, "h", false, "")
 	flagSet.BoolVar(&flagDict.upgradableFlag, "upgradable", false, "")
+	flagSet.StringVar(&flagDict.ownerOfFlag, "owner-of", "", "")
 	flagSet.BoolVar(&flagDict.jsonFlag, "json", false, "")
 	err := flagSet.Parse(args)
 	if err != nil {
@@ -62,7 +66,15 @@ func Run(ctx *context.Context, args []string) error {
 		return fmt.Errorf("unexpected arguments: %v", flagSet.Args())
 	}
 
-	if flagDict.upgradableFlag {
+	if flagDict.ownerOfFlag != "" {
+		err := listOwnerOf(ctx, flagDict.ownerOfFlag, flagDict.jsonFlag)
+		if err != nil {
+			return fmt.Errorf("failed to list the tooth owning %v\n\t%w", flagDict.ownerOfFlag, err)
+		}
+
+		return nil
+
+	} else if flagDict.upgradableFlag {
 		err := listUpgradable(ctx, flagDict.jsonFlag)
 		if err != nil {
 			return fmt.Errorf("failed to list upgradable teeth\n\t%w", err)
@@ -127,6 +139,70 @@ func listAll(ctx *context.Context, jsonFlag bool) error {
 	return nil
 }
 
+// listOwnerOf lists the tooth owning the file.
+func listOwnerOf(ctx *context.Context, filePathString string, jsonFlag bool) error {
+
+	filePath, err := path.Parse(filePathString)
+	if err != nil {
+		return fmt.Errorf("failed to parse file path %v\n\t%w", filePathString, err)
+	}
+
+	metadataList := make([]tooth.Metadata, 0)
+
+	owner, isOwned, err := tooth.GetFileOwner(ctx, filePath)
+	if err != nil {
+		return fmt.Errorf("failed to get file owner\n\t%w", err)
+	}
+
+	if isOwned {
+		metadata, err := tooth.GetMetadata(ctx, owner)
+		if err != nil {
+			return fmt.Errorf("failed to find installed tooth metadata\n\t%w", err)
+		}
+
+		metadataList = append(metadataList, metadata)
+	} else {
+		log.Infof("File %v is not owned by any installed tooth", filePath)
+	}
+
+	if jsonFlag {
+		// Marshal the data.
+		jsonBytes, err := json.Marshal(metadataList)
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON\n\t%w", err)
+		}
+
+		jsonString := string(jsonBytes)
+		fmt.Print(jsonString)
+	} else {
+		tableData := make([][]string, 0)
+		for _, metadata := range metadataList {
+			tableData = append(tableData, []string{
+				metadata.ToothRepoPath(),
+				metadata.Info().Name,
+				metadata.Version().String(),
+				filePath.String(),
+			})
+		}
+
+		tableString := &strings.Builder{}
+		table := tablewriter.NewWriter(tableString)
+		table.SetHeader([]string{
+			"Tooth", "Name", "Version", "File",
+		})
+
+		for _, row := range tableData {
+			table.Append(row)
+		}
+
+		table.Render()
+
+		fmt.Print(tableString.String())
+	}
+
+	return nil
+}
+
 // listUpgradable lists upgradable teeth.
 func listUpgradable(ctx *context.Context, jsonFlag bool) error {
 
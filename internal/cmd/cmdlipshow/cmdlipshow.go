@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/lippkg/lip/internal/context"
@@ -15,6 +16,7 @@ import (
 type FlagDict struct {
 	helpFlag      bool
 	availableFlag bool
+	filesFlag     bool
 	jsonFlag      bool
 }
 
@@ -28,6 +30,7 @@ Description:
 Options:
   -h, --help                  Show help.
   --available                 Show the full list of available versions.
+  --files                     Show the files owned by the tooth.
   --json                      Output in JSON format.
 `
 
@@ -44,6 +47,7 @@ func Run(ctx *context.Context, args []string) error {
 	flagSet.BoolVar(&flagDict.helpFlag, "help", false, "")
 	flagSet.BoolVar(&flagDict.helpFlag, "h", false, "")
 	flagSet.BoolVar(&flagDict.availableFlag, "available", false, "")
+	flagSet.BoolVar(&flagDict.filesFlag, "files", false, "")
 	flagSet.BoolVar(&flagDict.jsonFlag, "json", false, "")
 	err := flagSet.Parse(args)
 	if err != nil {
@@ -63,7 +67,7 @@ func Run(ctx *context.Context, args []string) error {
 
 	toothRepoPath := flagSet.Arg(0)
 
-	if err := show(ctx, toothRepoPath, flagDict.availableFlag, flagDict.jsonFlag); err != nil {
+	if err := show(ctx, toothRepoPath, flagDict.availableFlag, flagDict.filesFlag, flagDict.jsonFlag); err != nil {
 		return fmt.Errorf("failed to show JSON\n\t%w", err)
 	}
 
@@ -95,7 +99,7 @@ func checkIsInstalledAndGetMetadata(ctx *context.Context,
 }
 
 func show(ctx *context.Context, toothRepoPath string,
-	availableFlag bool, jsonFlag bool) error {
+	availableFlag bool, filesFlag bool, jsonFlag bool) error {
 
 	isInstalled, metadata, err := checkIsInstalledAndGetMetadata(ctx, toothRepoPath)
 	if err != nil {
@@ -118,17 +122,42 @@ func show(ctx *context.Context, toothRepoPath string,
 		return fmt.Errorf("tooth is not installed")
 	}
 
+	installReason := ""
+	if isInstalled {
+		installReason, err = tooth.GetInstallReason(ctx, toothRepoPath)
+		if err != nil {
+			return fmt.Errorf("failed to get install reason\n\t%w", err)
+		}
+	}
+
+	ownedFiles := make([]string, 0)
+	if filesFlag && isInstalled {
+		ownedFilePaths, err := tooth.GetOwnedFiles(ctx, toothRepoPath)
+		if err != nil {
+			return fmt.Errorf("failed to get owned files\n\t%w", err)
+		}
+
+		for _, ownedFilePath := range ownedFilePaths {
+			ownedFiles = append(ownedFiles, ownedFilePath.String())
+		}
+	}
+
 	if jsonFlag {
 		info := make(map[string]interface{})
 
 		if isInstalled {
 			info["metadata"] = metadata
+			info["install_reason"] = installReason
 		}
 
 		if availableFlag {
 			info["available_versions"] = availableVersions
 		}
 
+		if filesFlag && isInstalled {
+			info["files"] = ownedFiles
+		}
+
 		jsonBytes, err := json.Marshal(info)
 		if err != nil {
 			return fmt.Errorf("failed to marshal JSON\n\t%w", err)
@@ -147,7 +176,21 @@ func show(ctx *context.Context, toothRepoPath string,
 				{"Author", metadata.Info().Author},
 				{"Tags", strings.Join(metadata.Info().Tags, ", ")},
 				{"Version", metadata.Version().String()},
+				{"Install Reason", installReason},
 			}...)
+
+			features := make([]string, 0)
+			for feature := range metadata.Features() {
+				features = append(features, feature)
+			}
+			sort.Strings(features)
+
+			if len(features) != 0 {
+				tableData = append(tableData, [][]string{
+					{"Features", strings.Join(features, ", ")},
+					{"Enabled Features", strings.Join(metadata.EnabledFeatures(), ", ")},
+				}...)
+			}
 		}
 
 		if availableFlag {
@@ -155,6 +198,10 @@ func show(ctx *context.Context, toothRepoPath string,
 				strings.Join(availableVersions, ", ")})
 		}
 
+		if filesFlag && isInstalled {
+			tableData = append(tableData, []string{"Files", strings.Join(ownedFiles, "\n")})
+		}
+
 		tableString := &strings.Builder{}
 		table := tablewriter.NewWriter(tableString)
 		table.SetHeader([]string{"Key", "Value"})
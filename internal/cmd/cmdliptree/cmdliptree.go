@@ -0,0 +1,448 @@
+package cmdliptree
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lippkg/lip/internal/context"
+	"github.com/lippkg/lip/internal/tooth"
+)
+
+type FlagDict struct {
+	helpFlag    bool
+	reverseFlag bool
+	jsonFlag    bool
+	dotFlag     bool
+}
+
+const helpMessage = `
+Usage:
+  lip tree [options] [<tooth repository URL> [...]]
+
+Description:
+  Show the dependency graph of installed teeth.
+
+Options:
+  -h, --help                  Show help.
+  --reverse                   Show the teeth depending on each tooth instead.
+  --json                      Output in JSON format.
+  --dot                       Output in Graphviz DOT format.
+`
+
+// treeNode is a tooth in the dependency tree.
+type treeNode struct {
+	Tooth string `json:"tooth"`
+	// Version is empty if the tooth is not installed.
+	Version string `json:"version"`
+	// VersionRange is the version range of the dependency between the tooth and its
+	// parent. It is empty for root nodes.
+	VersionRange string `json:"version_range,omitempty"`
+	// Requirement is the tooth the dependency is declared on, if it is a virtual tooth
+	// provided by the tooth (or with reverse, by the parent).
+	Requirement string `json:"requirement,omitempty"`
+	// Missing tells whether the dependency is not installed.
+	Missing bool `json:"missing,omitempty"`
+	// Unmet tells whether the installed version is out of VersionRange.
+	Unmet bool `json:"unmet,omitempty"`
+	// Cycle tells whether the tooth is already an ancestor of this node, in which case
+	// its children are not shown again.
+	Cycle        bool       `json:"cycle,omitempty"`
+	Dependencies []treeNode `json:"dependencies,omitempty"`
+	Dependents   []treeNode `json:"dependents,omitempty"`
+}
+
+// dependencyGraph is the dependency graph of installed teeth.
+type dependencyGraph struct {
+	metadataMap map[string]tooth.Metadata
+	// dependencies maps each installed tooth to the sorted teeth it depends on.
+	dependencies map[string][]string
+	// dependencyTargets maps each installed tooth and its dependencies to the teeth
+	// satisfying them, which are the teeth providing them for virtual teeth.
+	dependencyTargets map[string]map[string]string
+	// dependents maps each installed tooth to the sorted installed teeth depending on it.
+	dependents map[string][]string
+}
+
+func Run(ctx *context.Context, args []string) error {
+
+	flagSet := flag.NewFlagSet("tree", flag.ContinueOnError)
+
+	// Rewrite the default usage message.
+	flagSet.Usage = func() {
+		// Do nothing.
+	}
+
+	var flagDict FlagDict
+	flagSet.BoolVar(&flagDict.helpFlag, "help", false, "")
+	flagSet.BoolVar(&flagDict.helpFlag, "h", false, "")
+	flagSet.BoolVar(&flagDict.reverseFlag, "reverse", false, "")
+	flagSet.BoolVar(&flagDict.jsonFlag, "json", false, "")
+	flagSet.BoolVar(&flagDict.dotFlag, "dot", false, "")
+	err := flagSet.Parse(args)
+	if err != nil {
+		return fmt.Errorf("failed to parse flags\n\t%w", err)
+	}
+
+	// Help flag has the highest priority.
+	if flagDict.helpFlag {
+		fmt.Print(helpMessage)
+		return nil
+	}
+
+	if flagDict.jsonFlag && flagDict.dotFlag {
+		return fmt.Errorf("--json and --dot cannot be used together")
+	}
+
+	graph, err := getDependencyGraph(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get dependency graph\n\t%w", err)
+	}
+
+	roots := flagSet.Args()
+	for _, toothRepoPath := range roots {
+		if _, ok := graph.metadataMap[toothRepoPath]; !ok {
+			return fmt.Errorf("tooth %v is not installed", toothRepoPath)
+		}
+	}
+
+	if len(roots) == 0 {
+		roots = graph.defaultRoots(flagDict.reverseFlag)
+	}
+
+	trees := make([]treeNode, 0, len(roots))
+	for _, root := range roots {
+		trees = append(trees, graph.makeTree(root, "", flagDict.reverseFlag, make(map[string]bool)))
+	}
+
+	if flagDict.jsonFlag {
+		jsonBytes, err := json.Marshal(trees)
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON\n\t%w", err)
+		}
+
+		fmt.Print(string(jsonBytes))
+
+	} else if flagDict.dotFlag {
+		fmt.Print(formatDot(trees, flagDict.reverseFlag))
+
+	} else {
+		fmt.Print(formatTrees(trees, flagDict.reverseFlag))
+	}
+
+	return nil
+}
+
+// ---------------------------------------------------------------------
+
+// getDependencyGraph builds the dependency graph from the metadata of installed teeth.
+func getDependencyGraph(ctx *context.Context) (dependencyGraph, error) {
+	metadataList, err := tooth.GetAllMetadata(ctx)
+	if err != nil {
+		return dependencyGraph{}, fmt.Errorf("failed to list all installed tooth metadata\n\t%w", err)
+	}
+
+	graph := dependencyGraph{
+		metadataMap:       make(map[string]tooth.Metadata),
+		dependencies:      make(map[string][]string),
+		dependencyTargets: make(map[string]map[string]string),
+	}
+
+	for _, metadata := range metadataList {
+		graph.metadataMap[metadata.ToothRepoPath()] = metadata
+	}
+
+	for _, metadata := range metadataList {
+		dependencyTargets, err := tooth.MapDependenciesToInstalled(metadata, metadataList)
+		if err != nil {
+			return dependencyGraph{}, err
+		}
+
+		dependencies := make([]string, 0)
+		for dep := range dependencyTargets {
+			dependencies = append(dependencies, dep)
+		}
+
+		sort.Strings(dependencies)
+		graph.dependencies[metadata.ToothRepoPath()] = dependencies
+		graph.dependencyTargets[metadata.ToothRepoPath()] = dependencyTargets
+	}
+
+	graph.dependents, err = tooth.GetReverseDependencies(ctx)
+	if err != nil {
+		return dependencyGraph{}, fmt.Errorf("failed to get reverse dependencies\n\t%w", err)
+	}
+
+	return graph, nil
+}
+
+// defaultRoots returns the teeth to show when none are specified, i.e. installed teeth
+// no installed tooth depends on, or with reverse, installed teeth depending on no
+// installed tooth. Teeth only reachable through a dependency cycle are added as well so
+// that every installed tooth is shown.
+func (g dependencyGraph) defaultRoots(reverse bool) []string {
+	toothRepoPaths := make([]string, 0, len(g.metadataMap))
+	for toothRepoPath := range g.metadataMap {
+		toothRepoPaths = append(toothRepoPaths, toothRepoPath)
+	}
+	sort.Strings(toothRepoPaths)
+
+	roots := make([]string, 0)
+	reached := make(map[string]bool)
+	for _, toothRepoPath := range toothRepoPaths {
+		if len(g.installedChildren(toothRepoPath, !reverse)) == 0 {
+			roots = append(roots, toothRepoPath)
+			g.markReachable(toothRepoPath, reverse, reached)
+		}
+	}
+
+	for _, toothRepoPath := range toothRepoPaths {
+		if !reached[toothRepoPath] {
+			roots = append(roots, toothRepoPath)
+			g.markReachable(toothRepoPath, reverse, reached)
+		}
+	}
+
+	return roots
+}
+
+// installedChildren returns the installed dependencies of the tooth, or with reverse,
+// the installed teeth depending on it.
+func (g dependencyGraph) installedChildren(toothRepoPath string, reverse bool) []string {
+	if reverse {
+		return g.dependents[toothRepoPath]
+	}
+
+	children := make([]string, 0)
+	for _, dep := range g.dependencies[toothRepoPath] {
+		target := g.dependencyTargets[toothRepoPath][dep]
+		if _, ok := g.metadataMap[target]; ok {
+			children = append(children, target)
+		}
+	}
+
+	return children
+}
+
+func (g dependencyGraph) markReachable(toothRepoPath string, reverse bool, reached map[string]bool) {
+	if reached[toothRepoPath] {
+		return
+	}
+
+	reached[toothRepoPath] = true
+	for _, child := range g.installedChildren(toothRepoPath, reverse) {
+		g.markReachable(child, reverse, reached)
+	}
+}
+
+// makeTree makes the tree rooted at the tooth. versionRange is the version range of the
+// dependency between the tooth and its parent, and ancestors holds the teeth on the path
+// from the root to guard against dependency cycles.
+func (g dependencyGraph) makeTree(toothRepoPath string, versionRange string, reverse bool,
+	ancestors map[string]bool) treeNode {
+
+	node := treeNode{
+		Tooth:        toothRepoPath,
+		VersionRange: versionRange,
+	}
+
+	metadata, ok := g.metadataMap[toothRepoPath]
+	if !ok {
+		node.Missing = true
+		return node
+	}
+
+	node.Version = metadata.Version().String()
+
+	if ancestors[toothRepoPath] {
+		node.Cycle = true
+		return node
+	}
+
+	ancestors[toothRepoPath] = true
+	defer delete(ancestors, toothRepoPath)
+
+	if reverse {
+		node.Dependents = make([]treeNode, 0)
+		for _, dependent := range g.dependents[toothRepoPath] {
+			// Find the dependency of the dependent satisfied by the tooth.
+			dep := toothRepoPath
+			for _, dependentDep := range g.dependencies[dependent] {
+				if g.dependencyTargets[dependent][dependentDep] == toothRepoPath {
+					dep = dependentDep
+					break
+				}
+			}
+
+			childVersionRange := g.metadataMap[dependent].DependenciesAsStrings()[dep]
+
+			child := g.makeTree(dependent, childVersionRange, reverse, ancestors)
+			child.Unmet = !g.isSatisfied(dependent, dep)
+			if dep != toothRepoPath {
+				child.Requirement = dep
+			}
+			node.Dependents = append(node.Dependents, child)
+		}
+
+	} else {
+		node.Dependencies = make([]treeNode, 0)
+		for _, dep := range g.dependencies[toothRepoPath] {
+			childVersionRange := metadata.DependenciesAsStrings()[dep]
+			target := g.dependencyTargets[toothRepoPath][dep]
+
+			child := g.makeTree(target, childVersionRange, reverse, ancestors)
+			child.Unmet = !child.Missing && !g.isSatisfied(toothRepoPath, dep)
+			if target != dep {
+				child.Requirement = dep
+			}
+			node.Dependencies = append(node.Dependencies, child)
+		}
+	}
+
+	return node
+}
+
+// isSatisfied tells whether the installed version of dep, or the version provided by
+// the tooth providing it, is in the version range required by the installed tooth.
+func (g dependencyGraph) isSatisfied(toothRepoPath string, dep string) bool {
+	targetMetadata, ok := g.metadataMap[g.dependencyTargets[toothRepoPath][dep]]
+	if !ok {
+		return false
+	}
+
+	dependencies, err := g.metadataMap[toothRepoPath].Dependencies()
+	if err != nil {
+		return false
+	}
+
+	versionRange, ok := dependencies[dep]
+	if !ok {
+		return false
+	}
+
+	satisfies, err := targetMetadata.Satisfies(dep, versionRange)
+	return err == nil && satisfies
+}
+
+// formatTrees formats the trees as text with box-drawing characters.
+func formatTrees(trees []treeNode, reverse bool) string {
+	builder := &strings.Builder{}
+
+	for _, tree := range trees {
+		builder.WriteString(formatNode(tree, reverse))
+		builder.WriteString("\n")
+		formatChildren(builder, children(tree, reverse), "", reverse)
+	}
+
+	return builder.String()
+}
+
+func formatChildren(builder *strings.Builder, nodes []treeNode, prefix string, reverse bool) {
+	for i, node := range nodes {
+		connector, childPrefix := "├── ", "│   "
+		if i == len(nodes)-1 {
+			connector, childPrefix = "└── ", "    "
+		}
+
+		builder.WriteString(prefix + connector + formatNode(node, reverse) + "\n")
+		formatChildren(builder, children(node, reverse), prefix+childPrefix, reverse)
+	}
+}
+
+// formatNode formats a node in one line, e.g. "example.com/foo@1.0.0 (requires 1.x)".
+func formatNode(node treeNode, reverse bool) string {
+	text := node.Tooth
+	if !node.Missing {
+		text += "@" + node.Version
+	}
+
+	if node.VersionRange != "" {
+		versionRange := node.VersionRange
+		if node.Requirement != "" {
+			versionRange = node.Requirement + " " + versionRange
+		}
+
+		if reverse {
+			text += fmt.Sprintf(" (requires %v)", versionRange)
+		} else {
+			text += fmt.Sprintf(" (required %v)", versionRange)
+		}
+	}
+
+	if node.Missing {
+		text += " [MISSING]"
+	} else if node.Unmet {
+		text += " [UNMET]"
+	}
+
+	if node.Cycle {
+		text += " [CYCLE]"
+	}
+
+	return text
+}
+
+func children(node treeNode, reverse bool) []treeNode {
+	if reverse {
+		return node.Dependents
+	}
+
+	return node.Dependencies
+}
+
+// formatDot formats the trees as a Graphviz digraph. Edges point from each tooth to its
+// dependencies, or with reverse, to the teeth depending on it. Missing teeth are drawn
+// dashed and unmet dependencies red.
+func formatDot(trees []treeNode, reverse bool) string {
+	builder := &strings.Builder{}
+	builder.WriteString("digraph {\n")
+
+	writtenNodes := make(map[string]bool)
+	writtenEdges := make(map[string]bool)
+
+	var visit func(node treeNode)
+	visit = func(node treeNode) {
+		if !writtenNodes[node.Tooth] {
+			writtenNodes[node.Tooth] = true
+
+			if node.Missing {
+				builder.WriteString(fmt.Sprintf("  %q [label=%q, style=dashed];\n", node.Tooth,
+					node.Tooth+"\n(missing)"))
+			} else {
+				builder.WriteString(fmt.Sprintf("  %q [label=%q];\n", node.Tooth,
+					node.Tooth+"\n"+node.Version))
+			}
+		}
+
+		for _, child := range children(node, reverse) {
+			edge := fmt.Sprintf("%q -> %q", node.Tooth, child.Tooth)
+			if !writtenEdges[edge] {
+				writtenEdges[edge] = true
+
+				label := child.VersionRange
+				if child.Requirement != "" {
+					label = child.Requirement + " " + label
+				}
+
+				attributes := fmt.Sprintf("label=%q", label)
+				if child.Missing || child.Unmet {
+					attributes += ", color=red, fontcolor=red"
+				}
+
+				builder.WriteString(fmt.Sprintf("  %v [%v];\n", edge, attributes))
+			}
+
+			visit(child)
+		}
+	}
+
+	for _, tree := range trees {
+		visit(tree)
+	}
+
+	builder.WriteString("}\n")
+
+	return builder.String()
+}
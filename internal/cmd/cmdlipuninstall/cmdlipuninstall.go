@@ -3,17 +3,22 @@ package cmdlipuninstall
 import (
 	"flag"
 	"fmt"
+	"strings"
 
 	"github.com/lippkg/lip/internal/context"
 	"github.com/lippkg/lip/internal/install"
+	"github.com/lippkg/lip/internal/prompt"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/lippkg/lip/internal/tooth"
 )
 
 type FlagDict struct {
-	helpFlag bool
-	yesFlag  bool
+	helpFlag          bool
+	yesFlag           bool
+	cascadeFlag       bool
+	waitLockFlag      bool
+	ignoreScriptsFlag bool
 }
 
 const helpMessage = `
@@ -26,6 +31,10 @@ Description:
 Options:
   -h, --help                  Show help.
   -y, --yes                   Skip confirmation.
+  --cascade                   Also uninstall installed teeth depending on the specified teeth.
+  --wait-lock                 Wait for other lip processes using the workspace instead of failing.
+  --ignore-scripts, --no-scripts
+                              Do not run commands in tooth.json.
 `
 
 func Run(ctx *context.Context, args []string) error {
@@ -42,6 +51,10 @@ func Run(ctx *context.Context, args []string) error {
 	flagSet.BoolVar(&flagDict.helpFlag, "h", false, "")
 	flagSet.BoolVar(&flagDict.yesFlag, "yes", false, "")
 	flagSet.BoolVar(&flagDict.yesFlag, "y", false, "")
+	flagSet.BoolVar(&flagDict.cascadeFlag, "cascade", false, "")
+	flagSet.BoolVar(&flagDict.waitLockFlag, "wait-lock", false, "")
+	flagSet.BoolVar(&flagDict.ignoreScriptsFlag, "ignore-scripts", false, "")
+	flagSet.BoolVar(&flagDict.ignoreScriptsFlag, "no-scripts", false, "")
 	err := flagSet.Parse(args)
 	if err != nil {
 		return fmt.Errorf("failed to parse flags\n\t%w", err)
@@ -58,6 +71,13 @@ func Run(ctx *context.Context, args []string) error {
 		return fmt.Errorf("at least one specifier is required")
 	}
 
+	// Prevent other lip processes from changing the workspace.
+	workspaceLock, err := install.LockWorkspace(ctx, flagDict.waitLockFlag)
+	if err != nil {
+		return err
+	}
+	defer workspaceLock.Release()
+
 	toothRepoPathList := flagSet.Args()
 
 	// 1. Check if all teeth are installed.
@@ -74,24 +94,61 @@ func Run(ctx *context.Context, args []string) error {
 		}
 	}
 
-	// 2. Prompt for confirmation.
+	// 2. Check teeth depending on the teeth to uninstall, and sort them so that
+	// dependents are uninstalled before their dependencies.
+
+	toothRepoPathList, err = collectTeethToUninstall(ctx, toothRepoPathList, flagDict.cascadeFlag)
+	if err != nil {
+		return err
+	}
+
+	// 3. Prompt for confirmation, listing the commands to run.
+
+	hookCommands := make([]install.HookCommand, 0)
+	if !flagDict.ignoreScriptsFlag {
+		hookCommands, err = install.GetTeethUninstallHookCommands(ctx, toothRepoPathList)
+		if err != nil {
+			return fmt.Errorf("failed to get hook commands\n\t%w", err)
+		}
+	}
 
 	if !flagDict.yesFlag {
-		err := askForConfirmation(ctx, toothRepoPathList)
+		err := askForConfirmation(ctx, toothRepoPathList, hookCommands)
 		if err != nil {
 			return err
 		}
 	}
 
-	// 3. Uninstall all teeth.
+	if err := install.ApproveHookCommands(ctx, hookCommands, flagDict.yesFlag); err != nil {
+		return fmt.Errorf("failed to approve hook commands\n\t%w", err)
+	}
+
+	// 4. Uninstall all teeth. If any of them fails, roll back all changes.
+
+	tx, err := install.NewTransaction(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction\n\t%w", err)
+	}
 
 	for _, toothRepoPath := range toothRepoPathList {
-		err := install.Uninstall(ctx, toothRepoPath)
+		err := install.Uninstall(ctx, tx, toothRepoPath, flagDict.ignoreScriptsFlag)
 		if err != nil {
+			tx.RollbackAndLog()
 			return fmt.Errorf("failed to uninstall tooth %v\n\t%w", toothRepoPath, err)
 		}
 	}
 
+	if err := install.SaveLockFile(ctx, tx); err != nil {
+		tx.RollbackAndLog()
+		return fmt.Errorf("failed to save lockfile\n\t%w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction\n\t%w", err)
+	}
+
+	install.WarnWorkspaceProblems(ctx)
+
 	log.Info("Done.")
 
 	return nil
@@ -99,9 +156,69 @@ func Run(ctx *context.Context, args []string) error {
 
 // ---------------------------------------------------------------------
 
-// askForConfirmation asks for confirmation before installing the tooth.
+// collectTeethToUninstall returns the teeth to uninstall in reverse topological order,
+// i.e. dependents before their dependencies. If cascade is true, installed teeth
+// depending on the teeth to uninstall are uninstalled as well. Otherwise an error
+// listing them is returned.
+func collectTeethToUninstall(ctx *context.Context, toothRepoPathList []string, cascade bool) ([]string, error) {
+	reverseDependencies, err := tooth.GetReverseDependencies(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reverse dependencies\n\t%w", err)
+	}
+
+	toUninstall := make(map[string]bool)
+	for _, toothRepoPath := range toothRepoPathList {
+		toUninstall[toothRepoPath] = true
+	}
+
+	if cascade {
+		queue := append([]string{}, toothRepoPathList...)
+		for len(queue) > 0 {
+			toothRepoPath := queue[0]
+			queue = queue[1:]
+
+			for _, dependent := range reverseDependencies[toothRepoPath] {
+				if !toUninstall[dependent] {
+					toUninstall[dependent] = true
+					queue = append(queue, dependent)
+				}
+			}
+		}
+
+	} else {
+		messages := make([]string, 0)
+		for _, toothRepoPath := range toothRepoPathList {
+			remainingDependents := make([]string, 0)
+			for _, dependent := range reverseDependencies[toothRepoPath] {
+				if !toUninstall[dependent] {
+					remainingDependents = append(remainingDependents, dependent)
+				}
+			}
+
+			if len(remainingDependents) != 0 {
+				messages = append(messages, fmt.Sprintf("%v is required by %v", toothRepoPath,
+					strings.Join(remainingDependents, ", ")))
+			}
+		}
+
+		if len(messages) != 0 {
+			return nil, fmt.Errorf("cannot uninstall teeth required by other installed teeth, use --cascade to "+
+				"uninstall them as well\n\t%v", strings.Join(messages, "\n\t"))
+		}
+	}
+
+	toothRepoPaths := make([]string, 0, len(toUninstall))
+	for toothRepoPath := range toUninstall {
+		toothRepoPaths = append(toothRepoPaths, toothRepoPath)
+	}
+
+	return install.SortForUninstall(ctx, toothRepoPaths)
+}
+
+// askForConfirmation asks for confirmation before installing the tooth, listing the hook
+// commands to run.
 func askForConfirmation(ctx *context.Context,
-	toothRepoPathList []string) error {
+	toothRepoPathList []string, hookCommands []install.HookCommand) error {
 
 	// Print the list of teeth to be installed.
 	log.Info("The following teeth will be uninstalled:")
@@ -115,11 +232,12 @@ func askForConfirmation(ctx *context.Context,
 			metadata.Info().Name)
 	}
 
+	install.LogHookCommands(hookCommands)
+
 	// Ask for confirmation.
-	log.Info("Do you want to continue? [y/N]")
-	var ans string
-	fmt.Scanln(&ans)
-	if ans != "y" && ans != "Y" {
+	if ok, err := prompt.Confirm(ctx, "Do you want to continue?"); err != nil {
+		return err
+	} else if !ok {
 		return fmt.Errorf("aborted")
 	}
 
@@ -0,0 +1,136 @@
+package cmdlipuninstall
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/blang/semver/v4"
+	"github.com/lippkg/lip/internal/context"
+	"github.com/lippkg/lip/internal/tooth"
+)
+
+func TestCollectTeethToUninstall(t *testing.T) {
+	// c depends on b, which depends on a. d depends on a.
+	installedDependencies := map[string][]string{
+		"example.com/a": nil,
+		"example.com/b": {"example.com/a"},
+		"example.com/c": {"example.com/b"},
+		"example.com/d": {"example.com/a"},
+		"example.com/e": nil,
+	}
+
+	testCases := []struct {
+		name           string
+		toothRepoPaths []string
+		cascade        bool
+		want           []string
+		wantErr        bool
+	}{
+		{
+			name:           "tooth without dependents",
+			toothRepoPaths: []string{"example.com/e"},
+			want:           []string{"example.com/e"},
+		},
+		{
+			name:           "required tooth",
+			toothRepoPaths: []string{"example.com/b"},
+			wantErr:        true,
+		},
+		{
+			name:           "required tooth with its dependents",
+			toothRepoPaths: []string{"example.com/a", "example.com/b", "example.com/c", "example.com/d"},
+			want:           []string{"example.com/c", "example.com/b", "example.com/d", "example.com/a"},
+		},
+		{
+			name:           "dependents specified first",
+			toothRepoPaths: []string{"example.com/c", "example.com/b"},
+			want:           []string{"example.com/c", "example.com/b"},
+		},
+		{
+			name:           "cascade",
+			toothRepoPaths: []string{"example.com/b"},
+			cascade:        true,
+			want:           []string{"example.com/c", "example.com/b"},
+		},
+		{
+			name:           "cascade to indirect dependents",
+			toothRepoPaths: []string{"example.com/a"},
+			cascade:        true,
+			want:           []string{"example.com/c", "example.com/b", "example.com/d", "example.com/a"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			setUpWorkspace(t, installedDependencies)
+
+			got, err := collectTeethToUninstall(context.New(context.Config{}, semver.Version{}),
+				testCase.toothRepoPaths, testCase.cascade)
+			if testCase.wantErr {
+				if err == nil {
+					t.Errorf("collectTeethToUninstall() = %v, want error", got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("collectTeethToUninstall() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got, testCase.want) {
+				t.Errorf("collectTeethToUninstall() = %v, want %v", got, testCase.want)
+			}
+		})
+	}
+}
+
+// setUpWorkspace creates a workspace with the teeth installed, each depending on the
+// listed teeth, and changes the working directory to it until the test ends.
+func setUpWorkspace(t *testing.T, installedDependencies map[string][]string) {
+	workspaceDir := t.TempDir()
+
+	metadataDir := filepath.Join(workspaceDir, ".lip", "metadata")
+	if err := os.MkdirAll(metadataDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for toothRepoPath, dependencies := range installedDependencies {
+		rawMetadata := tooth.RawMetadata{
+			FormatVersion: 2,
+			Tooth:         toothRepoPath,
+			Version:       "1.0.0",
+			Info:          tooth.RawMetadataInfo{Tags: []string{}},
+			Dependencies:  make(map[string]string),
+		}
+		for _, dependency := range dependencies {
+			rawMetadata.Dependencies[dependency] = "1.x"
+		}
+
+		jsonBytes, err := json.Marshal(rawMetadata)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		metadataFilePath := filepath.Join(metadataDir, url.QueryEscape(toothRepoPath)+".json")
+		if err := os.WriteFile(metadataFilePath, jsonBytes, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	workingDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chdir(workspaceDir); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		os.Chdir(workingDir)
+	})
+}
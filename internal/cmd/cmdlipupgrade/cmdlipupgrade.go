@@ -0,0 +1,90 @@
+package cmdlipupgrade
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/lippkg/lip/internal/cmd/cmdlipinstall"
+	"github.com/lippkg/lip/internal/context"
+	"github.com/lippkg/lip/internal/install"
+)
+
+type FlagDict struct {
+	helpFlag           bool
+	yesFlag            bool
+	dryRunFlag         bool
+	jsonFlag           bool
+	allowOverwriteFlag bool
+	waitLockFlag       bool
+	ignoreScriptsFlag  bool
+}
+
+const helpMessage = `
+Usage:
+  lip upgrade [options] [<tooth repository URL> ...]
+
+Description:
+  Upgrade installed teeth to the newest versions satisfying the version ranges required
+  by all installed teeth. If no tooth is specified, all installed teeth will be upgraded.
+  The upgrades and their new dependencies are resolved together and installed at once.
+
+Options:
+  -h, --help                  Show help.
+  -y, --yes                   Assume yes to all prompts and run non-interactively.
+  --dry-run                   Show what would be done without changing the workspace. Assets are still
+                              downloaded to the cache.
+  --json                      Output the plan of --dry-run in JSON format.
+  --allow-overwrite           Allow overwriting files owned by other installed teeth.
+  --wait-lock                 Wait for other lip processes using the workspace instead of failing.
+  --ignore-scripts, --no-scripts
+                              Do not run commands in tooth.json.
+`
+
+func Run(ctx *context.Context, args []string) error {
+
+	flagSet := flag.NewFlagSet("upgrade", flag.ContinueOnError)
+
+	// Rewrite the default usage message.
+	flagSet.Usage = func() {
+		// Do nothing.
+	}
+
+	var flagDict FlagDict
+	flagSet.BoolVar(&flagDict.helpFlag, "help", false, "")
+	flagSet.BoolVar(&flagDict.helpFlag, "h", false, "")
+	flagSet.BoolVar(&flagDict.yesFlag, "yes", false, "")
+	flagSet.BoolVar(&flagDict.yesFlag, "y", false, "")
+	flagSet.BoolVar(&flagDict.dryRunFlag, "dry-run", false, "")
+	flagSet.BoolVar(&flagDict.jsonFlag, "json", false, "")
+	flagSet.BoolVar(&flagDict.allowOverwriteFlag, "allow-overwrite", false, "")
+	flagSet.BoolVar(&flagDict.waitLockFlag, "wait-lock", false, "")
+	flagSet.BoolVar(&flagDict.ignoreScriptsFlag, "ignore-scripts", false, "")
+	flagSet.BoolVar(&flagDict.ignoreScriptsFlag, "no-scripts", false, "")
+	err := flagSet.Parse(args)
+	if err != nil {
+		return fmt.Errorf("failed to parse flags\n\t%w", err)
+	}
+
+	// Help flag has the highest priority.
+	if flagDict.helpFlag {
+		fmt.Print(helpMessage)
+		return nil
+	}
+
+	// Prevent other lip processes from changing the workspace. A dry run does not
+	// change anything.
+	if !flagDict.dryRunFlag {
+		workspaceLock, err := install.LockWorkspace(ctx, flagDict.waitLockFlag)
+		if err != nil {
+			return err
+		}
+		defer workspaceLock.Release()
+	}
+
+	if err := cmdlipinstall.Upgrade(ctx, flagSet.Args(), flagDict.yesFlag, flagDict.dryRunFlag, flagDict.jsonFlag,
+		flagDict.allowOverwriteFlag, flagDict.ignoreScriptsFlag); err != nil {
+		return fmt.Errorf("failed to upgrade teeth\n\t%w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,423 @@
+package cmdlipverify
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lippkg/lip/internal/context"
+	"github.com/lippkg/lip/internal/path"
+	"github.com/lippkg/lip/internal/tooth"
+	"github.com/olekukonko/tablewriter"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type FlagDict struct {
+	helpFlag        bool
+	ignoreExtraFlag bool
+	jsonFlag        bool
+}
+
+const helpMessage = `
+Usage:
+  lip verify [options] [<tooth repository URL> ...]
+
+Description:
+  Verify the files of installed teeth. If no tooth is specified, all installed teeth
+  will be verified.
+
+Options:
+  -h, --help                  Show help.
+  --ignore-extra              Do not treat extra files as problems.
+  --json                      Output in JSON format.
+`
+
+// result is a file that does not match what was installed.
+type result struct {
+	Tooth  string `json:"tooth"`
+	Status string `json:"status"`
+	Path   string `json:"path"`
+}
+
+const (
+	statusMissing         = "missing"
+	statusModified        = "modified"
+	statusModifiedAllowed = "modified (allowed)"
+	statusExtra           = "extra"
+)
+
+func Run(ctx *context.Context, args []string) error {
+
+	flagSet := flag.NewFlagSet("verify", flag.ContinueOnError)
+
+	// Rewrite the default usage message.
+	flagSet.Usage = func() {
+		// Do nothing.
+	}
+
+	var flagDict FlagDict
+	flagSet.BoolVar(&flagDict.helpFlag, "help", false, "")
+	flagSet.BoolVar(&flagDict.helpFlag, "h", false, "")
+	flagSet.BoolVar(&flagDict.ignoreExtraFlag, "ignore-extra", false, "")
+	flagSet.BoolVar(&flagDict.jsonFlag, "json", false, "")
+	err := flagSet.Parse(args)
+	if err != nil {
+		return fmt.Errorf("failed to parse flags\n\t%w", err)
+	}
+
+	// Help flag has the highest priority.
+	if flagDict.helpFlag {
+		fmt.Print(helpMessage)
+		return nil
+	}
+
+	allMetadata, err := tooth.GetAllMetadata(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list all installed teeth\n\t%w", err)
+	}
+
+	// Select the teeth to verify.
+	metadataList := allMetadata
+	if flagSet.NArg() != 0 {
+		metadataList = make([]tooth.Metadata, 0)
+		for _, toothRepoPath := range flagSet.Args() {
+			metadata, err := tooth.GetMetadata(ctx, toothRepoPath)
+			if err != nil {
+				return fmt.Errorf("tooth %v is not installed\n\t%w", toothRepoPath, err)
+			}
+
+			metadataList = append(metadataList, metadata)
+		}
+	}
+
+	results, err := verify(ctx, metadataList, allMetadata)
+	if err != nil {
+		return fmt.Errorf("failed to verify teeth\n\t%w", err)
+	}
+
+	if err := printResults(results, flagDict.jsonFlag); err != nil {
+		return fmt.Errorf("failed to print results\n\t%w", err)
+	}
+
+	problemCount := 0
+	extraFileCount := 0
+	for _, result := range results {
+		switch result.Status {
+		case statusModifiedAllowed:
+		case statusExtra:
+			extraFileCount++
+		default:
+			problemCount++
+		}
+	}
+
+	// Extra files may be written by the software in the workspace at runtime, e.g. data
+	// of plugins, in which case --ignore-extra keeps them from failing the verification.
+	if extraFileCount != 0 {
+		if flagDict.ignoreExtraFlag {
+			log.Warnf("Found %v files not placed by lip under the directories of installed teeth",
+				extraFileCount)
+		} else {
+			problemCount += extraFileCount
+		}
+	}
+
+	if problemCount != 0 {
+		return fmt.Errorf("found %v problems in the files of installed teeth", problemCount)
+	}
+
+	log.Info("All files of installed teeth are verified")
+
+	return nil
+}
+
+// ---------------------------------------------------------------------
+
+// verify checks the placed files of the teeth against their manifests, and looks for
+// files not placed by lip under the directories of the teeth. allMetadata is used to
+// tell which files are known to lip.
+func verify(ctx *context.Context, metadataList []tooth.Metadata, allMetadata []tooth.Metadata) ([]result, error) {
+	workspaceDirStr, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	workspaceDir, err := path.Parse(workspaceDirStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse workspace directory\n\t%w", err)
+	}
+
+	fileOwners, err := tooth.GetFileOwners(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file owners\n\t%w", err)
+	}
+
+	// Files marked as "preserve" by any tooth are expected to exist or change.
+	preservedFiles := make([]path.Path, 0)
+	for _, metadata := range allMetadata {
+		files, err := metadata.Files()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get files of %v\n\t%w", metadata.ToothRepoPath(), err)
+		}
+
+		preservedFiles = append(preservedFiles, files.Preserve...)
+	}
+
+	isKnown := func(filePath path.Path) bool {
+		if _, ok := fileOwners[filePath.String()]; ok {
+			return true
+		}
+
+		for _, preservedFile := range preservedFiles {
+			if preservedFile.Equal(filePath) || preservedFile.IsAncestorOf(filePath) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	results := make([]result, 0)
+
+	// Extra files under directories shared by several teeth are reported only once.
+	reportedExtraFiles := make(map[string]bool)
+
+	for _, metadata := range metadataList {
+		placedResults, err := verifyPlacedFiles(ctx, workspaceDir, metadata, fileOwners)
+		if err != nil {
+			return nil, fmt.Errorf("failed to verify placed files of %v\n\t%w", metadata.ToothRepoPath(), err)
+		}
+
+		results = append(results, placedResults...)
+
+		extraFiles, err := findExtraFiles(workspaceDir, metadata, isKnown)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find extra files of %v\n\t%w", metadata.ToothRepoPath(), err)
+		}
+
+		for _, extraFile := range extraFiles {
+			if reportedExtraFiles[extraFile.String()] {
+				continue
+			}
+
+			results = append(results, result{metadata.ToothRepoPath(), statusExtra, extraFile.String()})
+			reportedExtraFiles[extraFile.String()] = true
+		}
+	}
+
+	return results, nil
+}
+
+// verifyPlacedFiles compares the placed files of the tooth with its manifest. Teeth
+// installed by older versions of lip have no manifest, so only the existence of their
+// files is checked.
+func verifyPlacedFiles(ctx *context.Context, workspaceDir path.Path, metadata tooth.Metadata,
+	fileOwners map[string]string) ([]result, error) {
+
+	files, err := metadata.Files()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get files from metadata\n\t%w", err)
+	}
+
+	manifest, err := tooth.GetManifest(ctx, metadata.ToothRepoPath())
+	if errors.Is(err, os.ErrNotExist) {
+		log.Warnf("Tooth %v has no manifest, only checking if its files exist", metadata.ToothRepoPath())
+
+		manifest = tooth.Manifest{
+			ToothRepoPath: metadata.ToothRepoPath(),
+			Version:       metadata.Version().String(),
+			Files:         make([]tooth.ManifestFile, 0),
+		}
+		for _, place := range files.Place {
+			manifest.Files = append(manifest.Files, tooth.ManifestFile{Path: place.Dest.String()})
+		}
+
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get manifest\n\t%w", err)
+	}
+
+	results := make([]result, 0)
+
+	for _, manifestFile := range manifest.Files {
+		// Files overwritten by other teeth are verified with those teeth.
+		if owner, ok := fileOwners[manifestFile.Path]; ok && owner != metadata.ToothRepoPath() {
+			continue
+		}
+
+		relFilePath, err := path.Parse(manifestFile.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse file path %v\n\t%w", manifestFile.Path, err)
+		}
+
+		if _, err := os.Stat(workspaceDir.Join(relFilePath).LocalString()); os.IsNotExist(err) {
+			results = append(results, result{metadata.ToothRepoPath(), statusMissing, manifestFile.Path})
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to get info of %v\n\t%w", manifestFile.Path, err)
+		}
+
+		// Nothing more to compare without a manifest.
+		if manifestFile.SHA256 == "" {
+			continue
+		}
+
+		currentManifestFile, err := tooth.MakeManifestFile(workspaceDir, relFilePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file %v\n\t%w", manifestFile.Path, err)
+		}
+
+		if currentManifestFile == manifestFile {
+			continue
+		}
+
+		isPreserved := false
+		for _, preserve := range files.Preserve {
+			if preserve.Equal(relFilePath) || preserve.IsAncestorOf(relFilePath) {
+				isPreserved = true
+				break
+			}
+		}
+
+		if isPreserved {
+			results = append(results, result{metadata.ToothRepoPath(), statusModifiedAllowed, manifestFile.Path})
+		} else {
+			results = append(results, result{metadata.ToothRepoPath(), statusModified, manifestFile.Path})
+		}
+	}
+
+	return results, nil
+}
+
+// findExtraFiles finds the files under the directories of the tooth that are not known
+// to lip. The directories of a tooth are the directories containing its placed files,
+// except for the workspace directory itself.
+func findExtraFiles(workspaceDir path.Path, metadata tooth.Metadata, isKnown func(path.Path) bool) ([]path.Path,
+	error) {
+
+	files, err := metadata.Files()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get files from metadata\n\t%w", err)
+	}
+
+	toothDirs := make([]path.Path, 0)
+	for _, place := range files.Place {
+		dir, err := place.Dest.Dir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse directory\n\t%w", err)
+		}
+
+		if !dir.IsEmpty() {
+			toothDirs = append(toothDirs, dir)
+		}
+	}
+
+	// Walk each directory only once, skipping those inside other directories.
+	dirsToWalk := make([]path.Path, 0)
+	for _, dir := range toothDirs {
+		isCovered := false
+		for _, otherDir := range toothDirs {
+			if otherDir.IsAncestorOf(dir) {
+				isCovered = true
+				break
+			}
+		}
+
+		isDuplicated := false
+		for _, walkedDir := range dirsToWalk {
+			if walkedDir.Equal(dir) {
+				isDuplicated = true
+				break
+			}
+		}
+
+		if !isCovered && !isDuplicated {
+			dirsToWalk = append(dirsToWalk, dir)
+		}
+	}
+
+	extraFiles := make([]path.Path, 0)
+
+	for _, dir := range dirsToWalk {
+		err := filepath.WalkDir(workspaceDir.Join(dir).LocalString(), func(p string, d fs.DirEntry, err error) error {
+			if os.IsNotExist(err) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+
+			if d.IsDir() {
+				// Never look into .lip directories.
+				if d.Name() == ".lip" {
+					return filepath.SkipDir
+				}
+
+				return nil
+			}
+
+			relFilePathStr, err := filepath.Rel(workspaceDir.LocalString(), p)
+			if err != nil {
+				return err
+			}
+
+			relFilePath, err := path.Parse(relFilePathStr)
+			if err != nil {
+				return err
+			}
+
+			if !isKnown(relFilePath) {
+				extraFiles = append(extraFiles, relFilePath)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to walk directory %v\n\t%w", dir, err)
+		}
+	}
+
+	sort.Slice(extraFiles, func(i, j int) bool {
+		return extraFiles[i].String() < extraFiles[j].String()
+	})
+
+	return extraFiles, nil
+}
+
+// printResults prints the results as a table or in JSON format.
+func printResults(results []result, jsonFlag bool) error {
+	if jsonFlag {
+		jsonBytes, err := json.Marshal(results)
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON\n\t%w", err)
+		}
+
+		fmt.Print(string(jsonBytes))
+
+		return nil
+	}
+
+	if len(results) == 0 {
+		return nil
+	}
+
+	tableData := make([][]string, 0)
+	for _, result := range results {
+		tableData = append(tableData, []string{result.Tooth, result.Status, result.Path})
+	}
+
+	tableString := &strings.Builder{}
+	table := tablewriter.NewWriter(tableString)
+	table.SetHeader([]string{"Tooth", "Status", "File"})
+	table.AppendBulk(tableData)
+	table.Render()
+
+	fmt.Print(tableString.String())
+
+	return nil
+}
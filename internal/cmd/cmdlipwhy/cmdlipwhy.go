@@ -0,0 +1,218 @@
+package cmdlipwhy
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lippkg/lip/internal/context"
+	"github.com/lippkg/lip/internal/tooth"
+)
+
+type FlagDict struct {
+	helpFlag bool
+}
+
+const helpMessage = `
+Usage:
+  lip why [options] <tooth repository URL>
+
+Description:
+  Show why a tooth is installed.
+
+Options:
+  -h, --help                  Show help.
+`
+
+func Run(ctx *context.Context, args []string) error {
+
+	flagSet := flag.NewFlagSet("why", flag.ContinueOnError)
+
+	// Rewrite the default usage message.
+	flagSet.Usage = func() {
+		// Do nothing.
+	}
+
+	var flagDict FlagDict
+	flagSet.BoolVar(&flagDict.helpFlag, "help", false, "")
+	flagSet.BoolVar(&flagDict.helpFlag, "h", false, "")
+	err := flagSet.Parse(args)
+	if err != nil {
+		return fmt.Errorf("failed to parse flags\n\t%w", err)
+	}
+
+	// Help flag has the highest priority.
+	if flagDict.helpFlag {
+		fmt.Print(helpMessage)
+		return nil
+	}
+
+	// Exactly one tooth is required.
+	if flagSet.NArg() != 1 {
+		return fmt.Errorf("exactly one tooth repository URL is required")
+	}
+
+	toothRepoPath := flagSet.Arg(0)
+
+	metadataList, err := tooth.GetAllMetadata(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list all installed tooth metadata\n\t%w", err)
+	}
+
+	metadataMap := make(map[string]tooth.Metadata)
+	for _, metadata := range metadataList {
+		metadataMap[metadata.ToothRepoPath()] = metadata
+	}
+
+	metadata, ok := metadataMap[toothRepoPath]
+	if !ok {
+		return fmt.Errorf("tooth %v is not installed", toothRepoPath)
+	}
+
+	installReasons := make(map[string]string)
+	for installedToothRepoPath := range metadataMap {
+		installReason, err := tooth.GetInstallReason(ctx, installedToothRepoPath)
+		if err != nil {
+			return fmt.Errorf("failed to get install reason of %v\n\t%w", installedToothRepoPath, err)
+		}
+
+		installReasons[installedToothRepoPath] = installReason
+	}
+
+	dependents, err := tooth.GetReverseDependencies(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get reverse dependencies\n\t%w", err)
+	}
+
+	paths := findDependencyPaths(dependents, installReasons, toothRepoPath)
+
+	builder := &strings.Builder{}
+
+	if installReasons[toothRepoPath] == tooth.InstallReasonExplicit {
+		builder.WriteString(fmt.Sprintf("%v@%v is installed explicitly.\n", toothRepoPath, metadata.Version()))
+	}
+
+	if len(paths) != 0 {
+		builder.WriteString(fmt.Sprintf("%v@%v is required through:\n", toothRepoPath, metadata.Version()))
+		for _, path := range paths {
+			pathString, err := formatDependencyPath(metadataList, metadataMap, path)
+			if err != nil {
+				return fmt.Errorf("failed to format dependency path\n\t%w", err)
+			}
+
+			builder.WriteString("  " + pathString + "\n")
+		}
+
+	} else if installReasons[toothRepoPath] != tooth.InstallReasonExplicit {
+		builder.WriteString(fmt.Sprintf("%v@%v is installed as a dependency, but no explicitly installed "+
+			"tooth depends on it. Run lip autoremove to uninstall it.\n", toothRepoPath, metadata.Version()))
+	}
+
+	fmt.Print(builder.String())
+
+	return nil
+}
+
+// ---------------------------------------------------------------------
+
+// findDependencyPaths returns every dependency path from an explicitly installed tooth
+// down to the tooth, sorted. Each path starts with the explicitly installed tooth and
+// ends with the tooth, and no tooth appears twice in a path. dependents maps each tooth to
+// the teeth depending on it.
+func findDependencyPaths(dependents map[string][]string, installReasons map[string]string,
+	toothRepoPath string) [][]string {
+
+	paths := make([][]string, 0)
+	onPath := map[string]bool{toothRepoPath: true}
+
+	// Walk up from the tooth through its dependents. reversedPath holds the teeth from
+	// the tooth up to the current dependent.
+	var visit func(reversedPath []string)
+	visit = func(reversedPath []string) {
+		current := reversedPath[len(reversedPath)-1]
+
+		if len(reversedPath) > 1 && installReasons[current] == tooth.InstallReasonExplicit {
+			path := make([]string, len(reversedPath))
+			for i, toothRepoPath := range reversedPath {
+				path[len(path)-1-i] = toothRepoPath
+			}
+
+			paths = append(paths, path)
+		}
+
+		for _, dependent := range dependents[current] {
+			if onPath[dependent] {
+				continue
+			}
+
+			onPath[dependent] = true
+			visit(append(reversedPath, dependent))
+			delete(onPath, dependent)
+		}
+	}
+
+	visit([]string{toothRepoPath})
+
+	sort.Slice(paths, func(i, j int) bool {
+		return strings.Join(paths[i], "\n") < strings.Join(paths[j], "\n")
+	})
+
+	return paths
+}
+
+// formatDependencyPath formats a dependency path in one line, e.g.
+// "example.com/foo@1.0.0 -> example.com/bar@1.2.0 (1.x)". The version range required by
+// the previous tooth follows each tooth, together with the virtual tooth required if the
+// tooth provides it.
+func formatDependencyPath(metadataList []tooth.Metadata, metadataMap map[string]tooth.Metadata,
+	path []string) (string, error) {
+
+	items := make([]string, 0, len(path))
+	for i, toothRepoPath := range path {
+		item := fmt.Sprintf("%v@%v", toothRepoPath, metadataMap[toothRepoPath].Version())
+
+		if i > 0 {
+			requirer := metadataMap[path[i-1]]
+
+			dependencyTargets, err := tooth.MapDependenciesToInstalled(requirer, metadataList)
+			if err != nil {
+				return "", err
+			}
+
+			// Find the dependency of the previous tooth satisfied by the tooth.
+			deps := make([]string, 0)
+			for dep, target := range dependencyTargets {
+				if target == toothRepoPath {
+					deps = append(deps, dep)
+				}
+			}
+			sort.Strings(deps)
+
+			if len(deps) != 0 {
+				dep := deps[0]
+				versionRangeString := requirer.DependenciesAsStrings()[dep]
+				if dep != toothRepoPath {
+					versionRangeString = dep + " " + versionRangeString
+				}
+				item += fmt.Sprintf(" (%v)", versionRangeString)
+
+				dependencies, err := requirer.Dependencies()
+				if err != nil {
+					return "", err
+				}
+
+				satisfies, err := metadataMap[toothRepoPath].Satisfies(dep, dependencies[dep])
+				if err != nil {
+					return "", err
+				} else if !satisfies {
+					item += " [UNMET]"
+				}
+			}
+		}
+
+		items = append(items, item)
+	}
+
+	return strings.Join(items, " -> "), nil
+}
@@ -0,0 +1,107 @@
+package cmdlipwhy
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/lippkg/lip/internal/tooth"
+)
+
+func TestFindDependencyPaths(t *testing.T) {
+	testCases := []struct {
+		name string
+		// dependencies maps each installed tooth to its dependencies.
+		dependencies map[string][]string
+		explicit     []string
+		want         [][]string
+	}{
+		{
+			name: "explicitly installed dependent",
+			dependencies: map[string][]string{
+				"example.com/a": {"example.com/t"},
+				"example.com/t": nil,
+			},
+			explicit: []string{"example.com/a"},
+			want:     [][]string{{"example.com/a", "example.com/t"}},
+		},
+		{
+			name: "direct and indirect paths",
+			dependencies: map[string][]string{
+				"example.com/a": {"example.com/b", "example.com/t"},
+				"example.com/b": {"example.com/t"},
+				"example.com/t": nil,
+			},
+			explicit: []string{"example.com/a"},
+			want: [][]string{
+				{"example.com/a", "example.com/b", "example.com/t"},
+				{"example.com/a", "example.com/t"},
+			},
+		},
+		{
+			name: "path through explicitly installed tooth",
+			dependencies: map[string][]string{
+				"example.com/a": {"example.com/b"},
+				"example.com/b": {"example.com/t"},
+				"example.com/t": nil,
+			},
+			explicit: []string{"example.com/a", "example.com/b"},
+			want: [][]string{
+				{"example.com/a", "example.com/b", "example.com/t"},
+				{"example.com/b", "example.com/t"},
+			},
+		},
+		{
+			name: "dependents installed as dependencies only",
+			dependencies: map[string][]string{
+				"example.com/b": {"example.com/t"},
+				"example.com/t": nil,
+			},
+			want: [][]string{},
+		},
+		{
+			name: "cycle",
+			dependencies: map[string][]string{
+				"example.com/a": {"example.com/b"},
+				"example.com/b": {"example.com/a", "example.com/t"},
+				"example.com/t": nil,
+			},
+			explicit: []string{"example.com/a"},
+			want:     [][]string{{"example.com/a", "example.com/b", "example.com/t"}},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			installReasons := make(map[string]string)
+			for toothRepoPath := range testCase.dependencies {
+				installReasons[toothRepoPath] = tooth.InstallReasonDependency
+			}
+			for _, toothRepoPath := range testCase.explicit {
+				installReasons[toothRepoPath] = tooth.InstallReasonExplicit
+			}
+
+			got := findDependencyPaths(makeDependents(testCase.dependencies), installReasons, "example.com/t")
+			if !reflect.DeepEqual(got, testCase.want) {
+				t.Errorf("findDependencyPaths() = %v, want %v", got, testCase.want)
+			}
+		})
+	}
+}
+
+// makeDependents maps each tooth to the sorted teeth depending on it, like
+// tooth.GetReverseDependencies.
+func makeDependents(dependencies map[string][]string) map[string][]string {
+	dependents := make(map[string][]string)
+	for toothRepoPath, deps := range dependencies {
+		for _, dep := range deps {
+			dependents[dep] = append(dependents[dep], toothRepoPath)
+		}
+	}
+
+	for dep := range dependents {
+		sort.Strings(dependents[dep])
+	}
+
+	return dependents
+}
@@ -1,7 +1,9 @@
 package context
 
 type Config struct {
-	GitHubMirrorURL  string `json:"github_mirror_url"`
-	GoModuleProxyURL string `json:"go_module_proxy_url"`
-	ProxyURL         string `json:"proxy_url"`
+	GitHubMirrorURL        string `json:"github_mirror_url"`
+	GoModuleProxyURL       string `json:"go_module_proxy_url"`
+	ProxyURL               string `json:"proxy_url"`
+	MaxConcurrentDownloads int    `json:"max_concurrent_downloads"`
+	RequireScriptApproval  bool   `json:"require_script_approval"`
 }
@@ -1,10 +1,12 @@
 package context
 
 import (
+	gocontext "context"
 	"encoding/json"
 	"fmt"
 	"net/url"
 	"os"
+	"sync"
 
 	"github.com/blang/semver/v4"
 	"github.com/lippkg/lip/internal/path"
@@ -14,16 +16,55 @@ import (
 type Context struct {
 	config     Config
 	lipVersion semver.Version
+
+	goContext gocontext.Context
+	cancel    gocontext.CancelFunc
+
+	// interruptSignalMutex guards interruptSignal, which is set from the signal handler.
+	interruptSignalMutex sync.Mutex
+	interruptSignal      os.Signal
 }
 
 // New creates a new context.
 func New(config Config, version semver.Version) *Context {
+	goContext, cancel := gocontext.WithCancel(gocontext.Background())
+
 	return &Context{
 		config:     config,
 		lipVersion: version,
+		goContext:  goContext,
+		cancel:     cancel,
 	}
 }
 
+// GoContext returns the Go context of the application, which is cancelled when lip is
+// interrupted. Long-running operations such as downloads and commands stop when it is
+// done.
+func (ctx *Context) GoContext() gocontext.Context {
+	return ctx.goContext
+}
+
+// Interrupt records the signal interrupting lip and cancels the Go context. Only the
+// first signal is recorded.
+func (ctx *Context) Interrupt(sig os.Signal) {
+	ctx.interruptSignalMutex.Lock()
+	defer ctx.interruptSignalMutex.Unlock()
+
+	if ctx.interruptSignal == nil {
+		ctx.interruptSignal = sig
+	}
+
+	ctx.cancel()
+}
+
+// InterruptSignal returns the signal interrupting lip, or nil if lip is not interrupted.
+func (ctx *Context) InterruptSignal() os.Signal {
+	ctx.interruptSignalMutex.Lock()
+	defer ctx.interruptSignalMutex.Unlock()
+
+	return ctx.interruptSignal
+}
+
 // Config returns the config.
 func (ctx *Context) Config() *Config {
 	return &ctx.config
@@ -59,6 +100,34 @@ func (ctx *Context) ProxyURL() (*url.URL, error) {
 	return proxyURL, nil
 }
 
+// MaxConcurrentDownloads returns the maximum number of concurrent downloads, which is
+// at least 1.
+func (ctx *Context) MaxConcurrentDownloads() int {
+	if ctx.config.MaxConcurrentDownloads < 1 {
+		return 1
+	}
+
+	return ctx.config.MaxConcurrentDownloads
+}
+
+// RequireScriptApproval tells whether hook commands must be approved before running.
+func (ctx *Context) RequireScriptApproval() bool {
+	return ctx.config.RequireScriptApproval
+}
+
+// ApprovedScriptsFilePath returns the path of the file recording approved hook commands.
+func (ctx *Context) ApprovedScriptsFilePath() (path.Path, error) {
+
+	globalDotLipDir, err := ctx.GlobalDotLipDir()
+	if err != nil {
+		return path.Path{}, fmt.Errorf("cannot get global .lip directory\n\t%w", err)
+	}
+
+	path := globalDotLipDir.Join(path.MustParse("approved_scripts.json"))
+
+	return path, nil
+}
+
 // LipVersion returns the lip version.
 func (ctx *Context) LipVersion() semver.Version {
 	return ctx.lipVersion
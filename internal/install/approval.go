@@ -0,0 +1,239 @@
+package install
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lippkg/lip/internal/context"
+	"github.com/lippkg/lip/internal/lock"
+	"github.com/lippkg/lip/internal/path"
+	"github.com/lippkg/lip/internal/prompt"
+	log "github.com/sirupsen/logrus"
+)
+
+// approvedScript records a hook command approved by the user. Only SHA256 is checked.
+// The other fields are for users reviewing the approvals file.
+type approvedScript struct {
+	Tooth   string `json:"tooth"`
+	Hook    string `json:"hook"`
+	Command string `json:"command"`
+	SHA256  string `json:"sha256"`
+}
+
+// ApproveHookCommands makes sure every hook command has been approved, if approving hook
+// commands is required by the config. Commands not approved yet are listed and the user
+// is asked to approve them, which is recorded in the approvals file under the global .lip
+// directory. If yes is true, the user is not asked and unapproved commands fail.
+func ApproveHookCommands(ctx *context.Context, hookCommands []HookCommand, yes bool) error {
+	if !ctx.RequireScriptApproval() {
+		return nil
+	}
+
+	approvedScripts, err := loadApprovedScriptsLocked(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load approved scripts\n\t%w", err)
+	}
+
+	isApproved := make(map[string]bool)
+	for _, approvedScript := range approvedScripts {
+		isApproved[approvedScript.SHA256] = true
+	}
+
+	unapprovedScripts := make([]approvedScript, 0)
+	for _, hookCommand := range hookCommands {
+		hash, err := hashHookCommand(hookCommand)
+		if err != nil {
+			return fmt.Errorf("failed to hash command %v\n\t%w", hookCommand.Command, err)
+		}
+
+		if isApproved[hash] {
+			continue
+		}
+		isApproved[hash] = true
+
+		unapprovedScripts = append(unapprovedScripts, approvedScript{
+			Tooth:   hookCommand.ToothRepoPath,
+			Hook:    hookCommand.Hook,
+			Command: hookCommand.Command.String(),
+			SHA256:  hash,
+		})
+	}
+
+	if len(unapprovedScripts) == 0 {
+		return nil
+	}
+
+	lines := make([]string, 0, len(unapprovedScripts))
+	for _, unapprovedScript := range unapprovedScripts {
+		lines = append(lines, fmt.Sprintf("%v (%v): %v", unapprovedScript.Tooth, unapprovedScript.Hook,
+			unapprovedScript.Command))
+	}
+
+	if yes {
+		return fmt.Errorf("hook commands not approved, run without --yes to approve them or use --no-scripts "+
+			"to skip them\n\t%v", strings.Join(lines, "\n\t"))
+	}
+
+	log.Warn("The following hook commands are new or changed and have not been approved:")
+	for _, line := range lines {
+		log.Warnf("  %v", line)
+	}
+
+	if ok, err := prompt.Confirm(ctx, "Do you want to approve them?"); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("aborted")
+	}
+
+	if err := addApprovedScripts(ctx, unapprovedScripts); err != nil {
+		return fmt.Errorf("failed to save approved scripts\n\t%w", err)
+	}
+
+	return nil
+}
+
+// hashHookCommand returns the SHA-256 hash of the hook command together with the tooth
+// and the hook it belongs to, so that changing any part of it needs approving again.
+func hashHookCommand(hookCommand HookCommand) (string, error) {
+	command := hookCommand.Command
+
+	jsonBytes, err := json.Marshal(struct {
+		Tooth           string            `json:"tooth"`
+		Hook            string            `json:"hook"`
+		Script          string            `json:"script"`
+		Args            []string          `json:"args"`
+		Shell           string            `json:"shell"`
+		Cwd             string            `json:"cwd"`
+		Env             map[string]string `json:"env"`
+		Timeout         string            `json:"timeout"`
+		ContinueOnError bool              `json:"continue_on_error"`
+	}{
+		Tooth:           hookCommand.ToothRepoPath,
+		Hook:            hookCommand.Hook,
+		Script:          command.Script,
+		Args:            command.Args,
+		Shell:           command.Shell,
+		Cwd:             command.Cwd.String(),
+		Env:             command.Env,
+		Timeout:         command.Timeout.String(),
+		ContinueOnError: command.ContinueOnError,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(jsonBytes)
+
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// lockApprovedScripts acquires the lock on the approvals file, which is shared by lip
+// processes working on any workspace. The lock is not held while asking the user.
+func lockApprovedScripts(ctx *context.Context) (*lock.Lock, error) {
+	approvedScriptsFilePath, err := ctx.ApprovedScriptsFilePath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get approved scripts file path\n\t%w", err)
+	}
+
+	approvedScriptsDir, err := approvedScriptsFilePath.Dir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get approved scripts directory\n\t%w", err)
+	}
+
+	approvalsLock, err := lock.Acquire(ctx.GoContext(),
+		approvedScriptsDir.Join(path.MustParse("."+approvedScriptsFilePath.Base()+".lock")), true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock approved scripts file\n\t%w", err)
+	}
+
+	return approvalsLock, nil
+}
+
+// loadApprovedScriptsLocked reads the approvals file while holding its lock, so that it
+// is never read while being written.
+func loadApprovedScriptsLocked(ctx *context.Context) ([]approvedScript, error) {
+	approvalsLock, err := lockApprovedScripts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer approvalsLock.Release()
+
+	return loadApprovedScripts(ctx)
+}
+
+// addApprovedScripts adds the scripts to the approvals file. The file is read again
+// while holding its lock, so that scripts approved by other lip processes in the
+// meantime are kept.
+func addApprovedScripts(ctx *context.Context, newApprovedScripts []approvedScript) error {
+	approvalsLock, err := lockApprovedScripts(ctx)
+	if err != nil {
+		return err
+	}
+	defer approvalsLock.Release()
+
+	approvedScripts, err := loadApprovedScripts(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load approved scripts\n\t%w", err)
+	}
+
+	isApproved := make(map[string]bool)
+	for _, approvedScript := range approvedScripts {
+		isApproved[approvedScript.SHA256] = true
+	}
+
+	for _, newApprovedScript := range newApprovedScripts {
+		if !isApproved[newApprovedScript.SHA256] {
+			approvedScripts = append(approvedScripts, newApprovedScript)
+		}
+	}
+
+	return saveApprovedScripts(ctx, approvedScripts)
+}
+
+// loadApprovedScripts reads the approvals file. It returns nothing if the file does not
+// exist. The lock on it must be held.
+func loadApprovedScripts(ctx *context.Context) ([]approvedScript, error) {
+	approvedScriptsFilePath, err := ctx.ApprovedScriptsFilePath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get approved scripts file path\n\t%w", err)
+	}
+
+	jsonBytes, err := os.ReadFile(approvedScriptsFilePath.LocalString())
+	if errors.Is(err, os.ErrNotExist) {
+		return make([]approvedScript, 0), nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read approved scripts file\n\t%w", err)
+	}
+
+	var approvedScripts []approvedScript
+	if err := json.Unmarshal(jsonBytes, &approvedScripts); err != nil {
+		return nil, fmt.Errorf("failed to parse approved scripts file %v\n\t%w",
+			approvedScriptsFilePath.LocalString(), err)
+	}
+
+	return approvedScripts, nil
+}
+
+// saveApprovedScripts writes the approvals file. The lock on it must be held.
+func saveApprovedScripts(ctx *context.Context, approvedScripts []approvedScript) error {
+	approvedScriptsFilePath, err := ctx.ApprovedScriptsFilePath()
+	if err != nil {
+		return fmt.Errorf("failed to get approved scripts file path\n\t%w", err)
+	}
+
+	jsonBytes, err := json.MarshalIndent(approvedScripts, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal approved scripts\n\t%w", err)
+	}
+
+	if err := os.WriteFile(approvedScriptsFilePath.LocalString(), jsonBytes, 0644); err != nil {
+		return fmt.Errorf("failed to write approved scripts file\n\t%w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,282 @@
+package install
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/blang/semver/v4"
+	"github.com/lippkg/lip/internal/context"
+	"github.com/lippkg/lip/internal/tooth"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// WorkspaceProblem is a problem found in the set of installed teeth.
+type WorkspaceProblem struct {
+	Kind  string `json:"kind"`
+	Tooth string `json:"tooth"`
+	// Requirement is the dependency or prerequisite not satisfied.
+	Requirement  string `json:"requirement,omitempty"`
+	VersionRange string `json:"version_range,omitempty"`
+	// InstalledVersion is the installed version of Requirement if it is installed.
+	InstalledVersion string `json:"installed_version,omitempty"`
+	// ConflictingTooth is the installed tooth conflicting with Tooth, and Description
+	// tells which relationship causes the conflict.
+	ConflictingTooth string `json:"conflicting_tooth,omitempty"`
+	Description      string `json:"description,omitempty"`
+	// Cycle is the teeth forming a circular dependency, starting from Tooth.
+	Cycle []string `json:"cycle,omitempty"`
+}
+
+const (
+	ProblemKindMissingDependency   = "missing_dependency"
+	ProblemKindUnmetDependency     = "unmet_dependency"
+	ProblemKindMissingPrerequisite = "missing_prerequisite"
+	ProblemKindUnmetPrerequisite   = "unmet_prerequisite"
+	ProblemKindConflict            = "conflict"
+	ProblemKindCircularDependency  = "circular_dependency"
+)
+
+func (p WorkspaceProblem) String() string {
+	switch p.Kind {
+	case ProblemKindMissingDependency:
+		return fmt.Sprintf("%v requires %v %v, but it is not installed", p.Tooth, p.Requirement, p.VersionRange)
+	case ProblemKindUnmetDependency:
+		return fmt.Sprintf("%v requires %v %v, but version %v is installed", p.Tooth, p.Requirement, p.VersionRange,
+			p.InstalledVersion)
+	case ProblemKindMissingPrerequisite:
+		return fmt.Sprintf("%v requires prerequisite %v %v, but it is not installed", p.Tooth, p.Requirement,
+			p.VersionRange)
+	case ProblemKindUnmetPrerequisite:
+		return fmt.Sprintf("%v requires prerequisite %v %v, but version %v is installed", p.Tooth, p.Requirement,
+			p.VersionRange, p.InstalledVersion)
+	case ProblemKindConflict:
+		return fmt.Sprintf("%v conflicts with %v (%v)", p.Tooth, p.ConflictingTooth, p.Description)
+	case ProblemKindCircularDependency:
+		return fmt.Sprintf("circular dependency: %v -> %v", strings.Join(p.Cycle, " -> "), p.Cycle[0])
+	default:
+		return fmt.Sprintf("%v: %v", p.Kind, p.Tooth)
+	}
+}
+
+// CheckWorkspace validates the dependencies and prerequisites of every installed tooth
+// against the versions actually installed or provided, and looks for conflicts and
+// circular dependencies among installed teeth. Problems are ordered by tooth repo path,
+// followed by circular dependencies.
+func CheckWorkspace(ctx *context.Context) ([]WorkspaceProblem, error) {
+	metadataList, err := tooth.GetAllMetadata(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list all installed teeth\n\t%w", err)
+	}
+
+	sort.Slice(metadataList, func(i, j int) bool {
+		return metadataList[i].ToothRepoPath() < metadataList[j].ToothRepoPath()
+	})
+
+	metadataMap := make(map[string]tooth.Metadata)
+	for _, metadata := range metadataList {
+		metadataMap[metadata.ToothRepoPath()] = metadata
+	}
+
+	problems := make([]WorkspaceProblem, 0)
+
+	for _, metadata := range metadataList {
+		dependencies, err := metadata.Dependencies()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get dependencies of %v\n\t%w", metadata.ToothRepoPath(), err)
+		}
+
+		prerequisites, err := metadata.Prerequisites()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get prerequisites of %v\n\t%w", metadata.ToothRepoPath(), err)
+		}
+
+		dependencyProblems, err := checkRequirements(metadataList, metadataMap, metadata.ToothRepoPath(),
+			dependencies, metadata.DependenciesAsStrings(), ProblemKindMissingDependency, ProblemKindUnmetDependency)
+		if err != nil {
+			return nil, err
+		}
+
+		prerequisiteProblems, err := checkRequirements(metadataList, metadataMap, metadata.ToothRepoPath(),
+			prerequisites, metadata.PrerequisitesAsStrings(), ProblemKindMissingPrerequisite,
+			ProblemKindUnmetPrerequisite)
+		if err != nil {
+			return nil, err
+		}
+
+		problems = append(problems, dependencyProblems...)
+		problems = append(problems, prerequisiteProblems...)
+
+		// Each pair of conflicting teeth is reported once.
+		for _, other := range metadataList {
+			if other.ToothRepoPath() <= metadata.ToothRepoPath() {
+				continue
+			}
+
+			conflicts, description, err := metadata.ConflictsWith(other)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check conflicts of %v\n\t%w", metadata.ToothRepoPath(), err)
+			}
+
+			if conflicts {
+				problems = append(problems, WorkspaceProblem{
+					Kind:             ProblemKindConflict,
+					Tooth:            metadata.ToothRepoPath(),
+					ConflictingTooth: other.ToothRepoPath(),
+					Description:      description,
+				})
+			}
+		}
+	}
+
+	for _, cycle := range findDependencyCycles(metadataList, metadataMap) {
+		problems = append(problems, WorkspaceProblem{
+			Kind:  ProblemKindCircularDependency,
+			Tooth: cycle[0],
+			Cycle: cycle,
+		})
+	}
+
+	return problems, nil
+}
+
+// WarnWorkspaceProblems checks the workspace and logs the problems found as warnings. It
+// is meant to be called after the installed teeth are changed.
+func WarnWorkspaceProblems(ctx *context.Context) {
+	problems, err := CheckWorkspace(ctx)
+	if err != nil {
+		log.Warnf("Failed to check the workspace\n\t%v", err.Error())
+		return
+	}
+
+	if len(problems) == 0 {
+		return
+	}
+
+	log.Warn("Found problems in the workspace:")
+	for _, problem := range problems {
+		log.Warnf("  %v", problem)
+	}
+	log.Warn("Run lip check for details.")
+}
+
+// ---------------------------------------------------------------------
+
+// checkRequirements checks the dependencies or prerequisites of a tooth against the
+// installed teeth. A requirement not installed itself may be provided by another tooth.
+func checkRequirements(metadataList []tooth.Metadata, metadataMap map[string]tooth.Metadata,
+	toothRepoPath string, requirements map[string]semver.Range, requirementsAsStrings map[string]string,
+	missingKind string, unmetKind string) ([]WorkspaceProblem, error) {
+
+	requirementPaths := make([]string, 0, len(requirements))
+	for requirement := range requirements {
+		requirementPaths = append(requirementPaths, requirement)
+	}
+	sort.Strings(requirementPaths)
+
+	problems := make([]WorkspaceProblem, 0)
+	for _, requirement := range requirementPaths {
+		problem := WorkspaceProblem{
+			Tooth:        toothRepoPath,
+			Requirement:  requirement,
+			VersionRange: requirementsAsStrings[requirement],
+		}
+
+		installedMetadata, ok := metadataMap[requirement]
+		if !ok {
+			_, isProvided, err := tooth.FindSatisfyingTooth(metadataList, requirement, requirements[requirement])
+			if err != nil {
+				return nil, fmt.Errorf("failed to find tooth providing %v\n\t%w", requirement, err)
+			}
+
+			if !isProvided {
+				problem.Kind = missingKind
+				problems = append(problems, problem)
+			}
+
+		} else if !requirements[requirement](installedMetadata.Version()) {
+			problem.Kind = unmetKind
+			problem.InstalledVersion = installedMetadata.Version().String()
+			problems = append(problems, problem)
+		}
+	}
+
+	return problems, nil
+}
+
+// findDependencyCycles finds circular dependencies among installed teeth. Each cycle
+// is reported once, starting from its smallest tooth repo path.
+func findDependencyCycles(metadataList []tooth.Metadata, metadataMap map[string]tooth.Metadata) [][]string {
+	cycles := make([][]string, 0)
+	found := make(map[string]bool)
+
+	visited := make(map[string]bool)
+	onStack := make(map[string]bool)
+	stack := make([]string, 0)
+
+	var visit func(toothRepoPath string)
+	visit = func(toothRepoPath string) {
+		visited[toothRepoPath] = true
+		onStack[toothRepoPath] = true
+		stack = append(stack, toothRepoPath)
+
+		deps := make([]string, 0)
+		for dep := range metadataMap[toothRepoPath].DependenciesAsStrings() {
+			if _, ok := metadataMap[dep]; ok {
+				deps = append(deps, dep)
+			}
+		}
+		sort.Strings(deps)
+
+		for _, dep := range deps {
+			if onStack[dep] {
+				start := len(stack) - 1
+				for stack[start] != dep {
+					start--
+				}
+
+				cycle := rotateToSmallest(stack[start:])
+				key := strings.Join(cycle, "\n")
+				if !found[key] {
+					found[key] = true
+					cycles = append(cycles, cycle)
+				}
+
+			} else if !visited[dep] {
+				visit(dep)
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		delete(onStack, toothRepoPath)
+	}
+
+	for _, metadata := range metadataList {
+		if !visited[metadata.ToothRepoPath()] {
+			visit(metadata.ToothRepoPath())
+		}
+	}
+
+	sort.Slice(cycles, func(i, j int) bool {
+		return strings.Join(cycles[i], "\n") < strings.Join(cycles[j], "\n")
+	})
+
+	return cycles
+}
+
+// rotateToSmallest returns a copy of the cycle rotated to start from its smallest item.
+func rotateToSmallest(cycle []string) []string {
+	smallest := 0
+	for i, item := range cycle {
+		if item < cycle[smallest] {
+			smallest = i
+		}
+	}
+
+	rotated := make([]string, 0, len(cycle))
+	rotated = append(rotated, cycle[smallest:]...)
+	rotated = append(rotated, cycle[:smallest]...)
+
+	return rotated
+}
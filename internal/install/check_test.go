@@ -0,0 +1,96 @@
+package install
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/lippkg/lip/internal/tooth"
+)
+
+func TestFindDependencyCycles(t *testing.T) {
+	testCases := []struct {
+		name string
+		// dependencies maps each installed tooth to its dependencies.
+		dependencies map[string][]string
+		want         [][]string
+	}{
+		{
+			name: "no cycles",
+			dependencies: map[string][]string{
+				"example.com/a": {"example.com/b", "example.com/c"},
+				"example.com/b": {"example.com/c"},
+				"example.com/c": nil,
+			},
+			want: [][]string{},
+		},
+		{
+			name: "self dependency",
+			dependencies: map[string][]string{
+				"example.com/a": {"example.com/a"},
+			},
+			want: [][]string{{"example.com/a"}},
+		},
+		{
+			name: "cycle starting from smallest tooth",
+			dependencies: map[string][]string{
+				"example.com/a": {"example.com/b"},
+				"example.com/b": {"example.com/c"},
+				"example.com/c": {"example.com/a"},
+				"example.com/d": {"example.com/c"},
+			},
+			want: [][]string{{"example.com/a", "example.com/b", "example.com/c"}},
+		},
+		{
+			name: "separate cycles",
+			dependencies: map[string][]string{
+				"example.com/a": {"example.com/b"},
+				"example.com/b": {"example.com/a"},
+				"example.com/c": {"example.com/d"},
+				"example.com/d": {"example.com/c"},
+			},
+			want: [][]string{{"example.com/a", "example.com/b"}, {"example.com/c", "example.com/d"}},
+		},
+		{
+			name: "dependency not installed",
+			dependencies: map[string][]string{
+				"example.com/a": {"example.com/b"},
+			},
+			want: [][]string{},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			metadataList := make([]tooth.Metadata, 0, len(testCase.dependencies))
+			metadataMap := make(map[string]tooth.Metadata)
+			for toothRepoPath, deps := range testCase.dependencies {
+				rawMetadata := tooth.RawMetadata{
+					FormatVersion: 2,
+					Tooth:         toothRepoPath,
+					Version:       "1.0.0",
+					Dependencies:  make(map[string]string),
+				}
+				for _, dep := range deps {
+					rawMetadata.Dependencies[dep] = "1.x"
+				}
+
+				metadata, err := tooth.MakeMetadataFromRaw(rawMetadata)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				metadataList = append(metadataList, metadata)
+				metadataMap[toothRepoPath] = metadata
+			}
+
+			sort.Slice(metadataList, func(i, j int) bool {
+				return metadataList[i].ToothRepoPath() < metadataList[j].ToothRepoPath()
+			})
+
+			if got := findDependencyCycles(metadataList, metadataMap); !reflect.DeepEqual(got, testCase.want) {
+				t.Errorf("findDependencyCycles() = %v, want %v", got, testCase.want)
+			}
+		})
+	}
+}
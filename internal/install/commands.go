@@ -4,41 +4,353 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lippkg/lip/internal/context"
+	"github.com/lippkg/lip/internal/path"
+	"github.com/lippkg/lip/internal/tooth"
 
 	log "github.com/sirupsen/logrus"
 )
 
-// runCommands runs the given commands.
-func runCommands(commands []string, environs map[string]string) error {
+// Hook names, passed to commands in LIP_HOOK.
+const (
+	hookPreInstall    = "pre_install"
+	hookPostInstall   = "post_install"
+	hookPreUninstall  = "pre_uninstall"
+	hookPostUninstall = "post_uninstall"
+	hookPreUpgrade    = "pre_upgrade"
+	hookPostUpgrade   = "post_upgrade"
+)
+
+// hookKillDelay is how long a command may take to exit after lip passes on the signal
+// interrupting it, before it is killed.
+const hookKillDelay = 10 * time.Second
+
+// HookCommand is a command of a tooth run in a hook.
+type HookCommand struct {
+	ToothRepoPath string
+	Hook          string
+	Command       tooth.Command
+}
+
+// GetInstallHookCommands returns the commands to run in order when installing the tooth,
+// including those of the installed version to uninstall if the tooth is installed. This
+// matches the commands run by Install or Upgrade.
+func GetInstallHookCommands(ctx *context.Context, metadata tooth.Metadata) ([]HookCommand, error) {
+	commands, err := metadata.Commands()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commands\n\t%w", err)
+	}
+
+	isInstalled, err := tooth.IsInstalled(ctx, metadata.ToothRepoPath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if tooth is installed\n\t%w", err)
+	}
+
+	hookCommands := make([]HookCommand, 0)
+	addHookCommands := func(hook string, hookCommandList []tooth.Command) {
+		for _, command := range hookCommandList {
+			hookCommands = append(hookCommands, HookCommand{metadata.ToothRepoPath(), hook, command})
+		}
+	}
+
+	if isInstalled {
+		currentMetadata, err := tooth.GetMetadata(ctx, metadata.ToothRepoPath())
+		if err != nil {
+			return nil, fmt.Errorf("failed to find installed tooth metadata\n\t%w", err)
+		}
+
+		if runsUpgradeCommands(commands, metadata, currentMetadata) {
+			addHookCommands(hookPreUpgrade, commands.PreUpgrade)
+			addHookCommands(hookPostUpgrade, commands.PostUpgrade)
+
+			return hookCommands, nil
+		}
+
+		uninstallHookCommands, err := GetUninstallHookCommands(currentMetadata)
+		if err != nil {
+			return nil, err
+		}
+
+		hookCommands = append(hookCommands, uninstallHookCommands...)
+	}
+
+	addHookCommands(hookPreInstall, commands.PreInstall)
+	addHookCommands(hookPostInstall, commands.PostInstall)
+
+	return hookCommands, nil
+}
+
+// runsUpgradeCommands tells whether the upgrade commands of the new version run instead
+// of the uninstall commands of the installed version and the install commands of the new
+// version, i.e. whether the new version has upgrade commands and is newer. Reinstalling
+// or downgrading runs the uninstall and install commands.
+func runsUpgradeCommands(commands tooth.Commands, metadata tooth.Metadata, currentMetadata tooth.Metadata) bool {
+	return commands.HasUpgradeCommands() && metadata.Version().GT(currentMetadata.Version())
+}
+
+// GetUninstallHookCommands returns the commands to run in order when uninstalling the
+// installed tooth.
+func GetUninstallHookCommands(metadata tooth.Metadata) ([]HookCommand, error) {
+	commands, err := metadata.Commands()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commands of installed tooth\n\t%w", err)
+	}
+
+	hookCommands := make([]HookCommand, 0)
+	for _, command := range commands.PreUninstall {
+		hookCommands = append(hookCommands, HookCommand{metadata.ToothRepoPath(), hookPreUninstall, command})
+	}
+
+	for _, command := range commands.PostUninstall {
+		hookCommands = append(hookCommands, HookCommand{metadata.ToothRepoPath(), hookPostUninstall, command})
+	}
+
+	return hookCommands, nil
+}
+
+// GetTeethUninstallHookCommands returns the commands to run in order when uninstalling
+// the installed teeth in the given order.
+func GetTeethUninstallHookCommands(ctx *context.Context, toothRepoPaths []string) ([]HookCommand, error) {
+	hookCommands := make([]HookCommand, 0)
+	for _, toothRepoPath := range toothRepoPaths {
+		metadata, err := tooth.GetMetadata(ctx, toothRepoPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find installed tooth metadata\n\t%w", err)
+		}
+
+		uninstallHookCommands, err := GetUninstallHookCommands(metadata)
+		if err != nil {
+			return nil, err
+		}
+
+		hookCommands = append(hookCommands, uninstallHookCommands...)
+	}
+
+	return hookCommands, nil
+}
+
+// LogHookCommands lists the hook commands to run, so that they can be reviewed before
+// confirming.
+func LogHookCommands(hookCommands []HookCommand) {
+	if len(hookCommands) == 0 {
+		return
+	}
+
+	log.Info("The following hook commands will run:")
+	for _, hookCommand := range hookCommands {
+		log.Infof("  %v (%v): %v", hookCommand.ToothRepoPath, hookCommand.Hook, hookCommand.Command)
+	}
+}
+
+// hookEnvironment is the environment commands of a tooth run in. Commands run in the
+// workspace directory with the environment of lip plus environs.
+type hookEnvironment struct {
+	workspaceDir path.Path
+	environs     map[string]string
+}
+
+// newHookEnvironment makes the environment for running commands of the tooth.
+// previousVersion is the version being replaced when upgrading, reinstalling or
+// downgrading, and empty otherwise. The metadata is written to a file in the staging
+// directory of tx, so that commands can read it.
+func newHookEnvironment(ctx *context.Context, tx *Transaction, metadata tooth.Metadata,
+	previousVersion string) (hookEnvironment, error) {
+
+	localDotLipDir, err := ctx.LocalDotLipDir()
+	if err != nil {
+		return hookEnvironment{}, fmt.Errorf("failed to get local .lip directory\n\t%w", err)
+	}
+
+	workspaceDir, err := localDotLipDir.Dir()
+	if err != nil {
+		return hookEnvironment{}, fmt.Errorf("failed to get workspace directory\n\t%w", err)
+	}
+
+	jsonBytes, err := metadata.MarshalJSON()
+	if err != nil {
+		return hookEnvironment{}, fmt.Errorf("failed to marshal metadata\n\t%w", err)
+	}
+
+	metadataFilePath, err := tx.newStagingPath()
+	if err != nil {
+		return hookEnvironment{}, fmt.Errorf("failed to get staging path\n\t%w", err)
+	}
+
+	if err := os.WriteFile(metadataFilePath.LocalString(), jsonBytes, 0644); err != nil {
+		return hookEnvironment{}, fmt.Errorf("failed to write metadata file for commands\n\t%w", err)
+	}
+
+	environs := map[string]string{
+		"LIP_TOOTH":            metadata.ToothRepoPath(),
+		"LIP_VERSION":          metadata.Version().String(),
+		"LIP_PREVIOUS_VERSION": previousVersion,
+		"LIP_WORKSPACE":        workspaceDir.LocalString(),
+		"LIP_GOOS":             runtime.GOOS,
+		"LIP_GOARCH":           runtime.GOARCH,
+		"LIP_METADATA_FILE":    metadataFilePath.LocalString(),
+	}
+
+	proxyURL, err := ctx.ProxyURL()
+	if err != nil {
+		return hookEnvironment{}, fmt.Errorf("failed to get proxy URL\n\t%w", err)
+	}
+
+	if proxyURL.String() != "" {
+		environs["HTTP_PROXY"] = proxyURL.String()
+		environs["HTTPS_PROXY"] = proxyURL.String()
+	}
+
+	return hookEnvironment{
+		workspaceDir: workspaceDir,
+		environs:     environs,
+	}, nil
+}
+
+// runCommands runs the given commands of the hook in the environment. A failing command
+// stops the hook unless it allows continuing on errors. Interrupting lip always stops the
+// hook.
+func runCommands(ctx *context.Context, env hookEnvironment, hook string, commands []tooth.Command) error {
 	debugLogger := log.WithFields(log.Fields{
 		"package": "install",
 		"method":  "runCommands",
 	})
 
 	for _, command := range commands {
-		var cmd *exec.Cmd
-		switch runtime.GOOS {
-		case "windows":
-			cmd = exec.Command("cmd", "/C", command)
-		default:
-			cmd = exec.Command("sh", "-c", command)
+		err := runCommand(ctx, env, hook, command)
+		if err != nil && command.ContinueOnError && ctx.GoContext().Err() == nil {
+			log.Warnf("%v command %v failed, continuing as it allows errors\n\t%v", hook, command, err.Error())
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to run command %v\n\t%w", command, err)
 		}
 
-		cmd.Stdin = os.Stdin
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+		debugLogger.Debugf("Ran command %v", command)
+	}
+
+	return nil
+}
+
+// runCommand runs a command of the hook in the environment. If lip is interrupted, the
+// signal is passed on to the process group of the command, which is killed if it does not
+// exit within hookKillDelay. The process group is also killed if the command times out.
+// Commands sharing the process group of lip have got Ctrl-C from the terminal already, so
+// SIGINT is not passed on to them.
+func runCommand(ctx *context.Context, env hookEnvironment, hook string, command tooth.Command) error {
+	environs := make(map[string]string)
+	for key, value := range env.environs {
+		environs[key] = value
+	}
+	environs["LIP_HOOK"] = hook
+	for key, value := range command.Env {
+		environs[key] = value
+	}
+
+	keys := make([]string, 0, len(environs))
+	for key := range environs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
 
-		for key, value := range environs {
-			cmd.Env = append(os.Environ(), fmt.Sprintf("%v=%v", key, value))
+	cmdEnv := os.Environ()
+	for _, key := range keys {
+		cmdEnv = append(cmdEnv, fmt.Sprintf("%v=%v", key, environs[key]))
+	}
+
+	if err := ctx.GoContext().Err(); err != nil {
+		return fmt.Errorf("interrupted\n\t%w", err)
+	}
+
+	args := getCommandArgs(command)
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Dir = env.workspaceDir.Join(command.Cwd).LocalString()
+	cmd.Env = cmdEnv
+	hasProcessGroup := setProcessGroup(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// The command may have taken the terminal, which is given back after it exits.
+	defer func() {
+		if err := restoreForeground(cmd); err != nil {
+			log.Warnf("Failed to take back the terminal from command %v\n\t%v", command, err)
 		}
+	}()
 
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to run command %v\n\t%w", command, err)
+	waitErrChan := make(chan error, 1)
+	go func() {
+		waitErrChan <- cmd.Wait()
+	}()
+
+	// A nil channel never receives, so commands without a timeout never time out.
+	var timeoutChan <-chan time.Time
+	if command.Timeout != 0 {
+		timer := time.NewTimer(command.Timeout)
+		defer timer.Stop()
+		timeoutChan = timer.C
+	}
+
+	select {
+	case err := <-waitErrChan:
+		return err
+
+	case <-timeoutChan:
+		killProcessGroup(cmd, hasProcessGroup)
+		<-waitErrChan
+		return fmt.Errorf("timed out after %v", command.Timeout)
+
+	case <-ctx.GoContext().Done():
+		if sig := ctx.InterruptSignal(); hasProcessGroup || sig != os.Interrupt {
+			signalProcessGroup(cmd, hasProcessGroup, sig)
 		}
 
-		debugLogger.Debugf("Ran command %v", command)
+		select {
+		case <-waitErrChan:
+		case <-time.After(hookKillDelay):
+			log.Warnf("Command %v did not exit in %v after being interrupted, killing it", command, hookKillDelay)
+			killProcessGroup(cmd, hasProcessGroup)
+			<-waitErrChan
+		}
+
+		return fmt.Errorf("interrupted\n\t%w", ctx.GoContext().Err())
 	}
+}
 
-	return nil
+// getCommandArgs returns the program and its arguments to run the command. A command line
+// is passed to the shell with the flag the shell takes a command line with.
+func getCommandArgs(command tooth.Command) []string {
+	if command.Args != nil && command.Shell == "" {
+		return command.Args
+	} else if command.Args != nil {
+		return append([]string{command.Shell}, command.Args...)
+	}
+
+	shell := command.Shell
+	if shell == "" && runtime.GOOS == "windows" {
+		shell = "cmd"
+	} else if shell == "" {
+		shell = "sh"
+	}
+
+	shellName := strings.TrimSuffix(strings.ToLower(filepath.Base(shell)), ".exe")
+	switch shellName {
+	case "cmd":
+		return []string{shell, "/C", command.Script}
+
+	case "powershell", "pwsh":
+		return []string{shell, "-Command", command.Script}
+
+	default:
+		return []string{shell, "-c", command.Script}
+	}
 }
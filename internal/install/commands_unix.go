@@ -0,0 +1,72 @@
+//go:build !windows
+
+package install
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// setProcessGroup makes the command run in a process group of its own, so that signals
+// reach every process started by it, and returns true. If the standard input is the
+// terminal lip runs in the foreground of, the process group of the command is put in the
+// foreground instead, as only the foreground process group can read the terminal. Such a
+// command gets Ctrl-C from the terminal instead of lip, and restoreForeground must be
+// called after it exits.
+func setProcessGroup(cmd *exec.Cmd) bool {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	stdinFd := int(os.Stdin.Fd())
+	if foregroundPgrp, err := unix.IoctlGetInt(stdinFd, unix.TIOCGPGRP); err == nil &&
+		foregroundPgrp == syscall.Getpgrp() {
+		cmd.SysProcAttr.Foreground = true
+		cmd.SysProcAttr.Ctty = stdinFd
+	}
+
+	return true
+}
+
+// restoreForeground puts the process group of lip back in the foreground of the terminal
+// if the command was put in the foreground.
+func restoreForeground(cmd *exec.Cmd) error {
+	if cmd.SysProcAttr == nil || !cmd.SysProcAttr.Foreground {
+		return nil
+	}
+
+	// lip is in the background now, and would be stopped by SIGTTOU when changing the
+	// foreground process group.
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+
+	return unix.IoctlSetPointerInt(cmd.SysProcAttr.Ctty, unix.TIOCSPGRP, syscall.Getpgrp())
+}
+
+// signalProcessGroup sends the signal to the process group of the started command, or to
+// the command only if it has no process group of its own. Signals other than Unix signals
+// are sent as SIGTERM.
+func signalProcessGroup(cmd *exec.Cmd, hasProcessGroup bool, sig os.Signal) error {
+	unixSignal, ok := sig.(syscall.Signal)
+	if !ok {
+		unixSignal = syscall.SIGTERM
+	}
+
+	if !hasProcessGroup {
+		return cmd.Process.Signal(unixSignal)
+	}
+
+	return syscall.Kill(-cmd.Process.Pid, unixSignal)
+}
+
+// killProcessGroup kills the process group of the started command, or the command only
+// if it has no process group of its own.
+func killProcessGroup(cmd *exec.Cmd, hasProcessGroup bool) error {
+	if !hasProcessGroup {
+		return cmd.Process.Kill()
+	}
+
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,37 @@
+//go:build windows
+
+package install
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// setProcessGroup does nothing and returns false, as Windows has no process groups to
+// send signals to. Commands share the console of lip, so they get Ctrl+C from it together
+// with lip.
+func setProcessGroup(cmd *exec.Cmd) bool {
+	return false
+}
+
+// restoreForeground does nothing, as commands never take the console from lip.
+func restoreForeground(cmd *exec.Cmd) error {
+	return nil
+}
+
+// signalProcessGroup kills the started command and the processes started by it, as
+// signals cannot be sent to processes on Windows.
+func signalProcessGroup(cmd *exec.Cmd, hasProcessGroup bool, sig os.Signal) error {
+	return killProcessGroup(cmd, hasProcessGroup)
+}
+
+// killProcessGroup kills the started command and the processes started by it with
+// taskkill. Only the command is killed if taskkill fails.
+func killProcessGroup(cmd *exec.Cmd, hasProcessGroup bool) error {
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run(); err != nil {
+		return cmd.Process.Kill()
+	}
+
+	return nil
+}
@@ -2,6 +2,8 @@ package install
 
 import (
 	"archive/zip"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/url"
@@ -11,68 +13,233 @@ import (
 
 	"github.com/lippkg/lip/internal/context"
 	"github.com/lippkg/lip/internal/path"
+	"github.com/lippkg/lip/internal/prompt"
 	"github.com/lippkg/lip/internal/tooth"
 	log "github.com/sirupsen/logrus"
 )
 
 // Install installs a tooth archive with an asset archive. If assetArchiveFilePath is empty,
-// will use the tooth archive as the asset archive.
-func Install(ctx *context.Context, archive tooth.Archive, yes bool) error {
+// will use the tooth archive as the asset archive. Every change to the workspace is
+// recorded in tx so that it can be rolled back if the installation fails. installReason,
+// either tooth.InstallReasonExplicit or tooth.InstallReasonDependency, and source are
+// recorded in the manifest. If allowOverwrite is true, files owned by other installed
+// teeth can be overwritten. If ignoreScripts is true, no commands are run.
+func Install(ctx *context.Context, tx *Transaction, archive tooth.Archive, installReason string,
+	source tooth.Source, yes bool, allowOverwrite bool, ignoreScripts bool) error {
 	debugLogger := log.WithFields(log.Fields{
 		"package": "install",
 		"method":  "Install",
 	})
 
-	commandEnvirons := make(map[string]string)
+	// 1. Check if the tooth is already installed.
+
+	if installed, err := tooth.IsInstalled(ctx, archive.Metadata().ToothRepoPath()); err != nil {
+		return fmt.Errorf("failed to check if tooth is installed\n\t%w", err)
+	} else if installed {
+		return fmt.Errorf("tooth %v is already installed", archive.Metadata().ToothRepoPath())
+	}
+	debugLogger.Debug("Checked if tooth is already installed")
+
+	// 2. Check if any file to place is owned by another tooth.
 
-	proxyURL, err := ctx.ProxyURL()
+	if err := CheckFileConflicts(ctx, archive.Metadata(), allowOverwrite); err != nil {
+		return err
+	}
+	debugLogger.Debug("Checked file conflicts")
+
+	// 3. Extract files to the staging directory.
+
+	stagedFilePaths, err := stageFiles(ctx, tx, archive)
 	if err != nil {
-		return fmt.Errorf("failed to get proxy URL\n\t%w", err)
+		return fmt.Errorf("failed to stage files\n\t%w", err)
 	}
+	debugLogger.Debug("Staged files")
 
-	if proxyURL.String() != "" {
-		commandEnvirons = map[string]string{
-			"HTTP_PROXY":  proxyURL.String(),
-			"HTTPS_PROXY": proxyURL.String(),
-		}
+	// 4. Install the staged files.
+
+	commands, err := archive.Metadata().Commands()
+	if err != nil {
+		return fmt.Errorf("failed to get commands\n\t%w", err)
 	}
 
-	// 1. Check if the tooth is already installed.
+	if ignoreScripts {
+		commands = tooth.Commands{}
+	}
+
+	return installStaged(ctx, tx, archive, commands, installReason, source, stagedFilePaths, "", yes)
+}
+
+// Upgrade replaces an installed tooth with the tooth archive, which can be of any version.
+// The files of the new version are extracted before the installed version is uninstalled,
+// so a broken archive leaves the installed version untouched. If the new version is newer
+// and has upgrade commands, they run instead of the uninstall commands of the installed
+// version and the install commands of the new version. Every change to the workspace is recorded
+// in tx so that the installed version can be restored if the upgrade fails. If
+// allowOverwrite is true, files owned by other installed teeth can be overwritten. If
+// ignoreScripts is true, no commands are run.
+func Upgrade(ctx *context.Context, tx *Transaction, archive tooth.Archive, installReason string,
+	source tooth.Source, yes bool, allowOverwrite bool, ignoreScripts bool) error {
+	debugLogger := log.WithFields(log.Fields{
+		"package": "install",
+		"method":  "Upgrade",
+	})
+
+	// 1. Check if the tooth is installed.
 
 	if installed, err := tooth.IsInstalled(ctx, archive.Metadata().ToothRepoPath()); err != nil {
 		return fmt.Errorf("failed to check if tooth is installed\n\t%w", err)
-	} else if installed {
-		return fmt.Errorf("tooth %v is already installed", archive.Metadata().ToothRepoPath())
+	} else if !installed {
+		return fmt.Errorf("tooth %v is not installed", archive.Metadata().ToothRepoPath())
 	}
-	debugLogger.Debug("Checked if tooth is already installed")
+	debugLogger.Debug("Checked if tooth is installed")
 
-	// 2. Run pre-install commands.
+	// 2. Check if any file to place is owned by another tooth.
 
-	if err := runCommands(archive.Metadata().Commands().PreInstall, commandEnvirons); err != nil {
-		return fmt.Errorf("failed to run pre-install commands\n\t%w", err)
+	if err := CheckFileConflicts(ctx, archive.Metadata(), allowOverwrite); err != nil {
+		return err
 	}
-	debugLogger.Debug("Ran pre-install commands")
+	debugLogger.Debug("Checked file conflicts")
+
+	// 3. Extract files of the new version to the staging directory.
+
+	stagedFilePaths, err := stageFiles(ctx, tx, archive)
+	if err != nil {
+		return fmt.Errorf("failed to stage files\n\t%w", err)
+	}
+	debugLogger.Debug("Staged files")
 
-	// 3. Extract and place files.
+	currentMetadata, err := tooth.GetMetadata(ctx, archive.Metadata().ToothRepoPath())
+	if err != nil {
+		return fmt.Errorf("failed to find installed tooth metadata\n\t%w", err)
+	}
 
-	assetFilePath, err := archive.AssetFilePath()
+	previousVersion := currentMetadata.Version().String()
+
+	currentCommands, err := currentMetadata.Commands()
 	if err != nil {
-		return fmt.Errorf("failed to get asset file path of archive %v\n\t%w", archive.FilePath().LocalString(), err)
+		return fmt.Errorf("failed to get commands of the installed version\n\t%w", err)
 	}
 
-	if err := placeFiles(ctx, archive.Metadata(), assetFilePath, yes); err != nil {
+	commands, err := archive.Metadata().Commands()
+	if err != nil {
+		return fmt.Errorf("failed to get commands\n\t%w", err)
+	}
+
+	if ignoreScripts {
+		currentCommands = tooth.Commands{}
+		commands = tooth.Commands{}
+	}
+
+	upgradeCommands := tooth.Commands{}
+	if runsUpgradeCommands(commands, archive.Metadata(), currentMetadata) {
+		upgradeCommands = commands
+		currentCommands = tooth.Commands{}
+		commands = tooth.Commands{}
+	}
+
+	hookEnv, err := newHookEnvironment(ctx, tx, archive.Metadata(), previousVersion)
+	if err != nil {
+		return fmt.Errorf("failed to make environment for commands\n\t%w", err)
+	}
+
+	// 4. Run pre-upgrade commands.
+
+	if err := runCommands(ctx, hookEnv, hookPreUpgrade, upgradeCommands.PreUpgrade); err != nil {
+		return fmt.Errorf("failed to run pre-upgrade commands\n\t%w", err)
+	}
+	debugLogger.Debug("Ran pre-upgrade commands")
+
+	// 5. Uninstall the installed version.
+
+	if err := uninstall(ctx, tx, currentMetadata, currentCommands); err != nil {
+		return fmt.Errorf("failed to uninstall the installed version\n\t%w", err)
+	}
+	debugLogger.Debug("Uninstalled the installed version")
+
+	// 6. Install the staged files of the new version.
+
+	if err := installStaged(ctx, tx, archive, commands, installReason, source, stagedFilePaths,
+		previousVersion, yes); err != nil {
+		return err
+	}
+	debugLogger.Debug("Installed the new version")
+
+	// 7. Run post-upgrade commands.
+
+	if err := runCommands(ctx, hookEnv, hookPostUpgrade, upgradeCommands.PostUpgrade); err != nil {
+		return fmt.Errorf("failed to run post-upgrade commands\n\t%w", err)
+	}
+	debugLogger.Debug("Ran post-upgrade commands")
+
+	// 8. Make the manifest again, so that files changed by post-upgrade commands are not
+	// reported as modified by lip verify.
+
+	if len(upgradeCommands.PostUpgrade) != 0 {
+		manifest, err := makeManifest(archive.Metadata(), installReason, source)
+		if err != nil {
+			return fmt.Errorf("failed to make manifest\n\t%w", err)
+		}
+
+		if err := saveManifest(ctx, tx, manifest); err != nil {
+			return fmt.Errorf("failed to save manifest\n\t%w", err)
+		}
+		debugLogger.Debug("Saved manifest")
+	}
+
+	return nil
+}
+
+// installStaged installs a tooth archive whose files have been staged by stageFiles,
+// running the install commands in commands. previousVersion is the version replaced by
+// the archive, or empty if no version was installed.
+func installStaged(ctx *context.Context, tx *Transaction, archive tooth.Archive, commands tooth.Commands,
+	installReason string, source tooth.Source, stagedFilePaths []path.Path, previousVersion string,
+	yes bool) error {
+	debugLogger := log.WithFields(log.Fields{
+		"package": "install",
+		"method":  "installStaged",
+	})
+
+	hookEnv, err := newHookEnvironment(ctx, tx, archive.Metadata(), previousVersion)
+	if err != nil {
+		return fmt.Errorf("failed to make environment for commands\n\t%w", err)
+	}
+
+	// 1. Run pre-install commands.
+
+	if err := runCommands(ctx, hookEnv, hookPreInstall, commands.PreInstall); err != nil {
+		return fmt.Errorf("failed to run pre-install commands\n\t%w", err)
+	}
+	debugLogger.Debug("Ran pre-install commands")
+
+	// 2. Place files.
+
+	if err := placeFiles(ctx, tx, archive.Metadata(), stagedFilePaths, yes); err != nil {
 		return fmt.Errorf("failed to place files\n\t%w", err)
 	}
 	debugLogger.Debug("Placed files")
 
-	// 4. Run post-install commands.
+	if err := registerOwnedFiles(ctx, tx, archive.Metadata()); err != nil {
+		return fmt.Errorf("failed to register owned files\n\t%w", err)
+	}
+	debugLogger.Debug("Registered owned files")
+
+	// 3. Run post-install commands.
 
-	if err := runCommands(archive.Metadata().Commands().PostInstall, commandEnvirons); err != nil {
+	if err := runCommands(ctx, hookEnv, hookPostInstall, commands.PostInstall); err != nil {
 		return fmt.Errorf("failed to run post-install commands\n\t%w", err)
 	}
 	debugLogger.Debug("Ran post-install commands")
 
-	// 5. Create metadata file.
+	// The manifest is made after post-install commands run, so that files changed by them
+	// are not reported as modified by lip verify.
+	manifest, err := makeManifest(archive.Metadata(), installReason, source)
+	if err != nil {
+		return fmt.Errorf("failed to make manifest\n\t%w", err)
+	}
+	debugLogger.Debug("Made manifest")
+
+	// 4. Create metadata and manifest files.
 
 	jsonBytes, err := archive.Metadata().MarshalJSON()
 	if err != nil {
@@ -87,17 +254,216 @@ func Install(ctx *context.Context, archive tooth.Archive, yes bool) error {
 
 	metadataPath := metadataDir.Join(path.MustParse(metadataFileName))
 
+	if err := tx.Backup(metadataPath); err != nil {
+		return fmt.Errorf("failed to back up metadata file\n\t%w", err)
+	}
+
 	if err := os.WriteFile(metadataPath.LocalString(), jsonBytes, 0644); err != nil {
 		return fmt.Errorf("failed to create metadata file\n\t%w", err)
 	}
 
 	debugLogger.Debugf("Created metadata file %v", metadataPath.LocalString())
 
+	if err := saveManifest(ctx, tx, manifest); err != nil {
+		return fmt.Errorf("failed to save manifest\n\t%w", err)
+	}
+	debugLogger.Debug("Saved manifest")
+
 	return nil
 }
 
-// placeFiles places the files of the tooth.
-func placeFiles(ctx *context.Context, metadata tooth.Metadata, assetArchiveFilePath path.Path, forcePlace bool) error {
+// makeManifest records the files placed by the tooth.
+func makeManifest(metadata tooth.Metadata, installReason string, source tooth.Source) (tooth.Manifest, error) {
+	workspaceDirStr, err := os.Getwd()
+	if err != nil {
+		return tooth.Manifest{}, err
+	}
+
+	workspaceDir, err := path.Parse(workspaceDirStr)
+	if err != nil {
+		return tooth.Manifest{}, fmt.Errorf("failed to parse workspace directory\n\t%w", err)
+	}
+
+	files, err := metadata.Files()
+	if err != nil {
+		return tooth.Manifest{}, fmt.Errorf("failed to get files from metadata\n\t%w", err)
+	}
+
+	manifest := tooth.Manifest{
+		ToothRepoPath: metadata.ToothRepoPath(),
+		Version:       metadata.Version().String(),
+		InstallReason: installReason,
+		Source:        source,
+		Files:         make([]tooth.ManifestFile, 0, len(files.Place)),
+	}
+
+	for _, place := range files.Place {
+		manifestFile, err := tooth.MakeManifestFile(workspaceDir, place.Dest)
+		if errors.Is(err, os.ErrNotExist) {
+			// The source file may be missing from the asset archive.
+			continue
+		} else if err != nil {
+			return tooth.Manifest{}, fmt.Errorf("failed to record file %v\n\t%w", place.Dest, err)
+		}
+
+		manifest.Files = append(manifest.Files, manifestFile)
+	}
+
+	return manifest, nil
+}
+
+// MarkAsExplicit records that the installed tooth is requested by the user, so that it
+// will not be removed as an unused dependency.
+func MarkAsExplicit(ctx *context.Context, tx *Transaction, toothRepoPath string) error {
+	manifest, err := tooth.GetManifest(ctx, toothRepoPath)
+	if errors.Is(err, os.ErrNotExist) {
+		// Teeth without manifests are always taken as explicitly installed.
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get manifest\n\t%w", err)
+	}
+
+	if manifest.InstallReason == tooth.InstallReasonExplicit {
+		return nil
+	}
+
+	manifest.InstallReason = tooth.InstallReasonExplicit
+
+	return saveManifest(ctx, tx, manifest)
+}
+
+// saveManifest writes the manifest file of the tooth.
+func saveManifest(ctx *context.Context, tx *Transaction, manifest tooth.Manifest) error {
+	jsonBytes, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest\n\t%w", err)
+	}
+
+	manifestFilePath, err := tooth.GetManifestFilePath(ctx, manifest.ToothRepoPath)
+	if err != nil {
+		return fmt.Errorf("failed to get manifest file path\n\t%w", err)
+	}
+
+	if err := tx.Backup(manifestFilePath); err != nil {
+		return fmt.Errorf("failed to back up manifest file\n\t%w", err)
+	}
+
+	if err := os.WriteFile(manifestFilePath.LocalString(), jsonBytes, 0644); err != nil {
+		return fmt.Errorf("failed to create manifest file\n\t%w", err)
+	}
+
+	return nil
+}
+
+// stageFiles extracts the files to place from the asset archive to the staging directory
+// of tx, and returns the staged path of each item in files.place. The staged path is empty
+// if the source file is not in the asset archive. It stops before the next file if lip is
+// interrupted.
+func stageFiles(ctx *context.Context, tx *Transaction, archive tooth.Archive) ([]path.Path, error) {
+	debugLogger := log.WithFields(log.Fields{
+		"package": "install",
+		"method":  "stageFiles",
+	})
+
+	assetArchiveFilePath, err := archive.AssetFilePath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get asset file path of archive %v\n\t%w",
+			archive.FilePath().LocalString(), err)
+	}
+
+	// Open the archive.
+	r, err := zip.OpenReader(assetArchiveFilePath.LocalString())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open zip reader\n\t%w", err)
+	}
+	defer r.Close()
+
+	files, err := archive.Metadata().Files()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get files from metadata\n\t%w", err)
+	}
+
+	// Index the files in the archive by their paths.
+	archiveFileMap := make(map[string]*zip.File)
+	for _, f := range r.File {
+		// Skip directories.
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+
+		filePath, err := path.Parse(f.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse file path from %v\n\t%w", f.Name, err)
+		}
+
+		archiveFileMap[filePath.String()] = f
+	}
+
+	stagedFilePaths := make([]path.Path, 0, len(files.Place))
+	for _, place := range files.Place {
+		if err := ctx.GoContext().Err(); err != nil {
+			return nil, fmt.Errorf("interrupted while staging files\n\t%w", err)
+		}
+
+		f, ok := archiveFileMap[place.Src.String()]
+		if !ok {
+			debugLogger.Debugf("Source file %v not found in asset archive %v", place.Src,
+				assetArchiveFilePath.LocalString())
+
+			stagedFilePaths = append(stagedFilePaths, path.MakeEmpty())
+			continue
+		}
+
+		stagedFilePath, err := tx.newStagingPath()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get staging path\n\t%w", err)
+		}
+
+		if err := extractFile(f, stagedFilePath); err != nil {
+			return nil, fmt.Errorf("failed to extract %v\n\t%w", f.Name, err)
+		}
+
+		debugLogger.Debugf("Staged %v to %v", f.Name, stagedFilePath.LocalString())
+
+		stagedFilePaths = append(stagedFilePaths, stagedFilePath)
+	}
+
+	return stagedFilePaths, nil
+}
+
+// extractFile extracts a file in a zip archive to the given path. The partially written
+// file is removed if extracting fails.
+func extractFile(f *zip.File, dest path.Path) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open source file\n\t%w", err)
+	}
+	defer rc.Close()
+
+	fw, err := os.Create(dest.LocalString())
+	if err != nil {
+		return fmt.Errorf("failed to create destination file\n\t%w", err)
+	}
+
+	if _, err := io.Copy(fw, rc); err != nil {
+		fw.Close()
+		os.Remove(dest.LocalString())
+		return fmt.Errorf("failed to copy file\n\t%w", err)
+	}
+
+	if err := fw.Close(); err != nil {
+		os.Remove(dest.LocalString())
+		return fmt.Errorf("failed to close destination file\n\t%w", err)
+	}
+
+	return nil
+}
+
+// placeFiles moves the staged files of the tooth to their destinations. Existing
+// destinations are backed up in tx instead of being removed. It stops before the next file
+// if lip is interrupted, leaving the placed files to be removed by rolling back tx.
+func placeFiles(ctx *context.Context, tx *Transaction, metadata tooth.Metadata, stagedFilePaths []path.Path,
+	forcePlace bool) error {
 	debugLogger := log.WithFields(log.Fields{
 		"package": "install",
 		"method":  "placeFiles",
@@ -113,19 +479,20 @@ func placeFiles(ctx *context.Context, metadata tooth.Metadata, assetArchiveFileP
 		return err
 	}
 
-	// Open the archive.
-	r, err := zip.OpenReader(assetArchiveFilePath.LocalString())
-	if err != nil {
-		return fmt.Errorf("failed to open zip reader\n\t%w", err)
-	}
-	defer r.Close()
-
 	files, err := metadata.Files()
 	if err != nil {
 		return fmt.Errorf("failed to get files from metadata\n\t%w", err)
 	}
 
-	for _, place := range files.Place {
+	if len(files.Place) != len(stagedFilePaths) {
+		return fmt.Errorf("number of staged files does not match files.place")
+	}
+
+	for i, place := range files.Place {
+		if err := ctx.GoContext().Err(); err != nil {
+			return fmt.Errorf("interrupted while placing files\n\t%w", err)
+		}
+
 		relDest := place.Dest
 
 		// Check if the destination exists.
@@ -133,70 +500,78 @@ func placeFiles(ctx *context.Context, metadata tooth.Metadata, assetArchiveFileP
 			if !forcePlace {
 				// Ask for confirmation.
 				log.Infof("Destination %v already exists", relDest.LocalString())
-				log.Info("Do you want to remove? [y/N]")
-				var ans string
-				fmt.Scanln(&ans)
-				if ans != "y" && ans != "Y" {
+				if ok, err := prompt.Confirm(ctx, "Do you want to remove?"); err != nil {
+					return err
+				} else if !ok {
 					return fmt.Errorf("aborted")
 				}
 			}
 
 			log.Infof("Removing destination %v", relDest.LocalString())
-
-			// Remove the destination if it exists.
-			if err := os.RemoveAll(relDest.LocalString()); err != nil {
-				return fmt.Errorf("failed to remove destination %v\n\t%w", relDest.LocalString(), err)
-			}
 		}
 
 		dest := workspaceDir.Join(relDest)
 
+		// Back up the destination, which also removes it if it exists.
+		if err := tx.Backup(dest); err != nil {
+			return fmt.Errorf("failed to back up destination %v\n\t%w", relDest.LocalString(), err)
+		}
+
+		// Record the topmost directory to be created so that it will be removed on rollback.
+		if err := backupMissingAncestors(tx, workspaceDir, dest); err != nil {
+			return fmt.Errorf("failed to back up destination directory\n\t%w", err)
+		}
+
 		// Create the destination directory.
 		if err := os.MkdirAll(filepath.Dir(dest.LocalString()), 0755); err != nil {
 			return fmt.Errorf("failed to create destination directory\n\t%w", err)
 		}
 		debugLogger.Debugf("Created destination directory %v", filepath.Dir(dest.LocalString()))
 
-		// Iterate through the files in the archive,
-		// and find the source file.
-		for _, f := range r.File {
-			// Skip directories.
-			if strings.HasSuffix(f.Name, "/") {
-				debugLogger.Debugf("Skipped %v because it is a directory", f.Name)
+		// Nothing to place if the source file is not in the asset archive.
+		if stagedFilePaths[i].IsEmpty() {
+			continue
+		}
 
-				continue
-			}
+		if err := movePath(stagedFilePaths[i], dest); err != nil {
+			return fmt.Errorf("failed to move staged file to %v\n\t%w", dest.LocalString(), err)
+		}
 
-			filePath, err := path.Parse(f.Name)
-			if err != nil {
-				return fmt.Errorf("failed to parse file path from %v\n\t%w", f.Name, err)
-			}
+		debugLogger.Debugf("Placed file %v to %v", place.Src, dest.LocalString())
+	}
 
-			if filePath.Equal(place.Src) {
-				// Open the source file.
-				rc, err := f.Open()
-				if err != nil {
-					return fmt.Errorf("failed to open source file\n\t%w", err)
-				}
+	return nil
+}
 
-				fw, err := os.Create(dest.LocalString())
-				if err != nil {
-					return fmt.Errorf("failed to create destination file\n\t%w", err)
-				}
+// backupMissingAncestors records the topmost missing ancestor directory of p inside the
+// workspace directory in tx.
+func backupMissingAncestors(tx *Transaction, workspaceDir path.Path, p path.Path) error {
+	topmostMissingDir := path.MakeEmpty()
 
-				// Copy the file.
-				if _, err := io.Copy(fw, rc); err != nil {
-					return fmt.Errorf("failed to copy file\n\t%w", err)
-				}
+	currentPath := p
+	for {
+		dir, err := currentPath.Dir()
+		if err != nil {
+			return fmt.Errorf("failed to parse directory\n\t%w", err)
+		}
 
-				// Close the files.
-				rc.Close()
-				fw.Close()
+		if !workspaceDir.IsAncestorOf(dir) {
+			break
+		}
 
-				debugLogger.Debugf("Placed file %v to %v", f.Name, dest.LocalString())
-			}
+		if _, err := os.Stat(dir.LocalString()); err == nil {
+			break
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("failed to get info of %v\n\t%w", dir.LocalString(), err)
 		}
+
+		topmostMissingDir = dir
+		currentPath = dir
 	}
 
-	return nil
+	if topmostMissingDir.IsEmpty() {
+		return nil
+	}
+
+	return tx.Backup(topmostMissingDir)
 }
@@ -0,0 +1,31 @@
+package install
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lippkg/lip/internal/context"
+	"github.com/lippkg/lip/internal/lock"
+	"github.com/lippkg/lip/internal/path"
+)
+
+// LockWorkspace acquires the lock on the local .lip directory, which must be held by
+// commands changing the workspace. If the workspace is locked by another lip process,
+// it returns an error unless wait is true, in which case it waits for the lock until lip is interrupted.
+func LockWorkspace(ctx *context.Context, wait bool) (*lock.Lock, error) {
+	localDotLipDir, err := ctx.LocalDotLipDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get local .lip directory\n\t%w", err)
+	}
+
+	workspaceLock, err := lock.Acquire(ctx.GoContext(), localDotLipDir.Join(path.MustParse("workspace.lock")), wait)
+
+	var lockedErr *lock.LockedError
+	if errors.As(err, &lockedErr) {
+		return nil, fmt.Errorf("workspace is locked by PID %v, use --wait-lock to wait for it", lockedErr.Holder)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to lock workspace\n\t%w", err)
+	}
+
+	return workspaceLock, nil
+}
@@ -0,0 +1,73 @@
+package install
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/lippkg/lip/internal/context"
+	"github.com/lippkg/lip/internal/tooth"
+)
+
+// SaveLockFile writes the lockfile of the workspace from the manifests of the installed
+// teeth. It should be called after all changes to the installed teeth are made in tx.
+// Teeth installed by older versions of lip have no manifest and are recorded without
+// sources.
+func SaveLockFile(ctx *context.Context, tx *Transaction) error {
+	metadataList, err := tooth.GetAllMetadata(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list all installed teeth\n\t%w", err)
+	}
+
+	lockFile := tooth.LockFile{
+		FormatVersion: tooth.LockFileFormatVersion,
+		Teeth:         make([]tooth.LockedTooth, 0, len(metadataList)),
+	}
+
+	for _, metadata := range metadataList {
+		lockedTooth := tooth.LockedTooth{
+			ToothRepoPath: metadata.ToothRepoPath(),
+			Version:       metadata.Version().String(),
+			InstallReason: tooth.InstallReasonExplicit,
+			Features:      metadata.EnabledFeatures(),
+		}
+
+		manifest, err := tooth.GetManifest(ctx, metadata.ToothRepoPath())
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to get manifest of %v\n\t%w", metadata.ToothRepoPath(), err)
+		} else if err == nil {
+			if manifest.InstallReason != "" {
+				lockedTooth.InstallReason = manifest.InstallReason
+			}
+			lockedTooth.Source = manifest.Source
+		}
+
+		lockFile.Teeth = append(lockFile.Teeth, lockedTooth)
+	}
+
+	sort.Slice(lockFile.Teeth, func(i, j int) bool {
+		return lockFile.Teeth[i].ToothRepoPath < lockFile.Teeth[j].ToothRepoPath
+	})
+
+	jsonBytes, err := json.MarshalIndent(lockFile, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal lockfile\n\t%w", err)
+	}
+
+	lockFilePath, err := tooth.GetLockFilePath(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get lockfile path\n\t%w", err)
+	}
+
+	if err := tx.Backup(lockFilePath); err != nil {
+		return fmt.Errorf("failed to back up lockfile\n\t%w", err)
+	}
+
+	if err := os.WriteFile(lockFilePath.LocalString(), jsonBytes, 0644); err != nil {
+		return fmt.Errorf("failed to create lockfile\n\t%w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package install
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/lippkg/lip/internal/context"
+	"github.com/lippkg/lip/internal/path"
+	"github.com/lippkg/lip/internal/tooth"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// CheckFileConflicts checks whether any file to be placed by the tooth is owned by
+// another installed tooth. If allowOverwrite is true, conflicts are only logged.
+func CheckFileConflicts(ctx *context.Context, metadata tooth.Metadata, allowOverwrite bool) error {
+	fileOwners, err := tooth.GetFileOwners(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get file owners\n\t%w", err)
+	}
+
+	files, err := metadata.Files()
+	if err != nil {
+		return fmt.Errorf("failed to get files from metadata\n\t%w", err)
+	}
+
+	conflicts := make([]string, 0)
+	for _, place := range files.Place {
+		for ownedFilePathString, owner := range fileOwners {
+			if owner == metadata.ToothRepoPath() {
+				continue
+			}
+
+			ownedFilePath, err := path.Parse(ownedFilePathString)
+			if err != nil {
+				return fmt.Errorf("failed to parse file path %v\n\t%w", ownedFilePathString, err)
+			}
+
+			if place.Dest.Equal(ownedFilePath) || place.Dest.IsAncestorOf(ownedFilePath) ||
+				ownedFilePath.IsAncestorOf(place.Dest) {
+				conflicts = append(conflicts, fmt.Sprintf("%v (owned by %v)", ownedFilePath, owner))
+			}
+		}
+	}
+
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	sort.Strings(conflicts)
+
+	if !allowOverwrite {
+		return fmt.Errorf("files to be placed by %v conflict with files of other teeth: %v",
+			metadata.ToothRepoPath(), strings.Join(conflicts, ", "))
+	}
+
+	for _, conflict := range conflicts {
+		log.Warnf("Overwriting %v", conflict)
+	}
+
+	return nil
+}
+
+// GetOtherOwners returns the teeth other than the tooth owning files at or under the
+// path, sorted. The path must not be removed along with the tooth if any are returned.
+func GetOtherOwners(fileOwners map[string]string, toothRepoPath string, filePath path.Path) ([]string,
+	error) {
+
+	isOtherOwner := make(map[string]bool)
+	for ownedFilePathString, owner := range fileOwners {
+		if owner == toothRepoPath {
+			continue
+		}
+
+		ownedFilePath, err := path.Parse(ownedFilePathString)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse file path %v\n\t%w", ownedFilePathString, err)
+		}
+
+		if filePath.Equal(ownedFilePath) || filePath.IsAncestorOf(ownedFilePath) {
+			isOtherOwner[owner] = true
+		}
+	}
+
+	otherOwners := make([]string, 0, len(isOtherOwner))
+	for owner := range isOtherOwner {
+		otherOwners = append(otherOwners, owner)
+	}
+	sort.Strings(otherOwners)
+
+	return otherOwners, nil
+}
+
+// registerOwnedFiles records the tooth as the owner of the files it places. Records of
+// files overwritten by the tooth are replaced.
+func registerOwnedFiles(ctx *context.Context, tx *Transaction, metadata tooth.Metadata) error {
+	fileOwners, err := tooth.GetFileOwners(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get file owners\n\t%w", err)
+	}
+
+	files, err := metadata.Files()
+	if err != nil {
+		return fmt.Errorf("failed to get files from metadata\n\t%w", err)
+	}
+
+	for _, place := range files.Place {
+		// Files under the destination are gone after placing.
+		for ownedFilePathString := range fileOwners {
+			ownedFilePath, err := path.Parse(ownedFilePathString)
+			if err != nil {
+				return fmt.Errorf("failed to parse file path %v\n\t%w", ownedFilePathString, err)
+			}
+
+			if place.Dest.IsAncestorOf(ownedFilePath) {
+				delete(fileOwners, ownedFilePathString)
+			}
+		}
+
+		fileOwners[place.Dest.String()] = metadata.ToothRepoPath()
+	}
+
+	return saveFileOwners(ctx, tx, fileOwners)
+}
+
+// unregisterOwnedFiles removes all records of the files owned by the tooth.
+func unregisterOwnedFiles(ctx *context.Context, tx *Transaction, toothRepoPath string) error {
+	fileOwners, err := tooth.GetFileOwners(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get file owners\n\t%w", err)
+	}
+
+	for filePathString, owner := range fileOwners {
+		if owner == toothRepoPath {
+			delete(fileOwners, filePathString)
+		}
+	}
+
+	return saveFileOwners(ctx, tx, fileOwners)
+}
+
+func saveFileOwners(ctx *context.Context, tx *Transaction, fileOwners map[string]string) error {
+	debugLogger := log.WithFields(log.Fields{
+		"package": "install",
+		"method":  "saveFileOwners",
+	})
+
+	fileOwnersFilePath, err := tooth.GetFileOwnersFilePath(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get file owners file path\n\t%w", err)
+	}
+
+	jsonBytes, err := json.MarshalIndent(fileOwners, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal file owners\n\t%w", err)
+	}
+
+	if err := tx.Backup(fileOwnersFilePath); err != nil {
+		return fmt.Errorf("failed to back up file owners file\n\t%w", err)
+	}
+
+	if err := os.WriteFile(fileOwnersFilePath.LocalString(), jsonBytes, 0644); err != nil {
+		return fmt.Errorf("failed to write file owners file\n\t%w", err)
+	}
+
+	debugLogger.Debugf("Saved file owners to %v", fileOwnersFilePath.LocalString())
+
+	return nil
+}
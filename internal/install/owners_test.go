@@ -0,0 +1,128 @@
+package install
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/blang/semver/v4"
+	"github.com/lippkg/lip/internal/context"
+	"github.com/lippkg/lip/internal/path"
+	"github.com/lippkg/lip/internal/tooth"
+)
+
+func TestCheckFileConflicts(t *testing.T) {
+	fileOwners := map[string]string{
+		"plugins/foo.dll":        "example.com/foo",
+		"plugins/foo/config.yml": "example.com/foo",
+		"worlds/bar/level.dat":   "example.com/bar",
+	}
+
+	testCases := []struct {
+		name           string
+		dests          []string
+		allowOverwrite bool
+		wantErr        bool
+	}{
+		{
+			name:  "no owned files",
+			dests: []string{"plugins/baz.dll", "plugins/baz/config.yml"},
+		},
+		{
+			name:  "files owned by the tooth itself",
+			dests: []string{"worlds/bar/level.dat"},
+		},
+		{
+			name:  "sibling with common prefix",
+			dests: []string{"plugins/foo.dll.bak", "plugins/foobar/config.yml"},
+		},
+		{
+			name:    "same file",
+			dests:   []string{"plugins/baz.dll", "plugins/foo.dll"},
+			wantErr: true,
+		},
+		{
+			name:    "directory containing owned files",
+			dests:   []string{"plugins/foo"},
+			wantErr: true,
+		},
+		{
+			name:    "file under owned file",
+			dests:   []string{"plugins/foo.dll/baz.dll"},
+			wantErr: true,
+		},
+		{
+			name:           "overwrite allowed",
+			dests:          []string{"plugins/foo.dll"},
+			allowOverwrite: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			jsonBytes, err := json.Marshal(fileOwners)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			setUpWorkspace(t, map[string]string{".lip/file_owners.json": string(jsonBytes)})
+
+			rawMetadata := tooth.RawMetadata{
+				FormatVersion: 2,
+				Tooth:         "example.com/bar",
+				Version:       "1.0.0",
+			}
+			for _, dest := range testCase.dests {
+				rawMetadata.Files.Place = append(rawMetadata.Files.Place, tooth.RawMetadataFilesPlaceItem{
+					Src:  "src",
+					Dest: dest,
+				})
+			}
+
+			metadata, err := tooth.MakeMetadataFromRaw(rawMetadata)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = CheckFileConflicts(context.New(context.Config{}, semver.Version{}), metadata,
+				testCase.allowOverwrite)
+			if (err != nil) != testCase.wantErr {
+				t.Errorf("CheckFileConflicts() error = %v, want error %v", err, testCase.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetOtherOwners(t *testing.T) {
+	fileOwners := map[string]string{
+		"plugins/foo.dll":        "example.com/foo",
+		"plugins/foo/config.yml": "example.com/foo",
+		"plugins/bar/config.yml": "example.com/bar",
+		"plugins/bar.dll":        "example.com/bar",
+	}
+
+	testCases := []struct {
+		filePath string
+		want     []string
+	}{
+		{"plugins/foo.dll", []string{"example.com/foo"}},
+		{"plugins/foo", []string{"example.com/foo"}},
+		{"plugins", []string{"example.com/foo"}},
+		{"plugins/bar", []string{}},
+		{"plugins/baz", []string{}},
+		{"plugins/foo.dll.bak", []string{}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.filePath, func(t *testing.T) {
+			got, err := GetOtherOwners(fileOwners, "example.com/bar", path.MustParse(testCase.filePath))
+			if err != nil {
+				t.Fatalf("GetOtherOwners() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got, testCase.want) {
+				t.Errorf("GetOtherOwners() = %v, want %v", got, testCase.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package install
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/lippkg/lip/internal/context"
+	"github.com/lippkg/lip/internal/path"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Transaction records every change made to the workspace so that the workspace
+// can be restored to its previous state if anything goes wrong. Changes made by
+// commands run in hooks are not recorded.
+type Transaction struct {
+	backupDir        path.Path
+	records          []transactionRecord
+	recorded         map[string]bool
+	stagingFileCount int
+}
+
+type transactionRecord struct {
+	originalPath path.Path
+	// backupPath is empty if nothing existed at originalPath.
+	backupPath path.Path
+}
+
+// NewTransaction creates a new transaction. Backups are kept under the local .lip
+// directory so that they can be moved back without copying.
+func NewTransaction(ctx *context.Context) (*Transaction, error) {
+	localDotLipDir, err := ctx.LocalDotLipDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get local .lip directory\n\t%w", err)
+	}
+
+	backupDirStr, err := os.MkdirTemp(localDotLipDir.LocalString(), "transaction-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup directory\n\t%w", err)
+	}
+
+	backupDir, err := path.Parse(backupDirStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse backup directory\n\t%w", err)
+	}
+
+	return &Transaction{
+		backupDir: backupDir,
+		records:   make([]transactionRecord, 0),
+		recorded:  make(map[string]bool),
+	}, nil
+}
+
+// Backup moves the file or directory at the given path out of the way so that it
+// can be restored on rollback. It must be called before anything is written to or
+// removed from the path. If nothing exists at the path, whatever is created there
+// later will be removed on rollback.
+func (tx *Transaction) Backup(p path.Path) error {
+	debugLogger := log.WithFields(log.Fields{
+		"package": "install",
+		"method":  "Transaction.Backup",
+	})
+
+	_, err := os.Lstat(p.LocalString())
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to get info of %v\n\t%w", p.LocalString(), err)
+	}
+	exists := err == nil
+
+	// The previous state of the path is already recorded, so whatever is there now
+	// was created by this transaction.
+	if tx.recorded[p.String()] {
+		if exists {
+			if err := os.RemoveAll(p.LocalString()); err != nil {
+				return fmt.Errorf("failed to remove %v\n\t%w", p.LocalString(), err)
+			}
+		}
+
+		return nil
+	}
+
+	record := transactionRecord{
+		originalPath: p,
+		backupPath:   path.MakeEmpty(),
+	}
+
+	if exists {
+		backupPath := tx.backupDir.Join(path.MustParse(strconv.Itoa(len(tx.records))))
+
+		if err := movePath(p, backupPath); err != nil {
+			return fmt.Errorf("failed to back up %v\n\t%w", p.LocalString(), err)
+		}
+
+		record.backupPath = backupPath
+
+		debugLogger.Debugf("Backed up %v to %v", p.LocalString(), backupPath.LocalString())
+	}
+
+	tx.records = append(tx.records, record)
+	tx.recorded[p.String()] = true
+
+	return nil
+}
+
+// newStagingPath returns a new path in the staging directory of the transaction, to
+// which files can be extracted before being moved to the workspace.
+func (tx *Transaction) newStagingPath() (path.Path, error) {
+	stagingDir := tx.backupDir.Join(path.MustParse("staging"))
+
+	if err := os.MkdirAll(stagingDir.LocalString(), 0755); err != nil {
+		return path.Path{}, fmt.Errorf("failed to create staging directory\n\t%w", err)
+	}
+
+	stagingPath := stagingDir.Join(path.MustParse(strconv.Itoa(tx.stagingFileCount)))
+	tx.stagingFileCount++
+
+	return stagingPath, nil
+}
+
+// Commit discards all backups.
+func (tx *Transaction) Commit() error {
+	if err := os.RemoveAll(tx.backupDir.LocalString()); err != nil {
+		return fmt.Errorf("failed to remove backup directory\n\t%w", err)
+	}
+
+	tx.records = nil
+	tx.recorded = nil
+
+	return nil
+}
+
+// Rollback restores every recorded path to its state before the transaction.
+func (tx *Transaction) Rollback() error {
+	debugLogger := log.WithFields(log.Fields{
+		"package": "install",
+		"method":  "Transaction.Rollback",
+	})
+
+	// Restore in reverse order so that directories are restored before the files
+	// in them.
+	for i := len(tx.records) - 1; i >= 0; i-- {
+		record := tx.records[i]
+
+		if err := os.RemoveAll(record.originalPath.LocalString()); err != nil {
+			return fmt.Errorf("failed to remove %v\n\t%w", record.originalPath.LocalString(), err)
+		}
+
+		if record.backupPath.IsEmpty() {
+			debugLogger.Debugf("Removed %v", record.originalPath.LocalString())
+			continue
+		}
+
+		if err := movePath(record.backupPath, record.originalPath); err != nil {
+			return fmt.Errorf("failed to restore %v\n\t%w", record.originalPath.LocalString(), err)
+		}
+
+		debugLogger.Debugf("Restored %v", record.originalPath.LocalString())
+	}
+
+	if err := os.RemoveAll(tx.backupDir.LocalString()); err != nil {
+		return fmt.Errorf("failed to remove backup directory\n\t%w", err)
+	}
+
+	tx.records = nil
+	tx.recorded = nil
+
+	return nil
+}
+
+// RollbackAndLog rolls back the transaction, logging the error instead of returning it,
+// as it is called when another error has already occurred.
+func (tx *Transaction) RollbackAndLog() {
+	log.Info("Rolling back changes...")
+
+	if err := tx.Rollback(); err != nil {
+		log.Errorf("\n\tfailed to roll back changes, the workspace might be left in an inconsistent state\n\t%v",
+			err.Error())
+	}
+}
+
+// movePath moves a file or directory. If it cannot be renamed, e.g. across file
+// systems, it will be copied and then removed.
+func movePath(src path.Path, dest path.Path) error {
+	if err := os.MkdirAll(filepath.Dir(dest.LocalString()), 0755); err != nil {
+		return fmt.Errorf("failed to create directory\n\t%w", err)
+	}
+
+	if err := os.Rename(src.LocalString(), dest.LocalString()); err == nil {
+		return nil
+	}
+
+	if err := copyPath(src.LocalString(), dest.LocalString()); err != nil {
+		return fmt.Errorf("failed to copy %v to %v\n\t%w", src.LocalString(), dest.LocalString(), err)
+	}
+
+	if err := os.RemoveAll(src.LocalString()); err != nil {
+		return fmt.Errorf("failed to remove %v\n\t%w", src.LocalString(), err)
+	}
+
+	return nil
+}
+
+// copyPath recursively copies a file or directory.
+func copyPath(src string, dest string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		if err := os.MkdirAll(dest, info.Mode().Perm()); err != nil {
+			return err
+		}
+
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			if err := copyPath(filepath.Join(src, entry.Name()), filepath.Join(dest, entry.Name())); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	destFile, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer destFile.Close()
+
+	if _, err := io.Copy(destFile, srcFile); err != nil {
+		return err
+	}
+
+	return nil
+}
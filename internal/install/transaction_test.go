@@ -0,0 +1,210 @@
+package install
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/blang/semver/v4"
+	"github.com/lippkg/lip/internal/context"
+	"github.com/lippkg/lip/internal/path"
+)
+
+func TestTransactionRollback(t *testing.T) {
+	testCases := []struct {
+		name string
+		// files maps the paths of the files in the workspace before the transaction to
+		// their contents. Directories are created as needed.
+		files map[string]string
+		// change changes the workspace, backing up every path before changing it.
+		change func(t *testing.T, tx *Transaction, workspaceDir string)
+	}{
+		{
+			name:  "overwritten file",
+			files: map[string]string{"plugins/foo.dll": "old"},
+			change: func(t *testing.T, tx *Transaction, workspaceDir string) {
+				backUpAndWriteFile(t, tx, filepath.Join(workspaceDir, "plugins", "foo.dll"), "new")
+			},
+		},
+		{
+			name:  "created file",
+			files: map[string]string{"plugins/foo.dll": "old"},
+			change: func(t *testing.T, tx *Transaction, workspaceDir string) {
+				backUpAndWriteFile(t, tx, filepath.Join(workspaceDir, "plugins", "bar.dll"), "new")
+			},
+		},
+		{
+			name: "removed directory",
+			files: map[string]string{
+				"plugins/foo/config.json": "{}",
+				"plugins/foo/data/db":     "data",
+			},
+			change: func(t *testing.T, tx *Transaction, workspaceDir string) {
+				dir := filepath.Join(workspaceDir, "plugins", "foo")
+				if err := tx.Backup(path.MustParse(dir)); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := os.RemoveAll(dir); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name:  "file backed up twice",
+			files: map[string]string{"plugins/foo.dll": "old"},
+			change: func(t *testing.T, tx *Transaction, workspaceDir string) {
+				backUpAndWriteFile(t, tx, filepath.Join(workspaceDir, "plugins", "foo.dll"), "new")
+				backUpAndWriteFile(t, tx, filepath.Join(workspaceDir, "plugins", "foo.dll"), "newer")
+			},
+		},
+		{
+			name:  "file in created directory",
+			files: map[string]string{},
+			change: func(t *testing.T, tx *Transaction, workspaceDir string) {
+				dir := filepath.Join(workspaceDir, "plugins")
+				if err := tx.Backup(path.MustParse(dir)); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := os.Mkdir(dir, 0755); err != nil {
+					t.Fatal(err)
+				}
+
+				backUpAndWriteFile(t, tx, filepath.Join(dir, "foo.dll"), "new")
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			workspaceDir := setUpWorkspace(t, testCase.files)
+			before := readTree(t, workspaceDir)
+
+			tx, err := NewTransaction(context.New(context.Config{}, semver.Version{}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			testCase.change(t, tx, workspaceDir)
+
+			if err := tx.Rollback(); err != nil {
+				t.Fatalf("Rollback() error = %v", err)
+			}
+
+			if after := readTree(t, workspaceDir); !reflect.DeepEqual(after, before) {
+				t.Errorf("workspace after rollback = %v, want %v", after, before)
+			}
+		})
+	}
+}
+
+func TestTransactionCommit(t *testing.T) {
+	workspaceDir := setUpWorkspace(t, map[string]string{"plugins/foo.dll": "old"})
+
+	tx, err := NewTransaction(context.New(context.Config{}, semver.Version{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backUpAndWriteFile(t, tx, filepath.Join(workspaceDir, "plugins", "foo.dll"), "new")
+	backUpAndWriteFile(t, tx, filepath.Join(workspaceDir, "plugins", "bar.dll"), "new")
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+
+	want := map[string]string{
+		".lip/":           "",
+		"plugins/":        "",
+		"plugins/bar.dll": "new",
+		"plugins/foo.dll": "new",
+	}
+	if after := readTree(t, workspaceDir); !reflect.DeepEqual(after, want) {
+		t.Errorf("workspace after commit = %v, want %v", after, want)
+	}
+}
+
+// setUpWorkspace creates a workspace with the files and a .lip directory, and changes
+// the working directory to it until the test ends.
+func setUpWorkspace(t *testing.T, files map[string]string) string {
+	workspaceDir := t.TempDir()
+
+	if err := os.Mkdir(filepath.Join(workspaceDir, ".lip"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for filePath, content := range files {
+		localFilePath := filepath.Join(workspaceDir, filepath.FromSlash(filePath))
+		if err := os.MkdirAll(filepath.Dir(localFilePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(localFilePath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	workingDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chdir(workspaceDir); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		os.Chdir(workingDir)
+	})
+
+	return workspaceDir
+}
+
+func backUpAndWriteFile(t *testing.T, tx *Transaction, filePath string, content string) {
+	if err := tx.Backup(path.MustParse(filePath)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readTree returns the files in the directory mapped to their contents, and the
+// directories with a trailing slash mapped to empty strings.
+func readTree(t *testing.T, dir string) map[string]string {
+	tree := make(map[string]string)
+
+	err := filepath.Walk(dir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil || filePath == dir {
+			return err
+		}
+
+		relPath, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		if info.IsDir() {
+			tree[relPath+"/"] = ""
+			return nil
+		}
+
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+
+		tree[relPath] = string(content)
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tree
+}
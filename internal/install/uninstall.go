@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"sort"
+	"strings"
 
 	"github.com/lippkg/lip/internal/context"
 	"github.com/lippkg/lip/internal/path"
@@ -12,53 +14,69 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-func Uninstall(ctx *context.Context, toothRepoPath string) error {
-	debugLogger := log.WithFields(log.Fields{
-		"package": "install",
-		"method":  "Uninstall",
-	})
-
-	commandEnvirons := make(map[string]string)
+// Uninstall uninstalls an installed tooth. Every change to the workspace is recorded in
+// tx so that it can be rolled back if the uninstallation fails. If ignoreScripts is true,
+// no commands are run.
+func Uninstall(ctx *context.Context, tx *Transaction, toothRepoPath string, ignoreScripts bool) error {
+	metadata, err := tooth.GetMetadata(ctx, toothRepoPath)
+	if err != nil {
+		return err
+	}
 
-	proxyURL, err := ctx.ProxyURL()
+	commands, err := metadata.Commands()
 	if err != nil {
-		return fmt.Errorf("failed to get proxy URL\n\t%w", err)
+		return fmt.Errorf("failed to get commands\n\t%w", err)
 	}
 
-	if proxyURL.String() != "" {
-		commandEnvirons = map[string]string{
-			"HTTP_PROXY":  proxyURL.String(),
-			"HTTPS_PROXY": proxyURL.String(),
-		}
+	if ignoreScripts {
+		commands = tooth.Commands{}
 	}
 
-	metadata, err := tooth.GetMetadata(ctx, toothRepoPath)
+	return uninstall(ctx, tx, metadata, commands)
+}
+
+// uninstall uninstalls an installed tooth with the given metadata, running the uninstall
+// commands in commands.
+func uninstall(ctx *context.Context, tx *Transaction, metadata tooth.Metadata, commands tooth.Commands) error {
+	debugLogger := log.WithFields(log.Fields{
+		"package": "install",
+		"method":  "uninstall",
+	})
+
+	toothRepoPath := metadata.ToothRepoPath()
+
+	hookEnv, err := newHookEnvironment(ctx, tx, metadata, "")
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to make environment for commands\n\t%w", err)
 	}
 
 	// 1. Run pre-uninstall commands.
 
-	if err := runCommands(metadata.Commands().PreUninstall, commandEnvirons); err != nil {
+	if err := runCommands(ctx, hookEnv, hookPreUninstall, commands.PreUninstall); err != nil {
 		return fmt.Errorf("failed to run pre-uninstall commands\n\t%w", err)
 	}
 	debugLogger.Debug("Ran pre-uninstall commands")
 
 	// 2. Delete files.
 
-	if err := removeToothFiles(ctx, metadata); err != nil {
+	if err := removeToothFiles(ctx, tx, metadata); err != nil {
 		return fmt.Errorf("failed to delete files\n\t%w", err)
 	}
 	debugLogger.Debug("Deleted files")
 
+	if err := unregisterOwnedFiles(ctx, tx, toothRepoPath); err != nil {
+		return fmt.Errorf("failed to unregister owned files\n\t%w", err)
+	}
+	debugLogger.Debug("Unregistered owned files")
+
 	// 3. Run post-uninstall commands.
 
-	if err := runCommands(metadata.Commands().PostUninstall, commandEnvirons); err != nil {
+	if err := runCommands(ctx, hookEnv, hookPostUninstall, commands.PostUninstall); err != nil {
 		return fmt.Errorf("failed to run post-uninstall commands\n\t%w", err)
 	}
 	debugLogger.Debug("Ran post-uninstall commands")
 
-	// 4. Delete the metadata file.
+	// 4. Delete the metadata and manifest files.
 
 	metadataDir, err := ctx.MetadataDir()
 	if err != nil {
@@ -68,17 +86,75 @@ func Uninstall(ctx *context.Context, toothRepoPath string) error {
 	metadataFileName := fmt.Sprintf("%v.json", url.QueryEscape(toothRepoPath))
 	metadataPath := metadataDir.Join(path.MustParse(metadataFileName))
 
-	if err := os.Remove(metadataPath.LocalString()); err != nil {
+	if err := tx.Backup(metadataPath); err != nil {
 		return fmt.Errorf("failed to delete metadata file\n\t%w", err)
 	}
 
 	debugLogger.Debugf("Deleted metadata file %v", metadataPath.LocalString())
 
+	manifestFilePath, err := tooth.GetManifestFilePath(ctx, toothRepoPath)
+	if err != nil {
+		return fmt.Errorf("failed to get manifest file path\n\t%w", err)
+	}
+
+	if err := tx.Backup(manifestFilePath); err != nil {
+		return fmt.Errorf("failed to delete manifest file\n\t%w", err)
+	}
+
+	debugLogger.Debugf("Deleted manifest file %v", manifestFilePath.LocalString())
+
 	return nil
 }
 
-// removeToothFiles removes the files of the tooth.
-func removeToothFiles(ctx *context.Context, metadata tooth.Metadata) error {
+// SortForUninstall sorts the teeth to uninstall in reverse topological order, i.e.
+// dependents before their dependencies, so that no tooth is uninstalled while an
+// installed tooth still depends on it.
+func SortForUninstall(ctx *context.Context, toothRepoPaths []string) ([]string, error) {
+	reverseDependencies, err := tooth.GetReverseDependencies(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reverse dependencies\n\t%w", err)
+	}
+
+	toUninstall := make(map[string]bool)
+	for _, toothRepoPath := range toothRepoPaths {
+		toUninstall[toothRepoPath] = true
+	}
+
+	sortedToothRepoPaths := make([]string, 0, len(toUninstall))
+	for toothRepoPath := range toUninstall {
+		sortedToothRepoPaths = append(sortedToothRepoPaths, toothRepoPath)
+	}
+	sort.Strings(sortedToothRepoPaths)
+
+	// Visit dependents before the tooth itself.
+	visited := make(map[string]bool)
+	orderedToothRepoPaths := make([]string, 0, len(toUninstall))
+
+	var visit func(toothRepoPath string)
+	visit = func(toothRepoPath string) {
+		if visited[toothRepoPath] {
+			return
+		}
+		visited[toothRepoPath] = true
+
+		for _, dependent := range reverseDependencies[toothRepoPath] {
+			if toUninstall[dependent] {
+				visit(dependent)
+			}
+		}
+
+		orderedToothRepoPaths = append(orderedToothRepoPaths, toothRepoPath)
+	}
+
+	for _, toothRepoPath := range sortedToothRepoPaths {
+		visit(toothRepoPath)
+	}
+
+	return orderedToothRepoPaths, nil
+}
+
+// removeToothFiles removes the files of the tooth. Removed files are backed up in tx.
+func removeToothFiles(ctx *context.Context, tx *Transaction, metadata tooth.Metadata) error {
 	debugLogger := log.WithFields(log.Fields{
 		"package": "install",
 		"method":  "removeToothFiles",
@@ -99,7 +175,23 @@ func removeToothFiles(ctx *context.Context, metadata tooth.Metadata) error {
 		return fmt.Errorf("failed to get files from metadata\n\t%w", err)
 	}
 
+	fileOwners, err := tooth.GetFileOwners(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get file owners\n\t%w", err)
+	}
+
 	for _, place := range files.Place {
+		// Files owned by other teeth, e.g. overwritten by them, will not be deleted.
+		otherOwners, err := GetOtherOwners(fileOwners, metadata.ToothRepoPath(), place.Dest)
+		if err != nil {
+			return fmt.Errorf("failed to get owners of %v\n\t%w", place.Dest, err)
+		}
+
+		if len(otherOwners) != 0 {
+			debugLogger.Debugf("Skipped file %v owned by %v", place.Dest, strings.Join(otherOwners, ", "))
+			continue
+		}
+
 		// Files marked as "preserve" will not be deleted.
 		isPreserved := false
 		for _, preserve := range files.Preserve {
@@ -118,7 +210,7 @@ func removeToothFiles(ctx *context.Context, metadata tooth.Metadata) error {
 		dest := workspaceDir.Join(relDest)
 
 		// Delete the file.
-		if err := os.RemoveAll(dest.LocalString()); err != nil {
+		if err := tx.Backup(dest); err != nil {
 			return fmt.Errorf("failed to delete file\n\t%w", err)
 		}
 		debugLogger.Debugf("Deleted file %v", dest.LocalString())
@@ -154,7 +246,7 @@ func removeToothFiles(ctx *context.Context, metadata tooth.Metadata) error {
 				break
 			}
 
-			if err := os.Remove(dir.LocalString()); err != nil {
+			if err := tx.Backup(dir); err != nil {
 				return fmt.Errorf("failed to delete directory\n\t%w", err)
 			}
 			debugLogger.Debugf("Deleted directory %v", dir.LocalString())
@@ -172,7 +264,19 @@ func removeToothFiles(ctx *context.Context, metadata tooth.Metadata) error {
 	for _, removal := range files.Remove {
 		removalPath := removal
 
-		if err := os.RemoveAll(workspaceDir.Join(removalPath).LocalString()); err != nil {
+		// Paths containing files owned by other teeth will not be deleted.
+		otherOwners, err := GetOtherOwners(fileOwners, metadata.ToothRepoPath(), removalPath)
+		if err != nil {
+			return fmt.Errorf("failed to get owners of %v\n\t%w", removalPath, err)
+		}
+
+		if len(otherOwners) != 0 {
+			log.Warnf("Skipped removing %v because files at or under it are owned by %v", removalPath,
+				strings.Join(otherOwners, ", "))
+			continue
+		}
+
+		if err := tx.Backup(workspaceDir.Join(removalPath)); err != nil {
 			return fmt.Errorf("failed to delete file\n\t%w", err)
 		}
 		debugLogger.Debugf("Deleted file %v that is marked as \"remove\"", workspaceDir.Join(removalPath).LocalString())
@@ -0,0 +1,166 @@
+package lock
+
+import (
+	gocontext "context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lippkg/lip/internal/path"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Lock is an advisory lock on a file, which is shared with other lip processes. The
+// lock file holds the PID of the process holding the lock.
+type Lock struct {
+	file     *os.File
+	filePath path.Path
+}
+
+// LockedError is returned by Acquire when the lock is held by another process.
+type LockedError struct {
+	LockFilePath path.Path
+	// Holder is the PID of the process holding the lock, or "unknown".
+	Holder string
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%v is locked by PID %v", e.LockFilePath.LocalString(), e.Holder)
+}
+
+// retryInterval is the interval between attempts to acquire a lock held by another
+// process.
+const retryInterval = 100 * time.Millisecond
+
+// Acquire acquires the lock on the file at the given path, creating the file if it does
+// not exist. If the lock is held by another process and wait is false, a *LockedError is
+// returned. Otherwise it waits until the lock is released or goContext is done.
+func Acquire(goContext gocontext.Context, lockFilePath path.Path, wait bool) (*Lock, error) {
+	isWaiting := false
+
+	for {
+		file, isLocked, err := tryAcquire(lockFilePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock %v\n\t%w", lockFilePath.LocalString(), err)
+		}
+
+		if isLocked {
+			return &Lock{file: file, filePath: lockFilePath}, nil
+		}
+
+		if !wait {
+			return nil, &LockedError{LockFilePath: lockFilePath, Holder: readHolder(lockFilePath)}
+		}
+
+		if !isWaiting {
+			log.Infof("Waiting for the lock on %v held by PID %v...", lockFilePath.LocalString(),
+				readHolder(lockFilePath))
+			isWaiting = true
+		}
+
+		select {
+		case <-goContext.Done():
+			return nil, fmt.Errorf("stopped waiting for the lock on %v\n\t%w", lockFilePath.LocalString(),
+				goContext.Err())
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// tryAcquire tries to lock the file at the given path once. The returned file is only
+// valid if it is locked.
+func tryAcquire(lockFilePath path.Path) (*os.File, bool, error) {
+	file, err := os.OpenFile(lockFilePath.LocalString(), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to open lock file\n\t%w", err)
+	}
+
+	isLocked, err := tryLockFile(file)
+	if err != nil {
+		file.Close()
+		return nil, false, err
+	}
+
+	if !isLocked {
+		file.Close()
+		return nil, false, nil
+	}
+
+	// The lock file may have been removed by ReleaseAndRemove after it was opened, in
+	// which case the lock is on a file no other process will ever lock again.
+	if isCurrent, err := isCurrentFile(file, lockFilePath); err != nil || !isCurrent {
+		unlockFile(file)
+		file.Close()
+		return nil, false, err
+	}
+
+	// Record the PID of this process so that others know who holds the lock.
+	if err := file.Truncate(0); err != nil {
+		unlockFile(file)
+		file.Close()
+		return nil, false, fmt.Errorf("failed to truncate lock file\n\t%w", err)
+	}
+
+	if _, err := file.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0); err != nil {
+		unlockFile(file)
+		file.Close()
+		return nil, false, fmt.Errorf("failed to write lock file\n\t%w", err)
+	}
+
+	return file, true, nil
+}
+
+// isCurrentFile checks whether the file is still the one at the given path.
+func isCurrentFile(file *os.File, filePath path.Path) (bool, error) {
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return false, fmt.Errorf("failed to get info of lock file\n\t%w", err)
+	}
+
+	currentFileInfo, err := os.Stat(filePath.LocalString())
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to get info of lock file\n\t%w", err)
+	}
+
+	return os.SameFile(fileInfo, currentFileInfo), nil
+}
+
+// readHolder returns the PID recorded in the lock file, or "unknown" if it cannot be
+// read.
+func readHolder(lockFilePath path.Path) string {
+	content, _ := os.ReadFile(lockFilePath.LocalString())
+
+	holder := strings.TrimSpace(string(content))
+	if holder == "" {
+		return "unknown"
+	}
+
+	return holder
+}
+
+// Release releases the lock. The lock file is kept so that other processes waiting on
+// it are not affected.
+func (l *Lock) Release() error {
+	if err := unlockFile(l.file); err != nil {
+		l.file.Close()
+		return fmt.Errorf("failed to unlock %v\n\t%w", l.file.Name(), err)
+	}
+
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("failed to close %v\n\t%w", l.file.Name(), err)
+	}
+
+	return nil
+}
+
+// ReleaseAndRemove releases the lock and removes the lock file, so that lock files of
+// short-lived locks do not pile up. Processes waiting on the removed lock file retry
+// with a new one.
+func (l *Lock) ReleaseAndRemove() error {
+	return releaseAndRemove(l.file, l.filePath)
+}
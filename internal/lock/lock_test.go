@@ -0,0 +1,92 @@
+package lock
+
+import (
+	gocontext "context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lippkg/lip/internal/path"
+)
+
+func TestAcquire(t *testing.T) {
+	testCases := []struct {
+		name    string
+		wait    bool
+		timeout time.Duration
+		wantErr error
+	}{
+		{
+			name:    "not waiting",
+			wait:    false,
+			wantErr: &LockedError{},
+		},
+		{
+			name:    "waiting until cancelled",
+			wait:    true,
+			timeout: 3 * retryInterval,
+			wantErr: gocontext.DeadlineExceeded,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			lockFilePath := path.MustParse(filepath.Join(t.TempDir(), "test.lock"))
+
+			heldLock, err := Acquire(gocontext.Background(), lockFilePath, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer heldLock.Release()
+
+			goContext, cancel := gocontext.WithTimeout(gocontext.Background(), testCase.timeout)
+			defer cancel()
+
+			_, err = Acquire(goContext, lockFilePath, testCase.wait)
+
+			var lockedErr *LockedError
+			if _, ok := testCase.wantErr.(*LockedError); ok {
+				if !errors.As(err, &lockedErr) {
+					t.Errorf("Acquire() error = %v, want *LockedError", err)
+				}
+			} else if !errors.Is(err, testCase.wantErr) {
+				t.Errorf("Acquire() error = %v, want %v", err, testCase.wantErr)
+			}
+		})
+	}
+}
+
+func TestReleaseAndRemove(t *testing.T) {
+	lockFilePath := path.MustParse(filepath.Join(t.TempDir(), "test.lock"))
+
+	heldLock, err := Acquire(gocontext.Background(), lockFilePath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process waiting for the lock gets it after it is released.
+	acquired := make(chan error, 1)
+	go func() {
+		waitingLock, err := Acquire(gocontext.Background(), lockFilePath, true)
+		if err == nil {
+			err = waitingLock.ReleaseAndRemove()
+		}
+		acquired <- err
+	}()
+
+	time.Sleep(2 * retryInterval)
+
+	if err := heldLock.ReleaseAndRemove(); err != nil {
+		t.Fatalf("ReleaseAndRemove() error = %v", err)
+	}
+
+	if err := <-acquired; err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	if _, err := os.Stat(lockFilePath.LocalString()); !os.IsNotExist(err) {
+		t.Errorf("lock file still exists, error = %v", err)
+	}
+}
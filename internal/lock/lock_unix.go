@@ -0,0 +1,48 @@
+//go:build !windows
+
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/lippkg/lip/internal/path"
+	"golang.org/x/sys/unix"
+)
+
+func tryLockFile(file *os.File) (bool, error) {
+	err := unix.Flock(int(file.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+	if errors.Is(err, unix.EWOULDBLOCK) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func unlockFile(file *os.File) error {
+	return unix.Flock(int(file.Fd()), unix.LOCK_UN)
+}
+
+// releaseAndRemove removes the lock file before unlocking it, so that no other process
+// can lock the file at the path in the meantime.
+func releaseAndRemove(file *os.File, filePath path.Path) error {
+	removeErr := os.Remove(filePath.LocalString())
+
+	if err := unlockFile(file); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to unlock %v\n\t%w", file.Name(), err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close %v\n\t%w", file.Name(), err)
+	}
+
+	if removeErr != nil && !os.IsNotExist(removeErr) {
+		return fmt.Errorf("failed to remove %v\n\t%w", file.Name(), removeErr)
+	}
+
+	return nil
+}
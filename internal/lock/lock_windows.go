@@ -0,0 +1,58 @@
+//go:build windows
+
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/lippkg/lip/internal/path"
+	"golang.org/x/sys/windows"
+)
+
+// A byte far beyond the end of the lock file is locked instead of the whole file,
+// because locked regions cannot be read by other processes on Windows.
+const (
+	lockOffsetLow  = 0xFFFFFFFF
+	lockOffsetHigh = 0x7FFFFFFF
+)
+
+func tryLockFile(file *os.File) (bool, error) {
+	err := lockFileEx(file, windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func unlockFile(file *os.File) error {
+	overlapped := windows.Overlapped{Offset: lockOffsetLow, OffsetHigh: lockOffsetHigh}
+	return windows.UnlockFileEx(windows.Handle(file.Fd()), 0, 1, 0, &overlapped)
+}
+
+// releaseAndRemove removes the lock file after closing it, as open files cannot be
+// removed on Windows. The removal fails if another process has opened the file in the
+// meantime, in which case the file is kept for it.
+func releaseAndRemove(file *os.File, filePath path.Path) error {
+	if err := unlockFile(file); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to unlock %v\n\t%w", file.Name(), err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close %v\n\t%w", file.Name(), err)
+	}
+
+	os.Remove(filePath.LocalString())
+
+	return nil
+}
+
+func lockFileEx(file *os.File, flags uint32) error {
+	overlapped := windows.Overlapped{Offset: lockOffsetLow, OffsetHigh: lockOffsetHigh}
+	return windows.LockFileEx(windows.Handle(file.Fd()), flags, 0, 1, 0, &overlapped)
+}
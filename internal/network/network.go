@@ -1,6 +1,7 @@
 package network
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -8,14 +9,20 @@ import (
 	"os"
 
 	"github.com/lippkg/lip/internal/path"
-	"github.com/schollz/progressbar/v3"
 )
 
-// DownloadFile downloads a file from a url and saves it to a local path.
-func DownloadFile(url *url.URL, proxyURL *url.URL, filePath path.Path, enableProgressBar bool) error {
+// DownloadFile downloads a file from a url and saves it to a local path. The download
+// stops when ctx is done, leaving a partial file at the path.
+func DownloadFile(ctx context.Context, url *url.URL, proxyURL *url.URL, filePath path.Path,
+	enableProgressBar bool) error {
 	httpClient := getProxiedHTTPClient(proxyURL)
 
-	resp, err := httpClient.Get(url.String())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url.String(), nil)
+	if err != nil {
+		return fmt.Errorf("cannot create HTTP request\n\t%w", err)
+	}
+
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("cannot send HTTP request\n\t%w", err)
 	}
@@ -34,14 +41,12 @@ func DownloadFile(url *url.URL, proxyURL *url.URL, filePath path.Path, enablePro
 
 	var writer io.Writer = file
 
+	// Concurrent downloads share one progress bar.
 	if enableProgressBar {
-		bar := progressbar.NewOptions64(
-			resp.ContentLength,
-			progressbar.OptionClearOnFinish(),
-			progressbar.OptionShowBytes(true),
-			progressbar.OptionShowCount(),
-		)
-		writer = io.MultiWriter(file, bar)
+		sharedDownloadProgress.start(resp.ContentLength)
+		defer sharedDownloadProgress.finish()
+
+		writer = io.MultiWriter(file, progressWriter{isSizeKnown: resp.ContentLength >= 0})
 	}
 
 	if _, err := io.Copy(writer, resp.Body); err != nil {
@@ -50,11 +55,16 @@ func DownloadFile(url *url.URL, proxyURL *url.URL, filePath path.Path, enablePro
 	return nil
 }
 
-// GetContent gets the content at once of a URL.
-func GetContent(url *url.URL, proxyURL *url.URL) ([]byte, error) {
+// GetContent gets the content at once of a URL. It stops when ctx is done.
+func GetContent(ctx context.Context, url *url.URL, proxyURL *url.URL) ([]byte, error) {
 	httpClient := getProxiedHTTPClient(proxyURL)
 
-	resp, err := httpClient.Get(url.String())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create HTTP request\n\t%w", err)
+	}
+
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("cannot send HTTP request\n\t%w", err)
 	}
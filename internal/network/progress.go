@@ -0,0 +1,111 @@
+package network
+
+import (
+	"sync"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// downloadProgress shows the total progress of the downloads running at the same time in
+// one progress bar, as a progress bar for each download would mess up the output.
+type downloadProgress struct {
+	mutex        sync.Mutex
+	bar          *progressbar.ProgressBar
+	runningCount int
+	totalBytes   int64
+	doneBytes    int64
+}
+
+var sharedDownloadProgress downloadProgress
+
+// ClearProgressBar erases the progress bar of running downloads from the current line,
+// so that a log line can be printed without being mixed with it. The progress bar is
+// drawn again when the downloads make progress.
+func ClearProgressBar() {
+	sharedDownloadProgress.mutex.Lock()
+	defer sharedDownloadProgress.mutex.Unlock()
+
+	if sharedDownloadProgress.bar != nil {
+		sharedDownloadProgress.bar.Clear()
+	}
+}
+
+// start adds a download of contentLength bytes to the progress bar. contentLength is
+// negative if the size is unknown.
+func (p *downloadProgress) start(contentLength int64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.runningCount++
+
+	if contentLength > 0 {
+		p.totalBytes += contentLength
+
+		if p.bar != nil && !p.bar.IsFinished() {
+			p.bar.ChangeMax64(p.totalBytes)
+		}
+	}
+}
+
+// add records n bytes downloaded. Downloads of unknown size increase the total as they
+// make progress.
+func (p *downloadProgress) add(n int64, isSizeKnown bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if n <= 0 {
+		return
+	}
+
+	if !isSizeKnown {
+		p.totalBytes += n
+	}
+
+	// A finished progress bar cannot go on, so a new one is made for the remaining bytes.
+	if p.bar == nil || p.bar.IsFinished() {
+		p.totalBytes -= p.doneBytes
+		p.doneBytes = 0
+
+		p.bar = progressbar.NewOptions64(
+			p.totalBytes,
+			progressbar.OptionClearOnFinish(),
+			progressbar.OptionShowBytes(true),
+			progressbar.OptionShowCount(),
+		)
+	} else if !isSizeKnown {
+		p.bar.ChangeMax64(p.totalBytes)
+	}
+
+	p.doneBytes += n
+	p.bar.Add64(n)
+}
+
+// finish removes a download from the progress bar. The progress bar is cleared when no
+// download is running.
+func (p *downloadProgress) finish() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.runningCount--
+
+	if p.runningCount == 0 {
+		if p.bar != nil {
+			p.bar.Finish()
+		}
+
+		p.bar = nil
+		p.totalBytes = 0
+		p.doneBytes = 0
+	}
+}
+
+// progressWriter records the bytes written to it in sharedDownloadProgress.
+type progressWriter struct {
+	isSizeKnown bool
+}
+
+func (w progressWriter) Write(b []byte) (int, error) {
+	sharedDownloadProgress.add(int64(len(b)), w.isSizeKnown)
+
+	return len(b), nil
+}
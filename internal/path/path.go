@@ -170,8 +170,14 @@ func (f Path) IsEmpty() bool {
 
 // Join joins two paths.
 func (f Path) Join(other Path) Path {
+	// Always allocate a new slice so that the result never shares its underlying
+	// array with f, e.g. when f is the result of Dir().
+	pathItems := make([]string, 0, len(f.pathItems)+len(other.pathItems))
+	pathItems = append(pathItems, f.pathItems...)
+	pathItems = append(pathItems, other.pathItems...)
+
 	return Path{
-		pathItems: append(f.pathItems, other.pathItems...),
+		pathItems: pathItems,
 	}
 }
 
@@ -199,6 +205,11 @@ func (f Path) TrimSuffix(suffix Path) Path {
 
 // String returns the string representation of a Path.
 func (f Path) String() string {
+	// gopath.Join ignores the leading empty path item of an absolute Unix path.
+	if len(f.pathItems) > 0 && f.pathItems[0] == "" {
+		return "/" + gopath.Join(f.pathItems[1:]...)
+	}
+
 	return gopath.Join(f.pathItems...)
 }
 
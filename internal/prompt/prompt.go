@@ -0,0 +1,30 @@
+package prompt
+
+import (
+	"fmt"
+
+	"github.com/lippkg/lip/internal/context"
+	log "github.com/sirupsen/logrus"
+)
+
+// Confirm asks the user a yes/no question and tells whether the answer is yes. It fails
+// if lip is interrupted while waiting for the answer.
+func Confirm(ctx *context.Context, question string) (bool, error) {
+	log.Infof("%v [y/N]", question)
+
+	// Reading the standard input cannot be cancelled, so read it in another goroutine.
+	ansChan := make(chan string, 1)
+	go func() {
+		var ans string
+		fmt.Scanln(&ans)
+		ansChan <- ans
+	}()
+
+	select {
+	case ans := <-ansChan:
+		return ans == "y" || ans == "Y", nil
+
+	case <-ctx.GoContext().Done():
+		return false, fmt.Errorf("interrupted while waiting for an answer\n\t%w", ctx.GoContext().Err())
+	}
+}
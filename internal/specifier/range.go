@@ -0,0 +1,96 @@
+package specifier
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/blang/semver/v4"
+)
+
+// parseVersionRange parses a version range. Besides the syntax of semver.ParseRange,
+// caret ranges (e.g. "^1.2") and tilde ranges (e.g. "~1.2.3") are supported and
+// expanded to comparators before parsing.
+func parseVersionRange(versionRangeString string) (semver.Range, error) {
+	tokens := strings.Fields(versionRangeString)
+
+	expandedTokens := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		if !strings.HasPrefix(token, "^") && !strings.HasPrefix(token, "~") {
+			expandedTokens = append(expandedTokens, token)
+			continue
+		}
+
+		expandedToken, err := expandCaretOrTildeRange(token)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version range %v\n\t%w", versionRangeString, err)
+		}
+
+		expandedTokens = append(expandedTokens, expandedToken)
+	}
+
+	versionRange, err := semver.ParseRange(strings.Join(expandedTokens, " "))
+	if err != nil {
+		return nil, fmt.Errorf("invalid version range %v\n\t%w", versionRangeString, err)
+	}
+
+	return versionRange, nil
+}
+
+// expandCaretOrTildeRange expands a caret or tilde range to a pair of comparators.
+// A caret range allows changes that do not modify the left-most non-zero part of the
+// version, while a tilde range allows patch-level changes if a minor version is given,
+// or minor-level changes if not.
+func expandCaretOrTildeRange(token string) (string, error) {
+	operator := token[:1]
+	versionString := token[1:]
+
+	// Parse the version, which may be partial, e.g. "1" or "1.2".
+	var lowerVersion semver.Version
+	precision := len(strings.SplitN(versionString, ".", 3))
+	if precision == 3 {
+		version, err := semver.Parse(versionString)
+		if err != nil {
+			return "", fmt.Errorf("invalid version %v in %v\n\t%w", versionString, token, err)
+		}
+
+		lowerVersion = version
+
+	} else {
+		parts := strings.Split(versionString, ".")
+		numbers := make([]uint64, len(parts))
+		for i, part := range parts {
+			number, err := strconv.ParseUint(part, 10, 64)
+			if err != nil {
+				return "", fmt.Errorf("invalid version %v in %v\n\t%w", versionString, token, err)
+			}
+
+			numbers[i] = number
+		}
+
+		lowerVersion.Major = numbers[0]
+		if precision == 2 {
+			lowerVersion.Minor = numbers[1]
+		}
+	}
+
+	var upperVersion semver.Version
+	switch {
+	case operator == "~" && precision == 1:
+		upperVersion = semver.Version{Major: lowerVersion.Major + 1}
+
+	case operator == "~":
+		upperVersion = semver.Version{Major: lowerVersion.Major, Minor: lowerVersion.Minor + 1}
+
+	case lowerVersion.Major != 0 || precision == 1:
+		upperVersion = semver.Version{Major: lowerVersion.Major + 1}
+
+	case lowerVersion.Minor != 0 || precision == 2:
+		upperVersion = semver.Version{Minor: lowerVersion.Minor + 1}
+
+	default:
+		upperVersion = semver.Version{Patch: lowerVersion.Patch + 1}
+	}
+
+	return fmt.Sprintf(">=%v <%v", lowerVersion, upperVersion), nil
+}
@@ -0,0 +1,115 @@
+package specifier
+
+import (
+	"testing"
+
+	"github.com/blang/semver/v4"
+)
+
+func TestParseVersionRange(t *testing.T) {
+	testCases := []struct {
+		versionRange string
+		included     []string
+		excluded     []string
+	}{
+		{
+			versionRange: "^1.2.3",
+			included:     []string{"1.2.3", "1.2.10", "1.9.0"},
+			excluded:     []string{"1.2.2", "2.0.0"},
+		},
+		{
+			versionRange: "^1.2",
+			included:     []string{"1.2.0", "1.9.9"},
+			excluded:     []string{"1.1.9", "2.0.0"},
+		},
+		{
+			versionRange: "^1",
+			included:     []string{"1.0.0", "1.9.9"},
+			excluded:     []string{"0.9.9", "2.0.0"},
+		},
+		{
+			versionRange: "^0.2.3",
+			included:     []string{"0.2.3", "0.2.9"},
+			excluded:     []string{"0.2.2", "0.3.0"},
+		},
+		{
+			versionRange: "^0.0.3",
+			included:     []string{"0.0.3"},
+			excluded:     []string{"0.0.2", "0.0.4"},
+		},
+		{
+			versionRange: "^0.0",
+			included:     []string{"0.0.0", "0.0.9"},
+			excluded:     []string{"0.1.0"},
+		},
+		{
+			versionRange: "^0",
+			included:     []string{"0.0.0", "0.9.9"},
+			excluded:     []string{"1.0.0"},
+		},
+		{
+			versionRange: "~1.2.3",
+			included:     []string{"1.2.3", "1.2.9"},
+			excluded:     []string{"1.2.2", "1.3.0"},
+		},
+		{
+			versionRange: "~1.2",
+			included:     []string{"1.2.0", "1.2.9"},
+			excluded:     []string{"1.1.9", "1.3.0"},
+		},
+		{
+			versionRange: "~1",
+			included:     []string{"1.0.0", "1.9.9"},
+			excluded:     []string{"0.9.9", "2.0.0"},
+		},
+		{
+			versionRange: "^1.2.3 <1.5.0",
+			included:     []string{"1.2.3", "1.4.9"},
+			excluded:     []string{"1.5.0", "1.2.2"},
+		},
+		{
+			versionRange: ">=1.0.0 <2.0.0 || >=3.0.0",
+			included:     []string{"1.0.0", "3.1.0"},
+			excluded:     []string{"2.0.0", "0.9.0"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.versionRange, func(t *testing.T) {
+			versionRange, err := parseVersionRange(testCase.versionRange)
+			if err != nil {
+				t.Fatalf("parseVersionRange() error = %v", err)
+			}
+
+			for _, version := range testCase.included {
+				if !versionRange(semver.MustParse(version)) {
+					t.Errorf("%v does not include %v", testCase.versionRange, version)
+				}
+			}
+
+			for _, version := range testCase.excluded {
+				if versionRange(semver.MustParse(version)) {
+					t.Errorf("%v includes %v", testCase.versionRange, version)
+				}
+			}
+		})
+	}
+}
+
+func TestParseVersionRangeInvalid(t *testing.T) {
+	testCases := []string{
+		"^",
+		"^1.x",
+		"~a.b",
+		"^1.2.3.4",
+		"~1.2.3-",
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase, func(t *testing.T) {
+			if _, err := parseVersionRange(testCase); err == nil {
+				t.Errorf("parseVersionRange(%q) error = nil, want an error", testCase)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package specifier
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 
 	"github.com/blang/semver/v4"
@@ -9,6 +10,9 @@ import (
 	"github.com/lippkg/lip/internal/tooth"
 )
 
+// featureNameRegexp matches valid feature names, the same as in tooth.json.
+var featureNameRegexp = regexp.MustCompile("^[a-z0-9-]+$")
+
 // KindType is an enum that represents the type of a specifier.
 type KindType int
 
@@ -23,12 +27,60 @@ type Specifier struct {
 	toothArchivePath path.Path
 	toothRepoPath    string
 
-	isToothVersionSpecified bool
-	toothVersion            semver.Version
+	versionKind       VersionKindType
+	toothVersion      semver.Version
+	toothVersionRange semver.Range
+	versionString     string
+
+	features []string
 }
 
-// Parse creates a new specifier from the given string.
+// VersionKindType is an enum that represents how the version of a tooth repo specifier
+// is given.
+type VersionKindType int
+
+const (
+	// UnspecifiedVersionKind means that no version is given, e.g. "example.com/foo".
+	UnspecifiedVersionKind VersionKindType = iota
+	// ExactVersionKind means that an exact version is given, e.g. "example.com/foo@1.2.3".
+	ExactVersionKind
+	// VersionRangeKind means that a version range is given, e.g. "example.com/foo@^1.2".
+	VersionRangeKind
+	// DistTagKind means that a dist-tag is given, e.g. "example.com/foo@latest".
+	DistTagKind
+)
+
+const (
+	// DistTagLatest selects the latest stable version, or the latest prerelease if
+	// there is no stable version. It is the same as not giving a version.
+	DistTagLatest = "latest"
+	// DistTagLatestPre selects the latest version including prereleases.
+	DistTagLatestPre = "latest-pre"
+	// DistTagInstalled selects the version installed in the workspace.
+	DistTagInstalled = "installed"
+)
+
+// Parse creates a new specifier from the given string. Features to enable can be given
+// in brackets after the tooth repo path or the tooth archive path, e.g.
+// "example.com/foo[mysql,redis]@1.2.3".
 func Parse(specifierString string) (Specifier, error) {
+	specifierStringWithoutFeatures, features, err := splitFeatures(specifierString)
+	if err != nil {
+		return Specifier{}, fmt.Errorf("invalid requirement specifier %v\n\t%w", specifierString, err)
+	}
+
+	specifier, err := parseWithoutFeatures(specifierStringWithoutFeatures)
+	if err != nil {
+		return Specifier{}, err
+	}
+
+	specifier.features = features
+
+	return specifier, nil
+}
+
+// parseWithoutFeatures creates a new specifier from the given string without features.
+func parseWithoutFeatures(specifierString string) (Specifier, error) {
 
 	specifierType := getSpecifierType(specifierString)
 
@@ -57,24 +109,49 @@ func Parse(specifierString string) (Specifier, error) {
 		}
 
 		if len(splittedSpecifier) == 2 {
-			toothVersion, err := semver.Parse(splittedSpecifier[1])
+			versionString := splittedSpecifier[1]
+
+			// Exact versions take precedence over version ranges, since an exact version
+			// is also a valid version range.
+			if toothVersion, err := semver.Parse(versionString); err == nil {
+				return Specifier{
+					kind:          specifierType,
+					toothRepoPath: toothRepoPath,
+					versionKind:   ExactVersionKind,
+					toothVersion:  toothVersion,
+					versionString: versionString,
+				}, nil
+			}
+
+			switch versionString {
+			case DistTagLatest, DistTagLatestPre, DistTagInstalled:
+				return Specifier{
+					kind:          specifierType,
+					toothRepoPath: toothRepoPath,
+					versionKind:   DistTagKind,
+					versionString: versionString,
+				}, nil
+			}
+
+			toothVersionRange, err := parseVersionRange(versionString)
 			if err != nil {
 				return Specifier{}, fmt.Errorf("invalid requirement specifier %v\n\t%w",
 					specifierString, err)
 			}
 
 			return Specifier{
-				kind:                    specifierType,
-				toothRepoPath:           toothRepoPath,
-				isToothVersionSpecified: true,
-				toothVersion:            toothVersion,
+				kind:              specifierType,
+				toothRepoPath:     toothRepoPath,
+				versionKind:       VersionRangeKind,
+				toothVersionRange: toothVersionRange,
+				versionString:     versionString,
 			}, nil
 
 		} else if len(splittedSpecifier) == 1 {
 			return Specifier{
-				kind:                    specifierType,
-				toothRepoPath:           toothRepoPath,
-				isToothVersionSpecified: false,
+				kind:          specifierType,
+				toothRepoPath: toothRepoPath,
+				versionKind:   UnspecifiedVersionKind,
 			}, nil
 		} else {
 			return Specifier{}, fmt.Errorf("invalid requirement specifier: %v: too many \"@\"s",
@@ -109,39 +186,85 @@ func (s Specifier) ToothRepoPath() (string, error) {
 	return s.toothRepoPath, nil
 }
 
-// IsToothVersionSpecified returns whether the specifier has a tooth version.
+// VersionKind returns how the version of the tooth is given.
+func (s Specifier) VersionKind() (VersionKindType, error) {
+	if s.Kind() != ToothRepoKind {
+		return UnspecifiedVersionKind, fmt.Errorf("specifier is not a tooth repo")
+	}
+
+	return s.versionKind, nil
+}
+
+// IsToothVersionSpecified returns whether the specifier has an exact tooth version.
 func (s Specifier) IsToothVersionSpecified() (bool, error) {
 	if s.Kind() != ToothRepoKind {
 		return false, fmt.Errorf("specifier is not a tooth repo")
 	}
 
-	return s.isToothVersionSpecified, nil
+	return s.versionKind == ExactVersionKind, nil
 }
 
-// ToothVersion returns the version of the tooth.
+// ToothVersion returns the exact version of the tooth.
 func (s Specifier) ToothVersion() (semver.Version, error) {
 	if s.Kind() != ToothRepoKind {
 		return semver.Version{}, fmt.Errorf("specifier is not a tooth repo")
 	}
 
-	if !s.isToothVersionSpecified {
+	if s.versionKind != ExactVersionKind {
 		return semver.Version{}, fmt.Errorf("tooth version is not specified")
 	}
 
 	return s.toothVersion, nil
 }
 
+// ToothVersionRange returns the version range of the tooth.
+func (s Specifier) ToothVersionRange() (semver.Range, error) {
+	if s.Kind() != ToothRepoKind {
+		return nil, fmt.Errorf("specifier is not a tooth repo")
+	}
+
+	if s.versionKind != VersionRangeKind {
+		return nil, fmt.Errorf("tooth version range is not specified")
+	}
+
+	return s.toothVersionRange, nil
+}
+
+// DistTag returns the dist-tag of the tooth, which is one of DistTagLatest,
+// DistTagLatestPre and DistTagInstalled.
+func (s Specifier) DistTag() (string, error) {
+	if s.Kind() != ToothRepoKind {
+		return "", fmt.Errorf("specifier is not a tooth repo")
+	}
+
+	if s.versionKind != DistTagKind {
+		return "", fmt.Errorf("dist-tag is not specified")
+	}
+
+	return s.versionString, nil
+}
+
+// Features returns the features to enable, in the order given.
+func (s Specifier) Features() []string {
+	return append([]string{}, s.features...)
+}
+
 // String returns the string representation of the specifier.
 func (s Specifier) String() string {
+	featuresString := ""
+	if len(s.features) != 0 {
+		featuresString = "[" + strings.Join(s.features, ",") + "]"
+	}
+
 	switch s.kind {
 	case ToothArchiveKind:
-		return s.toothArchivePath.LocalString()
+		return s.toothArchivePath.LocalString() + featuresString
 
 	case ToothRepoKind:
-		if s.isToothVersionSpecified {
-			return s.toothRepoPath + "@" + s.toothVersion.String()
+		if s.versionKind == UnspecifiedVersionKind {
+			return s.toothRepoPath + featuresString
 		} else {
-			return s.toothRepoPath
+			return s.toothRepoPath + featuresString + "@" + s.versionString
 		}
 	}
 
@@ -162,3 +285,36 @@ func getSpecifierType(specifier string) KindType {
 
 	return ToothArchiveKind
 }
+
+// splitFeatures removes the features in brackets from the specifier string and returns
+// them. The brackets must be at the end of the string or right before "@". Otherwise the
+// brackets are taken as part of a tooth archive path.
+func splitFeatures(specifierString string) (string, []string, error) {
+	openIndex := strings.Index(specifierString, "[")
+	if openIndex == -1 {
+		return specifierString, nil, nil
+	}
+
+	closeIndex := strings.Index(specifierString[openIndex:], "]")
+	if closeIndex == -1 {
+		return specifierString, nil, nil
+	}
+	closeIndex += openIndex
+
+	rest := specifierString[closeIndex+1:]
+	if rest != "" && !strings.HasPrefix(rest, "@") {
+		return specifierString, nil, nil
+	}
+
+	features := make([]string, 0)
+	for _, feature := range strings.Split(specifierString[openIndex+1:closeIndex], ",") {
+		feature = strings.TrimSpace(feature)
+		if !featureNameRegexp.MatchString(feature) {
+			return "", nil, fmt.Errorf("invalid feature name %q", feature)
+		}
+
+		features = append(features, feature)
+	}
+
+	return specifierString[:openIndex] + rest, features, nil
+}
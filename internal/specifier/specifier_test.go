@@ -0,0 +1,175 @@
+package specifier
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/blang/semver/v4"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		specifier   string
+		kind        KindType
+		versionKind VersionKindType
+		// version is the exact version, the dist-tag, or a version in the version range.
+		version  string
+		features []string
+		// str is the string representation of the specifier if it differs from specifier.
+		str string
+	}{
+		{
+			specifier:   "example.com/foo",
+			kind:        ToothRepoKind,
+			versionKind: UnspecifiedVersionKind,
+		},
+		{
+			specifier:   "example.com/foo@1.2.3",
+			kind:        ToothRepoKind,
+			versionKind: ExactVersionKind,
+			version:     "1.2.3",
+		},
+		{
+			specifier:   "example.com/foo@1.2.3-beta.1",
+			kind:        ToothRepoKind,
+			versionKind: ExactVersionKind,
+			version:     "1.2.3-beta.1",
+		},
+		{
+			specifier:   "example.com/foo@^1.2",
+			kind:        ToothRepoKind,
+			versionKind: VersionRangeKind,
+			version:     "1.5.0",
+		},
+		{
+			specifier:   "example.com/foo@~1.2.3",
+			kind:        ToothRepoKind,
+			versionKind: VersionRangeKind,
+			version:     "1.2.9",
+		},
+		{
+			specifier:   "example.com/foo@>=1.0.0",
+			kind:        ToothRepoKind,
+			versionKind: VersionRangeKind,
+			version:     "3.0.0",
+		},
+		{
+			specifier:   "example.com/foo@latest",
+			kind:        ToothRepoKind,
+			versionKind: DistTagKind,
+			version:     DistTagLatest,
+		},
+		{
+			specifier:   "example.com/foo@latest-pre",
+			kind:        ToothRepoKind,
+			versionKind: DistTagKind,
+			version:     DistTagLatestPre,
+		},
+		{
+			specifier:   "example.com/foo@installed",
+			kind:        ToothRepoKind,
+			versionKind: DistTagKind,
+			version:     DistTagInstalled,
+		},
+		{
+			specifier:   "example.com/foo[mysql, redis]@^1",
+			kind:        ToothRepoKind,
+			versionKind: VersionRangeKind,
+			version:     "1.0.0",
+			features:    []string{"mysql", "redis"},
+			str:         "example.com/foo[mysql,redis]@^1",
+		},
+		{
+			specifier: "dist/foo.tth",
+			kind:      ToothArchiveKind,
+		},
+		{
+			specifier: "dir[1]/foo.tth",
+			kind:      ToothArchiveKind,
+		},
+		{
+			specifier: "dist/foo.tth[mysql]",
+			kind:      ToothArchiveKind,
+			features:  []string{"mysql"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.specifier, func(t *testing.T) {
+			specifier, err := Parse(testCase.specifier)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			if specifier.Kind() != testCase.kind {
+				t.Errorf("Kind() = %v, want %v", specifier.Kind(), testCase.kind)
+			}
+
+			if features := specifier.Features(); len(features) != 0 || len(testCase.features) != 0 {
+				if !reflect.DeepEqual(features, testCase.features) {
+					t.Errorf("Features() = %v, want %v", features, testCase.features)
+				}
+			}
+
+			str := testCase.str
+			if str == "" {
+				str = testCase.specifier
+			}
+			if testCase.kind == ToothArchiveKind {
+				str = filepath.FromSlash(str)
+			}
+			if specifier.String() != str {
+				t.Errorf("String() = %v, want %v", specifier.String(), str)
+			}
+
+			if testCase.kind != ToothRepoKind {
+				return
+			}
+
+			versionKind, err := specifier.VersionKind()
+			if err != nil {
+				t.Fatalf("VersionKind() error = %v", err)
+			} else if versionKind != testCase.versionKind {
+				t.Fatalf("VersionKind() = %v, want %v", versionKind, testCase.versionKind)
+			}
+
+			switch versionKind {
+			case ExactVersionKind:
+				if version, err := specifier.ToothVersion(); err != nil || version.String() != testCase.version {
+					t.Errorf("ToothVersion() = %v, %v, want %v", version, err, testCase.version)
+				}
+
+			case VersionRangeKind:
+				versionRange, err := specifier.ToothVersionRange()
+				if err != nil {
+					t.Fatalf("ToothVersionRange() error = %v", err)
+				} else if !versionRange(semver.MustParse(testCase.version)) {
+					t.Errorf("ToothVersionRange() does not include %v", testCase.version)
+				}
+
+			case DistTagKind:
+				if distTag, err := specifier.DistTag(); err != nil || distTag != testCase.version {
+					t.Errorf("DistTag() = %v, %v, want %v", distTag, err, testCase.version)
+				}
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	testCases := []string{
+		"example.com/foo@^x",
+		"example.com/foo@next",
+		"example.com/foo[MySQL]",
+		"example.com/foo[mysql,]@1.0.0",
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase, func(t *testing.T) {
+			if _, err := Parse(testCase); err == nil {
+				t.Errorf("Parse(%q) error = nil, want an error", testCase)
+			}
+		})
+	}
+}
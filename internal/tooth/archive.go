@@ -79,6 +79,12 @@ func MakeArchive(archiveFilePath path.Path) (Archive, error) {
 		return Archive{}, fmt.Errorf("failed to convert to platform-specific metadata\n\t%w", err)
 	}
 
+	// Features are only enabled when installing.
+	metadata, err = metadata.ToFeaturesEnabled(nil)
+	if err != nil {
+		return Archive{}, fmt.Errorf("failed to disable features\n\t%w", err)
+	}
+
 	return Archive{
 		metadata:      metadata,
 		filePath:      archiveFilePath,
@@ -104,6 +110,20 @@ func (ar Archive) Metadata() Metadata {
 	return ar.metadata
 }
 
+// ToFeaturesEnabled returns the archive with exactly the given features enabled in its
+// metadata.
+func (ar Archive) ToFeaturesEnabled(features []string) (Archive, error) {
+	metadata, err := ar.metadata.ToFeaturesEnabled(features)
+	if err != nil {
+		return Archive{}, err
+	}
+
+	newArchive := ar
+	newArchive.metadata = metadata
+
+	return newArchive, nil
+}
+
 // ToAssetArchiveAttached converts the archive to an archive with asset archive attached.
 // If assetArchivePath is empty, the tooth archive will be used as the asset archive.
 func (ar Archive) ToAssetArchiveAttached(assetArchiveFilePath path.Path) (Archive, error) {
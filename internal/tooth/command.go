@@ -0,0 +1,183 @@
+package tooth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	gopath "path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lippkg/lip/internal/path"
+)
+
+// Command is a command run in a hook. Args is nil if the command is a command line.
+type Command struct {
+	// Script is a command line run by Shell, or by sh on Unix-like systems and cmd on
+	// Windows if Shell is empty.
+	Script string
+	// Args are the program and its arguments. They are run directly, or passed to Shell
+	// if Shell is not empty.
+	Args  []string
+	Shell string
+	// Cwd is the working directory relative to the workspace. It is empty for the
+	// workspace itself.
+	Cwd path.Path
+	// Env is added to the environment of the command.
+	Env map[string]string
+	// Timeout is zero if the command never times out.
+	Timeout time.Duration
+	// ContinueOnError tells whether to run the remaining commands if the command fails.
+	ContinueOnError bool
+}
+
+// String returns the command line of the command for display.
+func (c Command) String() string {
+	commandLine := c.Script
+	if c.Args != nil {
+		quotedArgs := make([]string, 0, len(c.Args))
+		for _, arg := range c.Args {
+			if arg == "" || strings.ContainsAny(arg, " \t\"'") {
+				arg = fmt.Sprintf("%q", arg)
+			}
+
+			quotedArgs = append(quotedArgs, arg)
+		}
+
+		commandLine = strings.Join(quotedArgs, " ")
+	}
+
+	if c.Shell != "" {
+		commandLine = c.Shell + ": " + commandLine
+	}
+
+	return commandLine
+}
+
+// isScriptOnly tells whether the command is a plain command line without options, which
+// can be written as a string in tooth.json.
+func (c RawMetadataCommand) isScriptOnly() bool {
+	return c.Run.Args == nil && c.Cwd == "" && len(c.Env) == 0 && c.Timeout == "" && !c.ContinueOnError &&
+		c.Shell == ""
+}
+
+// UnmarshalJSON accepts either a string, which is a command line run by the default
+// shell, or an object.
+func (c *RawMetadataCommand) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("\"")) {
+		var script string
+		if err := json.Unmarshal(data, &script); err != nil {
+			return err
+		}
+
+		*c = RawMetadataCommand{Run: RawMetadataCommandRun{Script: script}}
+		return nil
+	}
+
+	// rawMetadataCommand has no methods, so that unmarshalling it does not recurse.
+	type rawMetadataCommand RawMetadataCommand
+
+	var command rawMetadataCommand
+	if err := json.Unmarshal(data, &command); err != nil {
+		return err
+	}
+
+	*c = RawMetadataCommand(command)
+	return nil
+}
+
+// MarshalJSON writes the command as a string if it has no options.
+func (c RawMetadataCommand) MarshalJSON() ([]byte, error) {
+	if c.isScriptOnly() {
+		return json.Marshal(c.Run.Script)
+	}
+
+	type rawMetadataCommand RawMetadataCommand
+
+	return json.Marshal(rawMetadataCommand(c))
+}
+
+// UnmarshalJSON accepts either a string, which is a command line, or an array of the
+// program and its arguments.
+func (r *RawMetadataCommandRun) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("\"")) {
+		*r = RawMetadataCommandRun{}
+		return json.Unmarshal(data, &r.Script)
+	}
+
+	*r = RawMetadataCommandRun{}
+	return json.Unmarshal(data, &r.Args)
+}
+
+func (r RawMetadataCommandRun) MarshalJSON() ([]byte, error) {
+	if r.Args != nil {
+		return json.Marshal(r.Args)
+	}
+
+	return json.Marshal(r.Script)
+}
+
+// parseCommand converts a command in tooth.json to a Command.
+func parseCommand(rawCommand RawMetadataCommand) (Command, error) {
+	if rawCommand.Run.Args != nil && len(rawCommand.Run.Args) == 0 {
+		return Command{}, fmt.Errorf("run of a command cannot be an empty array")
+	}
+
+	// "." and an empty cwd are both the workspace itself.
+	cwd := path.MakeEmpty()
+	if cleanedCwd := filepath.Clean(rawCommand.Cwd); rawCommand.Cwd != "" && cleanedCwd != "." {
+		if gopath.IsAbs(filepath.ToSlash(cleanedCwd)) || filepath.VolumeName(cleanedCwd) != "" {
+			return Command{}, fmt.Errorf("cwd %v must be relative to the workspace", rawCommand.Cwd)
+		}
+
+		parsedCwd, err := path.Parse(cleanedCwd)
+		if err != nil {
+			return Command{}, fmt.Errorf("failed to parse cwd %v\n\t%w", rawCommand.Cwd, err)
+		}
+
+		cwd = parsedCwd
+	}
+
+	var timeout time.Duration
+	if rawCommand.Timeout != "" {
+		parsedTimeout, err := time.ParseDuration(rawCommand.Timeout)
+		if err != nil {
+			return Command{}, fmt.Errorf("failed to parse timeout %v\n\t%w", rawCommand.Timeout, err)
+		} else if parsedTimeout <= 0 {
+			return Command{}, fmt.Errorf("timeout %v must be positive", rawCommand.Timeout)
+		}
+
+		timeout = parsedTimeout
+	}
+
+	env := make(map[string]string)
+	for key, value := range rawCommand.Env {
+		env[key] = value
+	}
+
+	return Command{
+		Script:          rawCommand.Run.Script,
+		Args:            append([]string(nil), rawCommand.Run.Args...),
+		Shell:           rawCommand.Shell,
+		Cwd:             cwd,
+		Env:             env,
+		Timeout:         timeout,
+		ContinueOnError: rawCommand.ContinueOnError,
+	}, nil
+}
+
+// parseCommands converts the commands of a hook in tooth.json to Commands.
+func parseCommands(rawCommands []RawMetadataCommand) ([]Command, error) {
+	commands := make([]Command, 0, len(rawCommands))
+	for _, rawCommand := range rawCommands {
+		command, err := parseCommand(rawCommand)
+		if err != nil {
+			return nil, err
+		}
+
+		commands = append(commands, command)
+	}
+
+	return commands, nil
+}
@@ -0,0 +1,126 @@
+package tooth
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseCommand(t *testing.T) {
+	testCases := []struct {
+		name string
+		// rawCommand is the command in tooth.json.
+		rawCommand string
+		want       Command
+		wantCwd    string
+		wantErr    bool
+	}{
+		{
+			name:       "command line",
+			rawCommand: `"echo hello"`,
+			want:       Command{Script: "echo hello"},
+		},
+		{
+			name:       "command line in object",
+			rawCommand: `{"run": "echo hello", "shell": "bash"}`,
+			want:       Command{Script: "echo hello", Shell: "bash"},
+		},
+		{
+			name:       "program and arguments",
+			rawCommand: `{"run": ["echo", "hello world"]}`,
+			want:       Command{Args: []string{"echo", "hello world"}},
+		},
+		{
+			name:       "empty program and arguments",
+			rawCommand: `{"run": []}`,
+			wantErr:    true,
+		},
+		{
+			name:       "all options",
+			rawCommand: `{"run": "./setup", "cwd": "plugins/foo", "env": {"FOO": "bar"}, "timeout": "1m30s", "continue_on_error": true}`,
+			want: Command{
+				Script:          "./setup",
+				Env:             map[string]string{"FOO": "bar"},
+				Timeout:         90 * time.Second,
+				ContinueOnError: true,
+			},
+			wantCwd: "plugins/foo",
+		},
+		{
+			name:       "workspace as cwd",
+			rawCommand: `{"run": "ls", "cwd": "."}`,
+			want:       Command{Script: "ls"},
+		},
+		{
+			name:       "workspace with trailing slash as cwd",
+			rawCommand: `{"run": "ls", "cwd": "./"}`,
+			want:       Command{Script: "ls"},
+		},
+		{
+			name:       "cwd starting with ./",
+			rawCommand: `{"run": "ls", "cwd": "./plugins"}`,
+			want:       Command{Script: "ls"},
+			wantCwd:    "plugins",
+		},
+		{
+			name:       "cwd with ..",
+			rawCommand: `{"run": "ls", "cwd": "plugins/../worlds"}`,
+			want:       Command{Script: "ls"},
+			wantCwd:    "worlds",
+		},
+		{
+			name:       "cwd outside the workspace",
+			rawCommand: `{"run": "ls", "cwd": "../plugins"}`,
+			wantErr:    true,
+		},
+		{
+			name:       "absolute cwd",
+			rawCommand: `{"run": "ls", "cwd": "/plugins"}`,
+			wantErr:    true,
+		},
+		{
+			name:       "invalid timeout",
+			rawCommand: `{"run": "ls", "timeout": "soon"}`,
+			wantErr:    true,
+		},
+		{
+			name:       "non-positive timeout",
+			rawCommand: `{"run": "ls", "timeout": "0s"}`,
+			wantErr:    true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var rawCommand RawMetadataCommand
+			if err := json.Unmarshal([]byte(testCase.rawCommand), &rawCommand); err != nil {
+				t.Fatalf("failed to unmarshal command: %v", err)
+			}
+
+			command, err := parseCommand(rawCommand)
+			if testCase.wantErr {
+				if err == nil {
+					t.Errorf("parseCommand() error = nil, want an error")
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("parseCommand() error = %v", err)
+			}
+
+			if command.Cwd.String() != testCase.wantCwd {
+				t.Errorf("parseCommand().Cwd = %q, want %q", command.Cwd.String(), testCase.wantCwd)
+			}
+
+			want := testCase.want
+			want.Cwd = command.Cwd
+			if want.Env == nil {
+				want.Env = make(map[string]string)
+			}
+
+			if !reflect.DeepEqual(command, want) {
+				t.Errorf("parseCommand() = %#v, want %#v", command, want)
+			}
+		})
+	}
+}
@@ -2,6 +2,58 @@ package tooth
 
 const metadataJSONSchema = `{
 	"$schema": "https://json-schema.org/draft-07/schema#",
+	"definitions": {
+		"command": {
+			"oneOf": [
+				{
+					"type": "string"
+				},
+				{
+					"type": "object",
+					"properties": {
+						"run": {
+							"oneOf": [
+								{
+									"type": "string"
+								},
+								{
+									"type": "array",
+									"items": {
+										"type": "string"
+									},
+									"minItems": 1
+								}
+							]
+						},
+						"cwd": {
+							"type": "string"
+						},
+						"env": {
+							"type": "object",
+							"patternProperties": {
+								"^.*$": {
+									"type": "string"
+								}
+							}
+						},
+						"timeout": {
+							"type": "string"
+						},
+						"continue_on_error": {
+							"type": "boolean"
+						},
+						"shell": {
+							"type": "string"
+						}
+					},
+					"required": [
+						"run"
+					],
+					"additionalProperties": false
+				}
+			]
+		}
+	},
 	"type": "object",
 	"properties": {
 		"format_version": {
@@ -53,25 +105,37 @@ const metadataJSONSchema = `{
 				"pre_install": {
 					"type": "array",
 					"items": {
-						"type": "string"
+						"$ref": "#/definitions/command"
 					}
 				},
 				"post_install": {
 					"type": "array",
 					"items": {
-						"type": "string"
+						"$ref": "#/definitions/command"
 					}
 				},
 				"pre_uninstall": {
 					"type": "array",
 					"items": {
-						"type": "string"
+						"$ref": "#/definitions/command"
 					}
 				},
 				"post_uninstall": {
 					"type": "array",
 					"items": {
-						"type": "string"
+						"$ref": "#/definitions/command"
+					}
+				},
+				"pre_upgrade": {
+					"type": "array",
+					"items": {
+						"$ref": "#/definitions/command"
+					}
+				},
+				"post_upgrade": {
+					"type": "array",
+					"items": {
+						"$ref": "#/definitions/command"
 					}
 				}
 			}
@@ -92,6 +156,30 @@ const metadataJSONSchema = `{
 				}
 			}
 		},
+		"conflicts": {
+			"type": "object",
+			"patternProperties": {
+				"^.*$": {
+					"type": "string"
+				}
+			}
+		},
+		"provides": {
+			"type": "object",
+			"patternProperties": {
+				"^.*$": {
+					"type": "string"
+				}
+			}
+		},
+		"replaces": {
+			"type": "object",
+			"patternProperties": {
+				"^.*$": {
+					"type": "string"
+				}
+			}
+		},
 		"files": {
 			"type": "object",
 			"properties": {
@@ -127,6 +215,28 @@ const metadataJSONSchema = `{
 				}
 			}
 		},
+		"features": {
+			"type": "object",
+			"patternProperties": {
+				"^[a-z0-9-]+$": {
+					"type": "object",
+					"properties": {
+						"description": {
+							"type": "string"
+						},
+						"dependencies": {
+							"type": "object",
+							"patternProperties": {
+								"^.*$": {
+									"type": "string"
+								}
+							}
+						}
+					}
+				}
+			},
+			"additionalProperties": false
+		},
 		"platforms": {
 			"type": "array",
 			"items": {
@@ -147,25 +257,37 @@ const metadataJSONSchema = `{
 							"pre_install": {
 								"type": "array",
 								"items": {
-									"type": "string"
+									"$ref": "#/definitions/command"
 								}
 							},
 							"post_install": {
 								"type": "array",
 								"items": {
-									"type": "string"
+									"$ref": "#/definitions/command"
 								}
 							},
 							"pre_uninstall": {
 								"type": "array",
 								"items": {
-									"type": "string"
+									"$ref": "#/definitions/command"
 								}
 							},
 							"post_uninstall": {
 								"type": "array",
 								"items": {
-									"type": "string"
+									"$ref": "#/definitions/command"
+								}
+							},
+							"pre_upgrade": {
+								"type": "array",
+								"items": {
+									"$ref": "#/definitions/command"
+								}
+							},
+							"post_upgrade": {
+								"type": "array",
+								"items": {
+									"$ref": "#/definitions/command"
 								}
 							}
 						}
@@ -186,6 +308,30 @@ const metadataJSONSchema = `{
 							}
 						}
 					},
+					"conflicts": {
+						"type": "object",
+						"patternProperties": {
+							"^.*$": {
+								"type": "string"
+							}
+						}
+					},
+					"provides": {
+						"type": "object",
+						"patternProperties": {
+							"^.*$": {
+								"type": "string"
+							}
+						}
+					},
+					"replaces": {
+						"type": "object",
+						"patternProperties": {
+							"^.*$": {
+								"type": "string"
+							}
+						}
+					},
 					"files": {
 						"type": "object",
 						"properties": {
@@ -214,6 +360,28 @@ const metadataJSONSchema = `{
 								}
 							}
 						}
+					},
+					"features": {
+						"type": "object",
+						"patternProperties": {
+							"^[a-z0-9-]+$": {
+								"type": "object",
+								"properties": {
+									"description": {
+										"type": "string"
+									},
+									"dependencies": {
+										"type": "object",
+										"patternProperties": {
+											"^.*$": {
+												"type": "string"
+											}
+										}
+									}
+								}
+							}
+						},
+						"additionalProperties": false
 					}
 				},
 				"required": [
@@ -0,0 +1,69 @@
+package tooth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/lippkg/lip/internal/context"
+	"github.com/lippkg/lip/internal/path"
+)
+
+// LockFileFormatVersion is the format version of lockfiles written by this version of lip.
+const LockFileFormatVersion = 1
+
+// LockFile records the exact set of teeth installed in a workspace, so that it can be
+// reproduced on another machine.
+type LockFile struct {
+	FormatVersion int           `json:"format_version"`
+	Teeth         []LockedTooth `json:"teeth"`
+}
+
+// LockedTooth records an installed tooth in a lockfile.
+type LockedTooth struct {
+	ToothRepoPath string   `json:"tooth"`
+	Version       string   `json:"version"`
+	InstallReason string   `json:"install_reason"`
+	Features      []string `json:"features,omitempty"`
+	Source
+}
+
+// GetLockFilePath returns the path of the lockfile, which is lip.lock in the workspace.
+func GetLockFilePath(ctx *context.Context) (path.Path, error) {
+	localDotLipDir, err := ctx.LocalDotLipDir()
+	if err != nil {
+		return path.Path{}, fmt.Errorf("failed to get local .lip directory\n\t%w", err)
+	}
+
+	workspaceDir, err := localDotLipDir.Dir()
+	if err != nil {
+		return path.Path{}, fmt.Errorf("failed to get workspace directory\n\t%w", err)
+	}
+
+	return workspaceDir.Join(path.MustParse("lip.lock")), nil
+}
+
+// GetLockFile reads the lockfile of the workspace. If there is no lockfile, the returned
+// error wraps os.ErrNotExist.
+func GetLockFile(ctx *context.Context) (LockFile, error) {
+	lockFilePath, err := GetLockFilePath(ctx)
+	if err != nil {
+		return LockFile{}, fmt.Errorf("failed to get lockfile path\n\t%w", err)
+	}
+
+	jsonBytes, err := os.ReadFile(lockFilePath.LocalString())
+	if err != nil {
+		return LockFile{}, fmt.Errorf("failed to read lockfile\n\t%w", err)
+	}
+
+	var lockFile LockFile
+	if err := json.Unmarshal(jsonBytes, &lockFile); err != nil {
+		return LockFile{}, fmt.Errorf("failed to unmarshal lockfile\n\t%w", err)
+	}
+
+	if lockFile.FormatVersion != LockFileFormatVersion {
+		return LockFile{}, fmt.Errorf("unsupported lockfile format version %v", lockFile.FormatVersion)
+	}
+
+	return lockFile, nil
+}
@@ -0,0 +1,149 @@
+package tooth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+
+	"github.com/lippkg/lip/internal/context"
+	"github.com/lippkg/lip/internal/path"
+)
+
+// Manifest records the state of an installed tooth, including the files placed when
+// it was installed.
+type Manifest struct {
+	ToothRepoPath string `json:"tooth"`
+	Version       string `json:"version"`
+	// InstallReason is either InstallReasonExplicit or InstallReasonDependency.
+	InstallReason string         `json:"install_reason"`
+	Source        Source         `json:"source"`
+	Files         []ManifestFile `json:"files"`
+}
+
+// Source tells where the tooth archive and the asset archive of a tooth were downloaded
+// from, with the hex-encoded SHA-256 hashes of the archives. ArchiveURL is empty if the
+// tooth was installed from a local tooth archive, and the asset fields are empty if the
+// tooth has no asset URL.
+type Source struct {
+	ArchiveURL    string `json:"archive_url,omitempty"`
+	ArchiveSHA256 string `json:"archive_sha256,omitempty"`
+	AssetURL      string `json:"asset_url,omitempty"`
+	AssetSHA256   string `json:"asset_sha256,omitempty"`
+}
+
+const (
+	// InstallReasonExplicit means that the tooth was requested by the user.
+	InstallReasonExplicit = "explicit"
+	// InstallReasonDependency means that the tooth was installed as a dependency of
+	// other teeth.
+	InstallReasonDependency = "dependency"
+)
+
+// ManifestFile records a placed file. Path is relative to the workspace.
+type ManifestFile struct {
+	Path   string      `json:"path"`
+	Size   int64       `json:"size"`
+	Mode   os.FileMode `json:"mode"`
+	SHA256 string      `json:"sha256"`
+}
+
+// MakeManifestFile reads the file at the path relative to the workspace directory and
+// records its size, mode and SHA-256 hash.
+func MakeManifestFile(workspaceDir path.Path, relFilePath path.Path) (ManifestFile, error) {
+	filePath := workspaceDir.Join(relFilePath)
+
+	info, err := os.Stat(filePath.LocalString())
+	if err != nil {
+		return ManifestFile{}, fmt.Errorf("failed to get info of %v\n\t%w", filePath.LocalString(), err)
+	}
+
+	if info.IsDir() {
+		return ManifestFile{}, fmt.Errorf("%v is a directory", filePath.LocalString())
+	}
+
+	hash, err := HashFile(filePath)
+	if err != nil {
+		return ManifestFile{}, fmt.Errorf("failed to hash %v\n\t%w", filePath.LocalString(), err)
+	}
+
+	return ManifestFile{
+		Path:   relFilePath.String(),
+		Size:   info.Size(),
+		Mode:   info.Mode(),
+		SHA256: hash,
+	}, nil
+}
+
+// HashFile returns the hex-encoded SHA-256 hash of the file.
+func HashFile(filePath path.Path) (string, error) {
+	file, err := os.Open(filePath.LocalString())
+	if err != nil {
+		return "", fmt.Errorf("failed to open %v\n\t%w", filePath.LocalString(), err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to read %v\n\t%w", filePath.LocalString(), err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// GetManifestFilePath returns the path of the manifest file of the tooth. The manifest
+// is saved next to the metadata file but with the .manifest extension, so that it is
+// not taken as metadata.
+func GetManifestFilePath(ctx *context.Context, toothRepoPath string) (path.Path, error) {
+	metadataDir, err := ctx.MetadataDir()
+	if err != nil {
+		return path.Path{}, fmt.Errorf("failed to get metadata directory\n\t%w", err)
+	}
+
+	manifestFileName := url.QueryEscape(toothRepoPath) + ".manifest"
+
+	return metadataDir.Join(path.MustParse(manifestFileName)), nil
+}
+
+// GetManifest reads the manifest of the installed tooth. Teeth installed by older
+// versions of lip have no manifest, in which case the returned error wraps
+// os.ErrNotExist.
+func GetManifest(ctx *context.Context, toothRepoPath string) (Manifest, error) {
+	manifestFilePath, err := GetManifestFilePath(ctx, toothRepoPath)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("failed to get manifest file path\n\t%w", err)
+	}
+
+	jsonBytes, err := os.ReadFile(manifestFilePath.LocalString())
+	if err != nil {
+		return Manifest{}, fmt.Errorf("failed to read manifest file\n\t%w", err)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(jsonBytes, &manifest); err != nil {
+		return Manifest{}, fmt.Errorf("failed to unmarshal manifest file\n\t%w", err)
+	}
+
+	return manifest, nil
+}
+
+// GetInstallReason returns why the installed tooth was installed. Teeth installed by
+// older versions of lip are taken as explicitly installed.
+func GetInstallReason(ctx *context.Context, toothRepoPath string) (string, error) {
+	manifest, err := GetManifest(ctx, toothRepoPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return InstallReasonExplicit, nil
+	} else if err != nil {
+		return "", err
+	}
+
+	if manifest.InstallReason == "" {
+		return InstallReasonExplicit, nil
+	}
+
+	return manifest.InstallReason, nil
+}
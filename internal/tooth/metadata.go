@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"sort"
 	"strings"
 
 	gopath "path"
@@ -27,10 +28,12 @@ type Info struct {
 	Tags        []string
 }
 type Commands struct {
-	PreInstall    []string
-	PostInstall   []string
-	PreUninstall  []string
-	PostUninstall []string
+	PreInstall    []Command
+	PostInstall   []Command
+	PreUninstall  []Command
+	PostUninstall []Command
+	PreUpgrade    []Command
+	PostUpgrade   []Command
 }
 
 type Files struct {
@@ -44,6 +47,13 @@ type FilesPlaceItem struct {
 	Dest path.Path
 }
 
+// Feature is an optional group of dependencies, installed only if the feature is
+// enabled.
+type Feature struct {
+	Description  string
+	Dependencies map[string]string
+}
+
 const expectedFormatVersion = 2
 
 // MakeMetadata parses the given jsonBytes and returns a Metadata.
@@ -126,7 +136,13 @@ func MakeMetadataFromRaw(rawMetadata RawMetadata) (Metadata, error) {
 		return Metadata{}, fmt.Errorf("failed to parse version\n\t%w", err)
 	}
 
-	return Metadata{rawMetadata}, nil
+	metadata := Metadata{rawMetadata}
+
+	if _, err := metadata.Commands(); err != nil {
+		return Metadata{}, fmt.Errorf("failed to parse commands\n\t%w", err)
+	}
+
+	return metadata, nil
 }
 
 func (m Metadata) ToothRepoPath() string {
@@ -145,35 +161,133 @@ func (m Metadata) AssetURL() (*url.URL, error) {
 	return url.Parse(m.rawMetadata.AssetURL)
 }
 
-func (m Metadata) Commands() Commands {
-	return Commands(m.rawMetadata.Commands)
+func (m Metadata) Commands() (Commands, error) {
+	preInstall, err := parseCommands(m.rawMetadata.Commands.PreInstall)
+	if err != nil {
+		return Commands{}, fmt.Errorf("invalid pre_install command\n\t%w", err)
+	}
+
+	postInstall, err := parseCommands(m.rawMetadata.Commands.PostInstall)
+	if err != nil {
+		return Commands{}, fmt.Errorf("invalid post_install command\n\t%w", err)
+	}
+
+	preUninstall, err := parseCommands(m.rawMetadata.Commands.PreUninstall)
+	if err != nil {
+		return Commands{}, fmt.Errorf("invalid pre_uninstall command\n\t%w", err)
+	}
+
+	postUninstall, err := parseCommands(m.rawMetadata.Commands.PostUninstall)
+	if err != nil {
+		return Commands{}, fmt.Errorf("invalid post_uninstall command\n\t%w", err)
+	}
+
+	preUpgrade, err := parseCommands(m.rawMetadata.Commands.PreUpgrade)
+	if err != nil {
+		return Commands{}, fmt.Errorf("invalid pre_upgrade command\n\t%w", err)
+	}
+
+	postUpgrade, err := parseCommands(m.rawMetadata.Commands.PostUpgrade)
+	if err != nil {
+		return Commands{}, fmt.Errorf("invalid post_upgrade command\n\t%w", err)
+	}
+
+	return Commands{
+		PreInstall:    preInstall,
+		PostInstall:   postInstall,
+		PreUninstall:  preUninstall,
+		PostUninstall: postUninstall,
+		PreUpgrade:    preUpgrade,
+		PostUpgrade:   postUpgrade,
+	}, nil
+}
+
+// HasUpgradeCommands tells whether there are pre_upgrade or post_upgrade commands, which
+// run instead of the uninstall and install commands when replacing an older installed
+// version.
+func (c Commands) HasUpgradeCommands() bool {
+	return len(c.PreUpgrade) != 0 || len(c.PostUpgrade) != 0
 }
 
+// Dependencies returns the dependencies of the tooth, including those of the enabled
+// features. If a dependency is required more than once, all of its version ranges must
+// be satisfied.
 func (m Metadata) Dependencies() (map[string]semver.Range, error) {
 	dependencies := make(map[string]semver.Range)
 
-	for toothRepoPath, dep := range m.rawMetadata.Dependencies {
-		versionRange, err := semver.ParseRange(dep)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse version range \"%v\" of %v\n\t%w", dep, toothRepoPath, err)
-		}
+	for _, depMap := range m.dependencyMaps() {
+		for toothRepoPath, dep := range depMap {
+			versionRange, err := semver.ParseRange(dep)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse version range \"%v\" of %v\n\t%w", dep, toothRepoPath, err)
+			}
 
-		dependencies[toothRepoPath] = versionRange
+			if existingVersionRange, ok := dependencies[toothRepoPath]; ok {
+				versionRange = existingVersionRange.AND(versionRange)
+			}
+
+			dependencies[toothRepoPath] = versionRange
+		}
 	}
 
 	return dependencies, nil
 }
 
+// DependenciesAsStrings returns the version ranges of the dependencies as strings,
+// including those of the enabled features. Version ranges of a dependency required more
+// than once are joined with ", ".
 func (m Metadata) DependenciesAsStrings() map[string]string {
 	dependencies := make(map[string]string)
 
-	for toothRepoPath, dep := range m.rawMetadata.Dependencies {
-		dependencies[toothRepoPath] = dep
+	for _, depMap := range m.dependencyMaps() {
+		for toothRepoPath, dep := range depMap {
+			if existingDep, ok := dependencies[toothRepoPath]; ok && existingDep != dep {
+				dep = existingDep + ", " + dep
+			}
+
+			dependencies[toothRepoPath] = dep
+		}
 	}
 
 	return dependencies
 }
 
+// dependencyMaps returns the dependencies of the tooth followed by those of each enabled
+// feature.
+func (m Metadata) dependencyMaps() []map[string]string {
+	depMaps := []map[string]string{m.rawMetadata.Dependencies}
+
+	for _, feature := range m.rawMetadata.EnabledFeatures {
+		depMaps = append(depMaps, m.rawMetadata.Features[feature].Dependencies)
+	}
+
+	return depMaps
+}
+
+// Features returns the optional features of the tooth by name.
+func (m Metadata) Features() map[string]Feature {
+	features := make(map[string]Feature)
+
+	for name, feature := range m.rawMetadata.Features {
+		dependencies := make(map[string]string)
+		for toothRepoPath, dep := range feature.Dependencies {
+			dependencies[toothRepoPath] = dep
+		}
+
+		features[name] = Feature{
+			Description:  feature.Description,
+			Dependencies: dependencies,
+		}
+	}
+
+	return features
+}
+
+// EnabledFeatures returns the sorted names of the enabled features.
+func (m Metadata) EnabledFeatures() []string {
+	return append([]string{}, m.rawMetadata.EnabledFeatures...)
+}
+
 func (m Metadata) Prerequisites() (map[string]semver.Range, error) {
 	prerequisites := make(map[string]semver.Range)
 
@@ -199,6 +313,87 @@ func (m Metadata) PrerequisitesAsStrings() map[string]string {
 	return prerequisites
 }
 
+// Conflicts returns the teeth that cannot be installed together with the tooth, mapped
+// to the conflicting version ranges.
+func (m Metadata) Conflicts() (map[string]semver.Range, error) {
+	conflicts := make(map[string]semver.Range)
+
+	for toothRepoPath, conflict := range m.rawMetadata.Conflicts {
+		versionRange, err := semver.ParseRange(conflict)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse version range \"%v\" of %v\n\t%w", conflict, toothRepoPath, err)
+		}
+
+		conflicts[toothRepoPath] = versionRange
+	}
+
+	return conflicts, nil
+}
+
+func (m Metadata) ConflictsAsStrings() map[string]string {
+	conflicts := make(map[string]string)
+
+	for toothRepoPath, conflict := range m.rawMetadata.Conflicts {
+		conflicts[toothRepoPath] = conflict
+	}
+
+	return conflicts
+}
+
+// Provides returns the virtual teeth provided by the tooth, mapped to the provided
+// versions.
+func (m Metadata) Provides() (map[string]semver.Version, error) {
+	provides := make(map[string]semver.Version)
+
+	for toothRepoPath, provided := range m.rawMetadata.Provides {
+		version, err := semver.Parse(provided)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse version \"%v\" of %v\n\t%w", provided, toothRepoPath, err)
+		}
+
+		provides[toothRepoPath] = version
+	}
+
+	return provides, nil
+}
+
+func (m Metadata) ProvidesAsStrings() map[string]string {
+	provides := make(map[string]string)
+
+	for toothRepoPath, provided := range m.rawMetadata.Provides {
+		provides[toothRepoPath] = provided
+	}
+
+	return provides
+}
+
+// Replaces returns the teeth replaced by the tooth, mapped to the replaced version
+// ranges.
+func (m Metadata) Replaces() (map[string]semver.Range, error) {
+	replaces := make(map[string]semver.Range)
+
+	for toothRepoPath, replaced := range m.rawMetadata.Replaces {
+		versionRange, err := semver.ParseRange(replaced)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse version range \"%v\" of %v\n\t%w", replaced, toothRepoPath, err)
+		}
+
+		replaces[toothRepoPath] = versionRange
+	}
+
+	return replaces, nil
+}
+
+func (m Metadata) ReplacesAsStrings() map[string]string {
+	replaces := make(map[string]string)
+
+	for toothRepoPath, replaced := range m.rawMetadata.Replaces {
+		replaces[toothRepoPath] = replaced
+	}
+
+	return replaces
+}
+
 func (m Metadata) Files() (Files, error) {
 	if !m.IsWildcardPopulated() {
 		return Files{}, fmt.Errorf("wildcard is not populated")
@@ -278,6 +473,23 @@ func (m Metadata) ToPlatformSpecific(goos string, goarch string) (Metadata, erro
 	if raw.Prerequisites == nil {
 		raw.Prerequisites = make(map[string]string)
 	}
+	if raw.Conflicts == nil {
+		raw.Conflicts = make(map[string]string)
+	}
+	if raw.Provides == nil {
+		raw.Provides = make(map[string]string)
+	}
+	if raw.Replaces == nil {
+		raw.Replaces = make(map[string]string)
+	}
+
+	// Copy features so that merging platform-specific features does not change m.
+	features := make(map[string]RawMetadataFeaturesItem)
+	for name, feature := range raw.Features {
+		features[name] = feature
+	}
+	raw.Features = features
+
 	raw.Platforms = nil
 
 	for _, platformItem := range m.rawMetadata.Platforms {
@@ -297,6 +509,8 @@ func (m Metadata) ToPlatformSpecific(goos string, goarch string) (Metadata, erro
 		raw.Commands.PostInstall = append(raw.Commands.PostInstall, platformItem.Commands.PostInstall...)
 		raw.Commands.PreUninstall = append(raw.Commands.PreUninstall, platformItem.Commands.PreUninstall...)
 		raw.Commands.PostUninstall = append(raw.Commands.PostUninstall, platformItem.Commands.PostUninstall...)
+		raw.Commands.PreUpgrade = append(raw.Commands.PreUpgrade, platformItem.Commands.PreUpgrade...)
+		raw.Commands.PostUpgrade = append(raw.Commands.PostUpgrade, platformItem.Commands.PostUpgrade...)
 
 		for toothRepoPath, dep := range platformItem.Dependencies {
 			raw.Dependencies[toothRepoPath] = dep
@@ -306,6 +520,37 @@ func (m Metadata) ToPlatformSpecific(goos string, goarch string) (Metadata, erro
 			raw.Prerequisites[toothRepoPath] = prereq
 		}
 
+		for toothRepoPath, conflict := range platformItem.Conflicts {
+			raw.Conflicts[toothRepoPath] = conflict
+		}
+
+		for toothRepoPath, provided := range platformItem.Provides {
+			raw.Provides[toothRepoPath] = provided
+		}
+
+		for toothRepoPath, replaced := range platformItem.Replaces {
+			raw.Replaces[toothRepoPath] = replaced
+		}
+
+		for name, feature := range platformItem.Features {
+			mergedFeature := raw.Features[name]
+
+			if feature.Description != "" {
+				mergedFeature.Description = feature.Description
+			}
+
+			mergedDependencies := make(map[string]string)
+			for toothRepoPath, dep := range mergedFeature.Dependencies {
+				mergedDependencies[toothRepoPath] = dep
+			}
+			for toothRepoPath, dep := range feature.Dependencies {
+				mergedDependencies[toothRepoPath] = dep
+			}
+			mergedFeature.Dependencies = mergedDependencies
+
+			raw.Features[name] = mergedFeature
+		}
+
 		raw.Files.Place = append(raw.Files.Place, platformItem.Files.Place...)
 		raw.Files.Preserve = append(raw.Files.Preserve, platformItem.Files.Preserve...)
 		raw.Files.Remove = append(raw.Files.Remove, platformItem.Files.Remove...)
@@ -314,6 +559,33 @@ func (m Metadata) ToPlatformSpecific(goos string, goarch string) (Metadata, erro
 	return MakeMetadataFromRaw(raw)
 }
 
+// ToFeaturesEnabled returns the metadata with exactly the given features enabled. Every
+// feature must be declared in the features field.
+func (m Metadata) ToFeaturesEnabled(features []string) (Metadata, error) {
+	newRaw := m.rawMetadata
+
+	isEnabled := make(map[string]bool)
+	enabledFeatures := make([]string, 0)
+	for _, feature := range features {
+		if _, ok := m.rawMetadata.Features[feature]; !ok {
+			return Metadata{}, fmt.Errorf("tooth %v has no feature %v", m.ToothRepoPath(), feature)
+		}
+
+		if !isEnabled[feature] {
+			isEnabled[feature] = true
+			enabledFeatures = append(enabledFeatures, feature)
+		}
+	}
+	sort.Strings(enabledFeatures)
+
+	newRaw.EnabledFeatures = nil
+	if len(enabledFeatures) != 0 {
+		newRaw.EnabledFeatures = enabledFeatures
+	}
+
+	return Metadata{newRaw}, nil
+}
+
 // ToFilePathPrefixPrepended prepends the given prefix to files.place field of metadata.
 func (m Metadata) ToFilePathPrefixPrepended(prefix path.Path) Metadata {
 	newRaw := m.rawMetadata
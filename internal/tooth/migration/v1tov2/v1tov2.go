@@ -169,10 +169,16 @@ type RawMetadataInfo struct {
 }
 
 type RawMetadataCommands struct {
-	PreInstall    []string `json:"pre_install,omitempty"`
-	PostInstall   []string `json:"post_install,omitempty"`
-	PreUninstall  []string `json:"pre_uninstall,omitempty"`
-	PostUninstall []string `json:"post_uninstall,omitempty"`
+	PreInstall    []RawMetadataCommandsItem `json:"pre_install,omitempty"`
+	PostInstall   []RawMetadataCommandsItem `json:"post_install,omitempty"`
+	PreUninstall  []RawMetadataCommandsItem `json:"pre_uninstall,omitempty"`
+	PostUninstall []RawMetadataCommandsItem `json:"post_uninstall,omitempty"`
+}
+
+// RawMetadataCommandsItem is a command in object form. v1 commands are command lines run
+// by the default shell.
+type RawMetadataCommandsItem struct {
+	Run string `json:"run"`
 }
 
 type RawMetadataFiles struct {
@@ -230,10 +236,10 @@ func Migrate(jsonBytes []byte) ([]byte, error) {
 			Tags:        make([]string, 0),
 		},
 		Commands: RawMetadataCommands{
-			PreInstall:    make([]string, 0),
-			PostInstall:   make([]string, 0),
-			PreUninstall:  make([]string, 0),
-			PostUninstall: make([]string, 0),
+			PreInstall:    make([]RawMetadataCommandsItem, 0),
+			PostInstall:   make([]RawMetadataCommandsItem, 0),
+			PreUninstall:  make([]RawMetadataCommandsItem, 0),
+			PostUninstall: make([]RawMetadataCommandsItem, 0),
 		},
 		Dependencies: make(map[string]string),
 		Files: RawMetadataFiles{
@@ -263,13 +269,18 @@ func Migrate(jsonBytes []byte) ([]byte, error) {
 			continue
 		}
 
+		commands := make([]RawMetadataCommandsItem, 0, len(v1Command.Commands))
+		for _, command := range v1Command.Commands {
+			commands = append(commands, RawMetadataCommandsItem{Run: command})
+		}
+
 		switch v1Command.Type {
 		case "install":
 			v2RawMetadata.Commands.PostInstall = append(
-				v2RawMetadata.Commands.PostInstall, v1Command.Commands...)
+				v2RawMetadata.Commands.PostInstall, commands...)
 		case "uninstall":
 			v2RawMetadata.Commands.PreUninstall = append(
-				v2RawMetadata.Commands.PreUninstall, v1Command.Commands...)
+				v2RawMetadata.Commands.PreUninstall, commands...)
 		}
 	}
 
@@ -0,0 +1,108 @@
+package tooth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/lippkg/lip/internal/context"
+	"github.com/lippkg/lip/internal/path"
+)
+
+// GetFileOwnersFilePath returns the path of the file ownership registry.
+func GetFileOwnersFilePath(ctx *context.Context) (path.Path, error) {
+	localDotLipDir, err := ctx.LocalDotLipDir()
+	if err != nil {
+		return path.Path{}, fmt.Errorf("failed to get local .lip directory\n\t%w", err)
+	}
+
+	return localDotLipDir.Join(path.MustParse("file_owners.json")), nil
+}
+
+// GetFileOwners returns a map from the paths of placed files, relative to the workspace,
+// to the tooth repo paths of the teeth owning them. If the registry does not exist, e.g.
+// in a workspace managed by an older version of lip, it is rebuilt from the installed
+// tooth metadata.
+func GetFileOwners(ctx *context.Context) (map[string]string, error) {
+	fileOwnersFilePath, err := GetFileOwnersFilePath(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file owners file path\n\t%w", err)
+	}
+
+	jsonBytes, err := os.ReadFile(fileOwnersFilePath.LocalString())
+	if os.IsNotExist(err) {
+		return getFileOwnersFromMetadata(ctx)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read file owners file\n\t%w", err)
+	}
+
+	fileOwners := make(map[string]string)
+	if err := json.Unmarshal(jsonBytes, &fileOwners); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal file owners file\n\t%w", err)
+	}
+
+	return fileOwners, nil
+}
+
+// GetFileOwner returns the tooth repo path of the tooth owning the file. The second
+// return value is false if no installed tooth owns the file.
+func GetFileOwner(ctx *context.Context, filePath path.Path) (string, bool, error) {
+	fileOwners, err := GetFileOwners(ctx)
+	if err != nil {
+		return "", false, err
+	}
+
+	owner, ok := fileOwners[filePath.String()]
+	return owner, ok, nil
+}
+
+// GetOwnedFiles returns the paths of the files owned by the tooth.
+func GetOwnedFiles(ctx *context.Context, toothRepoPath string) ([]path.Path, error) {
+	fileOwners, err := GetFileOwners(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ownedFiles := make([]path.Path, 0)
+	for filePathString, owner := range fileOwners {
+		if owner != toothRepoPath {
+			continue
+		}
+
+		filePath, err := path.Parse(filePathString)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse file path %v\n\t%w", filePathString, err)
+		}
+
+		ownedFiles = append(ownedFiles, filePath)
+	}
+
+	sort.Slice(ownedFiles, func(i, j int) bool {
+		return ownedFiles[i].String() < ownedFiles[j].String()
+	})
+
+	return ownedFiles, nil
+}
+
+func getFileOwnersFromMetadata(ctx *context.Context) (map[string]string, error) {
+	fileOwners := make(map[string]string)
+
+	metadataList, err := GetAllMetadata(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list all installed tooth metadata\n\t%w", err)
+	}
+
+	for _, metadata := range metadataList {
+		files, err := metadata.Files()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get files of %v\n\t%w", metadata.ToothRepoPath(), err)
+		}
+
+		for _, place := range files.Place {
+			fileOwners[place.Dest.String()] = metadata.ToothRepoPath()
+		}
+	}
+
+	return fileOwners, nil
+}
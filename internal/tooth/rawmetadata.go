@@ -12,9 +12,18 @@ type RawMetadata struct {
 	Commands      RawMetadataCommands `json:"commands,omitempty"`
 	Dependencies  map[string]string   `json:"dependencies,omitempty"`
 	Prerequisites map[string]string   `json:"prerequisites,omitempty"`
+	Conflicts     map[string]string   `json:"conflicts,omitempty"`
+	Provides      map[string]string   `json:"provides,omitempty"`
+	Replaces      map[string]string   `json:"replaces,omitempty"`
 	Files         RawMetadataFiles    `json:"files,omitempty"`
 
+	Features map[string]RawMetadataFeaturesItem `json:"features,omitempty"`
+
 	Platforms []RawMetadataPlatformsItem `json:"platforms,omitempty"`
+
+	// EnabledFeatures is written by lip to the metadata of installed teeth, recording the
+	// features enabled when installing. It is ignored in tooth.json.
+	EnabledFeatures []string `json:"enabled_features,omitempty"`
 }
 
 type RawMetadataInfo struct {
@@ -25,10 +34,30 @@ type RawMetadataInfo struct {
 }
 
 type RawMetadataCommands struct {
-	PreInstall    []string `json:"pre_install,omitempty"`
-	PostInstall   []string `json:"post_install,omitempty"`
-	PreUninstall  []string `json:"pre_uninstall,omitempty"`
-	PostUninstall []string `json:"post_uninstall,omitempty"`
+	PreInstall    []RawMetadataCommand `json:"pre_install,omitempty"`
+	PostInstall   []RawMetadataCommand `json:"post_install,omitempty"`
+	PreUninstall  []RawMetadataCommand `json:"pre_uninstall,omitempty"`
+	PostUninstall []RawMetadataCommand `json:"post_uninstall,omitempty"`
+	PreUpgrade    []RawMetadataCommand `json:"pre_upgrade,omitempty"`
+	PostUpgrade   []RawMetadataCommand `json:"post_upgrade,omitempty"`
+}
+
+// RawMetadataCommand is written either as a string, which is the same as an object
+// with only Run set to the string, or as an object.
+type RawMetadataCommand struct {
+	Run             RawMetadataCommandRun `json:"run"`
+	Cwd             string                `json:"cwd,omitempty"`
+	Env             map[string]string     `json:"env,omitempty"`
+	Timeout         string                `json:"timeout,omitempty"`
+	ContinueOnError bool                  `json:"continue_on_error,omitempty"`
+	Shell           string                `json:"shell,omitempty"`
+}
+
+// RawMetadataCommandRun is written either as a string, which is a command line, or as
+// an array of the program and its arguments.
+type RawMetadataCommandRun struct {
+	Script string
+	Args   []string
 }
 
 type RawMetadataFiles struct {
@@ -42,6 +71,11 @@ type RawMetadataFilesPlaceItem struct {
 	Dest string `json:"dest"`
 }
 
+type RawMetadataFeaturesItem struct {
+	Description  string            `json:"description,omitempty"`
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+}
+
 type RawMetadataPlatformsItem struct {
 	GOARCH string `json:"goarch,omitempty"`
 	GOOS   string `json:"goos"`
@@ -50,5 +84,10 @@ type RawMetadataPlatformsItem struct {
 	Commands      RawMetadataCommands `json:"commands,omitempty"`
 	Dependencies  map[string]string   `json:"dependencies,omitempty"`
 	Prerequisites map[string]string   `json:"prerequisites,omitempty"`
+	Conflicts     map[string]string   `json:"conflicts,omitempty"`
+	Provides      map[string]string   `json:"provides,omitempty"`
+	Replaces      map[string]string   `json:"replaces,omitempty"`
 	Files         RawMetadataFiles    `json:"files,omitempty"`
+
+	Features map[string]RawMetadataFeaturesItem `json:"features,omitempty"`
 }
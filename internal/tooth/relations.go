@@ -0,0 +1,162 @@
+package tooth
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/blang/semver/v4"
+)
+
+// Satisfies tells whether the tooth satisfies a requirement on toothRepoPath in
+// versionRange, either by being that tooth in the range or by providing it with a
+// version in the range.
+func (m Metadata) Satisfies(toothRepoPath string, versionRange semver.Range) (bool, error) {
+	if m.ToothRepoPath() == toothRepoPath {
+		return versionRange(m.Version()), nil
+	}
+
+	provides, err := m.Provides()
+	if err != nil {
+		return false, fmt.Errorf("failed to get provided teeth of %v\n\t%w", m.ToothRepoPath(), err)
+	}
+
+	providedVersion, ok := provides[toothRepoPath]
+	return ok && versionRange(providedVersion), nil
+}
+
+// ConflictsWith tells whether the tooth cannot be installed together with the other
+// tooth, because either of them declares a conflict with or replaces the other one or a
+// virtual tooth it provides. If so, the returned string describes the conflict.
+func (m Metadata) ConflictsWith(other Metadata) (bool, string, error) {
+	if m.ToothRepoPath() == other.ToothRepoPath() {
+		return false, "", nil
+	}
+
+	conflicts, description, err := m.conflictsOneWay(other)
+	if err != nil || conflicts {
+		return conflicts, description, err
+	}
+
+	return other.conflictsOneWay(m)
+}
+
+// conflictsOneWay tells whether the tooth declares a conflict with or replaces the
+// other tooth.
+func (m Metadata) conflictsOneWay(other Metadata) (bool, string, error) {
+	conflicts, err := m.Conflicts()
+	if err != nil {
+		return false, "", fmt.Errorf("failed to get conflicts of %v\n\t%w", m.ToothRepoPath(), err)
+	}
+
+	replaces, err := m.Replaces()
+	if err != nil {
+		return false, "", fmt.Errorf("failed to get replaced teeth of %v\n\t%w", m.ToothRepoPath(), err)
+	}
+
+	relations := []struct {
+		verb           string
+		ranges         map[string]semver.Range
+		rangeStrings   map[string]string
+		toothRepoPaths []string
+	}{
+		{"conflicts with", conflicts, m.ConflictsAsStrings(), sortedKeys(conflicts)},
+		{"replaces", replaces, m.ReplacesAsStrings(), sortedKeys(replaces)},
+	}
+
+	for _, relation := range relations {
+		for _, toothRepoPath := range relation.toothRepoPaths {
+			satisfies, err := other.Satisfies(toothRepoPath, relation.ranges[toothRepoPath])
+			if err != nil {
+				return false, "", err
+			}
+
+			if satisfies {
+				return true, fmt.Sprintf("%v %v %v %v", m.ToothRepoPath(), relation.verb, toothRepoPath,
+					relation.rangeStrings[toothRepoPath]), nil
+			}
+		}
+	}
+
+	return false, "", nil
+}
+
+// FindSatisfyingTooth finds the tooth in metadataList satisfying a requirement on
+// toothRepoPath in versionRange. The tooth itself is preferred. Otherwise the first
+// tooth providing it in the range by tooth repo path is returned.
+func FindSatisfyingTooth(metadataList []Metadata, toothRepoPath string,
+	versionRange semver.Range) (Metadata, bool, error) {
+
+	providers := make([]Metadata, 0)
+	for _, metadata := range metadataList {
+		satisfies, err := metadata.Satisfies(toothRepoPath, versionRange)
+		if err != nil {
+			return Metadata{}, false, err
+		}
+
+		if !satisfies {
+			continue
+		}
+
+		if metadata.ToothRepoPath() == toothRepoPath {
+			return metadata, true, nil
+		}
+
+		providers = append(providers, metadata)
+	}
+
+	if len(providers) == 0 {
+		return Metadata{}, false, nil
+	}
+
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i].ToothRepoPath() < providers[j].ToothRepoPath()
+	})
+
+	return providers[0], true, nil
+}
+
+// MapDependenciesToInstalled maps each dependency of the tooth to the installed tooth
+// satisfying it, i.e. the dependency itself if installed, otherwise an installed tooth
+// providing it in the required version range. Dependencies neither installed nor provided
+// are mapped to themselves.
+func MapDependenciesToInstalled(metadata Metadata, installedMetadataList []Metadata) (map[string]string, error) {
+	depMap, err := metadata.Dependencies()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dependencies of %v\n\t%w", metadata.ToothRepoPath(), err)
+	}
+
+	installed := make(map[string]bool)
+	for _, installedMetadata := range installedMetadataList {
+		installed[installedMetadata.ToothRepoPath()] = true
+	}
+
+	dependencyMap := make(map[string]string)
+	for dep, versionRange := range depMap {
+		dependencyMap[dep] = dep
+
+		if installed[dep] {
+			continue
+		}
+
+		provider, ok, err := FindSatisfyingTooth(installedMetadataList, dep, versionRange)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find provider of %v\n\t%w", dep, err)
+		}
+
+		if ok {
+			dependencyMap[dep] = provider.ToothRepoPath()
+		}
+	}
+
+	return dependencyMap, nil
+}
+
+func sortedKeys(ranges map[string]semver.Range) []string {
+	keys := make([]string, 0, len(ranges))
+	for key := range ranges {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
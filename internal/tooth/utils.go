@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/blang/semver/v4"
@@ -59,6 +60,45 @@ func GetAllMetadata(ctx *context.Context) ([]Metadata, error) {
 	return metadataList, nil
 }
 
+// GetReverseDependencies returns a map from the tooth repo path of each installed tooth
+// to the sorted tooth repo paths of the installed teeth depending on it. A dependency not
+// installed itself is attributed to the installed tooth providing it, if any. Teeth
+// without dependents are not in the map.
+func GetReverseDependencies(ctx *context.Context) (map[string][]string, error) {
+	metadataList, err := GetAllMetadata(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list all installed tooth metadata\n\t%w", err)
+	}
+
+	reverseDependencies := make(map[string][]string)
+	for _, metadata := range metadataList {
+		dependencyMap, err := MapDependenciesToInstalled(metadata, metadataList)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, dep := range dependencyMap {
+			reverseDependencies[dep] = append(reverseDependencies[dep], metadata.ToothRepoPath())
+		}
+	}
+
+	// A tooth may depend on several virtual teeth provided by the same tooth.
+	for dep, dependents := range reverseDependencies {
+		sort.Strings(dependents)
+
+		uniqueDependents := make([]string, 0, len(dependents))
+		for i, dependent := range dependents {
+			if i == 0 || dependent != dependents[i-1] {
+				uniqueDependents = append(uniqueDependents, dependent)
+			}
+		}
+
+		reverseDependencies[dep] = uniqueDependents
+	}
+
+	return reverseDependencies, nil
+}
+
 // GetAvailableVersions fetches the version list of a tooth repository.
 func GetAvailableVersions(ctx *context.Context, toothRepoPath string) (semver.Versions,
 	error) {
@@ -82,7 +122,7 @@ func GetAvailableVersions(ctx *context.Context, toothRepoPath string) (semver.Ve
 		return nil, fmt.Errorf("failed to get proxy URL\n\t%w", err)
 	}
 
-	content, err := network.GetContent(versionURL, proxyURL)
+	content, err := network.GetContent(ctx.GoContext(), versionURL, proxyURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch version list\n\t%w", err)
 	}